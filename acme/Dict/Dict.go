@@ -1,8 +1,24 @@
+// Dict looks up words in dictionaries, showing definitions in acme windows.
+//
+// Usage:
+//
+//	Dict [-d dict] [-s server] [-f file]... [-w file]...
+//
+// By default Dict consults a DICT protocol server.
+// The -f and -w flags instead select local dictionaries,
+// which may be used offline: -f names a dictionary in the format
+// used by dictd(8), with files file.index and file.dict or file.dict.dz,
+// and -w names a plain word list with one word per line.
+// Both flags may be repeated.
+//
+// Looking (button 3) at a word in a Dict window
+// opens windows showing its definitions.
 package main // import "9fans.net/go/acme/Dict"
 
 import (
 	"flag"
 	"log"
+	"strings"
 
 	"9fans.net/go/acme"
 	"golang.org/x/net/dict"
@@ -10,17 +26,30 @@ import (
 
 var dictx = flag.String("d", "", "dictionary")
 var server = flag.String("s", "dict.org:dict", "server")
+var dictdFiles, wordFiles files
 var lookc = make(chan string)
-var d *dict.Client
+var d backend
 var dicts []dict.Dict
 
+func init() {
+	flag.Var(&dictdFiles, "f", "use the dictd-format dictionary `file`")
+	flag.Var(&wordFiles, "w", "use the word list `file`")
+}
+
+// files is a flag.Value collecting repeated file name flags.
+type files []string
+
+func (f *files) String() string     { return strings.Join(*f, ",") }
+func (f *files) Set(s string) error { *f = append(*f, s); return nil }
+
 func main() {
+	flag.Parse()
 	w, err := acme.New()
 	if err != nil {
 		log.Fatal(err)
 	}
 	w.Name("/dict/")
-	d, err = dict.Dial("tcp", *server)
+	d, err = open()
 	if err != nil {
 		w.Write("body", []byte(err.Error()))
 		return
@@ -41,8 +70,37 @@ func main() {
 	}
 }
 
+// open returns the backend selected by the command-line flags.
+func open() (backend, error) {
+	if len(dictdFiles) == 0 && len(wordFiles) == 0 {
+		return dict.Dial("tcp", *server)
+	}
+	var m multi
+	for _, name := range dictdFiles {
+		b, err := openDictd(name)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m = append(m, b)
+	}
+	for _, name := range wordFiles {
+		b, err := openWords(name)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m = append(m, b)
+	}
+	return m, nil
+}
+
 func lookup(word string) {
-	defs, err := d.Define("!", word)
+	name := "!"
+	if *dictx != "" {
+		name = *dictx
+	}
+	defs, err := d.Define(name, word)
 	if err != nil {
 		log.Print(err)
 		return
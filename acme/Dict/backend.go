@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/net/dict"
+)
+
+// A backend looks up words in a set of dictionaries.
+// A *dict.Client, connected to a DICT protocol server, is a backend.
+type backend interface {
+	// Dicts returns the dictionaries the backend serves.
+	Dicts() ([]dict.Dict, error)
+
+	// Define returns the definitions of word in the named dictionary.
+	// As in the DICT protocol, the name "!" means the first
+	// dictionary holding a definition, and "*" means all dictionaries.
+	Define(name, word string) ([]*dict.Defn, error)
+
+	Close() error
+}
+
+// multi is a backend serving the dictionaries of each of its backends, in order.
+type multi []backend
+
+func (m multi) Dicts() ([]dict.Dict, error) {
+	var all []dict.Dict
+	for _, b := range m {
+		dicts, err := b.Dicts()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, dicts...)
+	}
+	return all, nil
+}
+
+func (m multi) Define(name, word string) ([]*dict.Defn, error) {
+	var all []*dict.Defn
+	for _, b := range m {
+		defs, err := b.Define(name, word)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, defs...)
+		if name == "!" && len(all) > 0 {
+			break
+		}
+	}
+	return all, nil
+}
+
+func (m multi) Close() error {
+	var err error
+	for _, b := range m {
+		if e := b.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// serves reports whether a lookup in the named dictionary
+// should consult the dictionary d.
+func serves(d dict.Dict, name string) bool {
+	return name == "!" || name == "*" || name == d.Name
+}
+
+// dictName returns the dictionary name for the file name:
+// its base name without directory or the given suffixes.
+func dictName(file string, suffixes ...string) string {
+	if i := strings.LastIndex(file, "/"); i >= 0 {
+		file = file[i+1:]
+	}
+	for _, s := range suffixes {
+		file = strings.TrimSuffix(file, s)
+	}
+	return file
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// entries are the definitions in the test dictionary.
+var entries = []struct{ word, text string }{
+	{"00-database-short", "00-database-short\n     Test Dictionary\n"},
+	{"acme", "acme\n  The highest point.\n"},
+	{"Plumb", "Plumb\n  A lead weight on a line.\n"},
+	{"plumb", "plumb\n  Exactly vertical.\n"},
+	{"zerox", "zerox\n  " + strings.Repeat("A second view of the same text. ", 20) + "\n"},
+}
+
+// writeDictd writes the test dictionary to dir/name.index and dir/name.dict,
+// or, if dz is set, dir/name.dict.dz, compressed in chunks of chunkLen bytes.
+func writeDictd(t *testing.T, dir, name string, dz bool, chunkLen int) string {
+	var index, data bytes.Buffer
+	for _, e := range entries {
+		index.WriteString(e.word + "\t" + encode64(data.Len()) + "\t" + encode64(len(e.text)) + "\n")
+		data.WriteString(e.text)
+	}
+	base := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(base+".index", index.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if !dz {
+		if err := ioutil.WriteFile(base+".dict", data.Bytes(), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return base
+	}
+	if err := ioutil.WriteFile(base+".dict.dz", compressDictzip(t, data.Bytes(), chunkLen), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return base
+}
+
+func encode64(n int) string {
+	s := ""
+	for {
+		s = string(digits64[n%64]) + s
+		if n /= 64; n == 0 {
+			return s
+		}
+	}
+}
+
+// compressDictzip returns data compressed as dictzip(1) does.
+func compressDictzip(t *testing.T, data []byte, chunkLen int) []byte {
+	var body bytes.Buffer
+	var sizes []uint16
+	for i := 0; i < len(data); i += chunkLen {
+		j := i + chunkLen
+		if j > len(data) {
+			j = len(data)
+		}
+		n := body.Len()
+		fw, _ := flate.NewWriter(&body, flate.BestCompression)
+		fw.Write(data[i:j])
+		if j == len(data) {
+			fw.Close()
+		} else {
+			fw.Flush()
+		}
+		sizes = append(sizes, uint16(body.Len()-n))
+	}
+
+	le := binary.LittleEndian
+	var ra bytes.Buffer
+	binary.Write(&ra, le, []uint16{1, uint16(chunkLen), uint16(len(sizes))})
+	binary.Write(&ra, le, sizes)
+	var extra bytes.Buffer
+	extra.WriteString("RA")
+	binary.Write(&extra, le, uint16(ra.Len()))
+	extra.Write(ra.Bytes())
+
+	var out bytes.Buffer
+	out.Write([]byte{0x1f, 0x8b, 8, gzipExtra | gzipName, 0, 0, 0, 0, 2, 3})
+	binary.Write(&out, le, uint16(extra.Len()))
+	out.Write(extra.Bytes())
+	out.WriteString("test.dict\x00")
+	out.Write(body.Bytes())
+	binary.Write(&out, le, crc32.ChecksumIEEE(data))
+	binary.Write(&out, le, uint32(len(data)))
+	return out.Bytes()
+}
+
+func TestDictd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		name     string
+		dz       bool
+		chunkLen int
+	}{
+		{"plain", false, 0},
+		{"dz", true, 64},
+		{"dzbig", true, 60000},
+	} {
+		base := writeDictd(t, dir, tt.name, tt.dz, tt.chunkLen)
+		d, err := openDictd(base + ".index")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		dicts, _ := d.Dicts()
+		if len(dicts) != 1 || dicts[0].Name != tt.name || dicts[0].Desc != "Test Dictionary" {
+			t.Errorf("%s: Dicts = %+v", tt.name, dicts)
+		}
+		for _, e := range entries[1:] {
+			defs, err := d.Define("!", e.word)
+			if err != nil || len(defs) == 0 {
+				t.Errorf("%s: Define(%q) = %v, %v", tt.name, e.word, defs, err)
+				continue
+			}
+			found := false
+			for _, def := range defs {
+				found = found || def.Word == e.word && string(def.Text) == e.text
+			}
+			if !found {
+				t.Errorf("%s: Define(%q) did not return %q", tt.name, e.word, e.text)
+			}
+		}
+		if defs, _ := d.Define("*", "PLUMB"); len(defs) != 2 {
+			t.Errorf("%s: Define(PLUMB) returned %d definitions, want 2", tt.name, len(defs))
+		}
+		if defs, _ := d.Define("other", "acme"); len(defs) != 0 {
+			t.Errorf("%s: Define in other dictionary returned %d definitions", tt.name, len(defs))
+		}
+		if defs, _ := d.Define("!", "missing"); len(defs) != 0 {
+			t.Errorf("%s: Define(missing) returned %d definitions", tt.name, len(defs))
+		}
+		d.Close()
+	}
+
+	if _, err := openDictd(filepath.Join(dir, "none")); err == nil {
+		t.Errorf("openDictd of missing dictionary succeeded")
+	}
+}
+
+func TestWords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "words")
+	if err := ioutil.WriteFile(file, []byte("Acme\nacmes\nplumb\nplumber\tone who plumbs\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	base := writeDictd(t, dir, "test", false, 0)
+	d1, err := openDictd(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := openWords(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := multi{d1, d2}
+	defer m.Close()
+
+	defs, err := d2.Define("*", "plumb")
+	if err != nil || len(defs) != 1 || string(defs[0].Text) != "plumb\nplumber\tone who plumbs\n" {
+		t.Errorf("Define(plumb) = %v, %v", defs, err)
+	}
+	dicts, _ := m.Dicts()
+	if len(dicts) != 2 || dicts[1].Name != "words" {
+		t.Errorf("Dicts = %+v", dicts)
+	}
+	if defs, _ := m.Define("!", "acme"); len(defs) != 1 || defs[0].Dict.Name != "test" {
+		t.Errorf("Define(!, acme) = %+v", defs)
+	}
+	if defs, _ := m.Define("*", "acme"); len(defs) != 2 || string(defs[1].Text) != "Acme\nacmes\n" {
+		t.Errorf("Define(*, acme) = %+v", defs)
+	}
+	if defs, _ := m.Define("words", "acm"); len(defs) != 1 {
+		t.Errorf("Define(words, acm) = %+v", defs)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/net/dict"
+)
+
+// A dictd is a local dictionary in the format used by dictd(8):
+// an index file x.index listing the headwords and the location
+// of their definitions in the data file, x.dict or the dictzip file x.dict.dz.
+type dictd struct {
+	dict  dict.Dict
+	index map[string][]span // by lower-case headword
+	data  io.ReaderAt
+	file  *os.File
+}
+
+// A span locates a definition in a data file.
+type span struct {
+	word      string
+	off, size int64
+}
+
+// openDictd opens the dictd dictionary with the given file name,
+// which may name the index or data file or omit the suffix altogether.
+func openDictd(name string) (*dictd, error) {
+	base := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(name, ".dz"), ".dict"), ".index")
+	d := &dictd{
+		dict:  dict.Dict{Name: dictName(base)},
+		index: make(map[string][]span),
+	}
+
+	f, err := os.Open(base + ".index")
+	if err != nil {
+		return nil, err
+	}
+	err = d.readIndex(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if f, err = os.Open(base + ".dict"); err == nil {
+		d.data, d.file = f, f
+	} else if f, err = os.Open(base + ".dict.dz"); err == nil {
+		d.file = f
+		if d.data, err = newDictzip(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %v", f.Name(), err)
+		}
+	} else {
+		return nil, fmt.Errorf("%s: no .dict or .dict.dz data file", base)
+	}
+
+	// The database description is stored as a definition.
+	for _, key := range []string{"00-database-short", "00databaseshort"} {
+		if spans := d.index[key]; len(spans) > 0 {
+			text, err := d.read(spans[0])
+			if err != nil {
+				d.Close()
+				return nil, err
+			}
+			text = strings.TrimSpace(text)
+			if i := strings.Index(text, "\n"); i >= 0 && strings.TrimSpace(text[:i]) == key {
+				text = strings.TrimSpace(text[i+1:])
+			}
+			d.dict.Desc = text
+			break
+		}
+	}
+	return d, nil
+}
+
+// readIndex reads the index file f.
+// Each line holds a headword, the offset of its definition,
+// and the definition's length, separated by tabs.
+// The numbers are written in base 64.
+func (d *dictd) readIndex(f *os.File) error {
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			return fmt.Errorf("%s:%d: malformed index entry", f.Name(), n)
+		}
+		off, err1 := decode64(fields[1])
+		size, err2 := decode64(fields[2])
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("%s:%d: malformed index entry", f.Name(), n)
+		}
+		key := strings.ToLower(fields[0])
+		d.index[key] = append(d.index[key], span{fields[0], off, size})
+	}
+	return s.Err()
+}
+
+const digits64 = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// decode64 decodes a number written in the base 64 digits of a dictd index.
+func decode64(s string) (int64, error) {
+	if s == "" {
+		return 0, errors.New("empty number")
+	}
+	var v int64
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(digits64, s[i])
+		if d < 0 {
+			return 0, fmt.Errorf("bad digit %q", s[i])
+		}
+		v = v*64 + int64(d)
+	}
+	return v, nil
+}
+
+func (d *dictd) read(sp span) (string, error) {
+	buf := make([]byte, sp.size)
+	n, err := d.data.ReadAt(buf, sp.off)
+	if n == len(buf) {
+		err = nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: reading %s: %v", d.dict.Name, sp.word, err)
+	}
+	return string(buf), nil
+}
+
+func (d *dictd) Dicts() ([]dict.Dict, error) {
+	return []dict.Dict{d.dict}, nil
+}
+
+func (d *dictd) Define(name, word string) ([]*dict.Defn, error) {
+	if !serves(d.dict, name) {
+		return nil, nil
+	}
+	var defs []*dict.Defn
+	for _, sp := range d.index[strings.ToLower(word)] {
+		text, err := d.read(sp)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, &dict.Defn{Dict: d.dict, Word: sp.word, Text: []byte(text)})
+	}
+	return defs, nil
+}
+
+func (d *dictd) Close() error {
+	return d.file.Close()
+}
+
+// A dictzip provides random access to the uncompressed data
+// of a file written by dictzip(1).
+// Such a file is a gzip file whose data is compressed in chunks,
+// each of which can be decompressed independently.
+// A header field records the length of the chunks
+// and the compressed size of each.
+type dictzip struct {
+	r        io.ReaderAt
+	chunkLen int64
+	offsets  []int64 // offset of each compressed chunk, and of the end of the last
+}
+
+// newDictzip returns a ReaderAt for the uncompressed data in the dictzip file f.
+// If f is a gzip file without the dictzip header,
+// newDictzip decompresses all of it into memory.
+func newDictzip(f *os.File) (io.ReaderAt, error) {
+	z, err := readDictzipHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	if z != nil {
+		return z, nil
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// Gzip header flags.
+const (
+	gzipHCRC    = 1 << 1
+	gzipExtra   = 1 << 2
+	gzipName    = 1 << 3
+	gzipComment = 1 << 4
+)
+
+// readDictzipHeader reads the gzip header of f.
+// It returns nil if there is no dictzip chunk table.
+func readDictzipHeader(f *os.File) (*dictzip, error) {
+	cr := &countReader{r: bufio.NewReader(f)}
+	var hdr [10]byte
+	if _, err := io.ReadFull(cr, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0] != 0x1f || hdr[1] != 0x8b || hdr[2] != 8 {
+		return nil, gzip.ErrHeader
+	}
+	flags := hdr[3]
+	var extra []byte
+	if flags&gzipExtra != 0 {
+		var n uint16
+		if err := binary.Read(cr, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		extra = make([]byte, n)
+		if _, err := io.ReadFull(cr, extra); err != nil {
+			return nil, err
+		}
+	}
+	for _, flag := range []byte{gzipName, gzipComment} {
+		if flags&flag != 0 {
+			for {
+				b, err := cr.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				if b == 0 {
+					break
+				}
+			}
+		}
+	}
+	if flags&gzipHCRC != 0 {
+		if _, err := io.ReadFull(cr, hdr[:2]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Find the RA (random access) subfield:
+	// version, chunk length, chunk count, and compressed chunk sizes,
+	// all 16-bit little-endian numbers.
+	le := binary.LittleEndian
+	for len(extra) >= 4 {
+		id, n := string(extra[:2]), int(le.Uint16(extra[2:]))
+		if len(extra) < 4+n {
+			break
+		}
+		sub := extra[4 : 4+n]
+		extra = extra[4+n:]
+		if id != "RA" || len(sub) < 6 || le.Uint16(sub) != 1 || le.Uint16(sub[2:]) == 0 {
+			continue
+		}
+		count := int(le.Uint16(sub[4:]))
+		if len(sub) < 6+2*count {
+			return nil, errors.New("short dictzip chunk table")
+		}
+		z := &dictzip{r: f, chunkLen: int64(le.Uint16(sub[2:]))}
+		off := cr.n
+		z.offsets = append(z.offsets, off)
+		for i := 0; i < count; i++ {
+			off += int64(le.Uint16(sub[6+2*i:]))
+			z.offsets = append(z.offsets, off)
+		}
+		return z, nil
+	}
+	return nil, nil
+}
+
+// ReadAt reads len(p) bytes of uncompressed data starting at off.
+func (z *dictzip) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		i := (off + int64(n)) / z.chunkLen
+		if i >= int64(len(z.offsets)-1) {
+			return n, io.EOF
+		}
+		chunk, err := z.chunk(int(i))
+		if err != nil {
+			return n, err
+		}
+		start := off + int64(n) - i*z.chunkLen
+		if start >= int64(len(chunk)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], chunk[start:])
+	}
+	return n, nil
+}
+
+// chunk returns the uncompressed data of chunk i.
+// Each chunk ends in a full flush, so it can be
+// decompressed without those before it.
+func (z *dictzip) chunk(i int) ([]byte, error) {
+	r := flate.NewReader(io.NewSectionReader(z.r, z.offsets[i], z.offsets[i+1]-z.offsets[i]))
+	buf := make([]byte, z.chunkLen)
+	n, err := io.ReadFull(r, buf)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	}
+	return buf[:n], err
+}
+
+// A countReader counts the bytes read from r.
+type countReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
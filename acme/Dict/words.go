@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+
+	"golang.org/x/net/dict"
+)
+
+// maxWords is the maximum number of entries in a word list definition.
+const maxWords = 200
+
+// A wordList is a local dictionary read from a plain text file,
+// such as /usr/share/dict/words, holding one word per line.
+// A word may be followed by a tab and a short definition.
+//
+// Looking up a word in a word list lists the entries
+// beginning with that word, ignoring case,
+// so that the list works as a spelling aid.
+type wordList struct {
+	dict    dict.Dict
+	entries []wordEntry
+}
+
+type wordEntry struct {
+	word, text string
+}
+
+// openWords reads the word list in the named file.
+func openWords(name string) (*wordList, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	l := &wordList{dict: dict.Dict{Name: dictName(name, ".txt"), Desc: "word list " + name}}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		if line == "" {
+			continue
+		}
+		e := wordEntry{word: line}
+		if i := strings.Index(line, "\t"); i >= 0 {
+			e.word, e.text = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		l.entries = append(l.entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *wordList) Dicts() ([]dict.Dict, error) {
+	return []dict.Dict{l.dict}, nil
+}
+
+func (l *wordList) Define(name, word string) ([]*dict.Defn, error) {
+	if !serves(l.dict, name) || word == "" {
+		return nil, nil
+	}
+	prefix := strings.ToLower(word)
+	var buf bytes.Buffer
+	n := 0
+	for _, e := range l.entries {
+		if !strings.HasPrefix(strings.ToLower(e.word), prefix) {
+			continue
+		}
+		if n++; n > maxWords {
+			buf.WriteString("...\n")
+			break
+		}
+		buf.WriteString(e.word)
+		if e.text != "" {
+			buf.WriteString("\t" + e.text)
+		}
+		buf.WriteString("\n")
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	return []*dict.Defn{{Dict: l.dict, Word: word, Text: buf.Bytes()}}, nil
+}
+
+func (l *wordList) Close() error {
+	return nil
+}
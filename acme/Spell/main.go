@@ -0,0 +1,269 @@
+// Spell checks the spelling of the text in acme windows.
+//
+// Usage:
+//
+//	Spell [-w words]... [window...]
+//
+// Spell checks the body of each window, given by ID or by a pattern
+// matching the window's name or its final element, using the syntax
+// of path.Match. With no arguments, it checks the window in which it
+// was run, given by $winid.
+//
+// The words are checked against the word lists given by -w flags,
+// one word per line, or by default against /usr/share/dict/words
+// and $HOME/lib/words, if they exist. In Go source files, only the
+// words in comments and string literals are checked, and words that look
+// like code, such as identifiers in mixed case, are never checked.
+//
+// Spell lists the misspelled words in a +Spell window, one per line,
+// giving the word's address, as in file:#q0,#q1, the word, and
+// suggested corrections. Looking (button 3) at an address shows the word
+// in its window. Executing (button 2) a suggestion replaces the word with it.
+// Executing Check in the +Spell window's tag checks the windows again.
+package main // import "9fans.net/go/acme/Spell"
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"9fans.net/go/acme"
+)
+
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, " ") }
+func (l *listFlag) Set(s string) error { *l = append(*l, s); return nil }
+
+var wordFiles listFlag
+
+// A miss is a misspelled word in a window.
+type miss struct {
+	id      int // window ID
+	name    string
+	word    word
+	suggest []string
+}
+
+// A checker checks windows and shows its results in the +Spell window.
+type checker struct {
+	dict   dictionary
+	args   []string
+	w      *acme.Win
+	misses []miss
+	lines  []int // rune offset of each line of the +Spell window body, and of its end
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("Spell: ")
+	flag.Var(&wordFiles, "w", "check against the word list `file`")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: Spell [-w words]... [window...]\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	flag.Parse()
+
+	c := &checker{dict: make(dictionary), args: flag.Args()}
+	if len(c.args) == 0 {
+		id := os.Getenv("winid")
+		if id == "" {
+			flag.Usage()
+		}
+		c.args = []string{id}
+	}
+	if len(wordFiles) == 0 {
+		for _, file := range []string{"/usr/share/dict/words", filepath.Join(os.Getenv("HOME"), "lib/words")} {
+			if _, err := os.Stat(file); err == nil {
+				wordFiles = append(wordFiles, file)
+			}
+		}
+		if len(wordFiles) == 0 {
+			log.Fatal("no word lists found; use -w")
+		}
+	}
+	for _, file := range wordFiles {
+		if err := c.dict.loadWords(file); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	wins, err := c.windows()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(wins) == 0 {
+		log.Fatalf("no windows match %s", strings.Join(c.args, " "))
+	}
+	dir := path.Dir(wins[0].Name)
+	if !strings.HasPrefix(dir, "/") {
+		dir, _ = os.Getwd()
+	}
+	c.w, err = acme.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.w.Name("%s/+Spell", strings.TrimSuffix(dir, "/"))
+	c.w.AddTag("Check")
+	c.w.SetErrorPrefix(dir + "/")
+	c.check(wins)
+	c.loop()
+}
+
+// windows returns the windows named by the command-line arguments.
+func (c *checker) windows() ([]acme.WinInfo, error) {
+	all, err := acme.Windows()
+	if err != nil {
+		return nil, err
+	}
+	var wins []acme.WinInfo
+	for _, info := range all {
+		if strings.HasSuffix(info.Name, "/+Spell") {
+			continue
+		}
+		for _, arg := range c.args {
+			if id, err := strconv.Atoi(arg); err == nil && id == info.ID {
+				wins = append(wins, info)
+				break
+			}
+			m1, _ := path.Match(arg, info.Name)
+			m2, _ := path.Match(arg, path.Base(info.Name))
+			if m1 || m2 {
+				wins = append(wins, info)
+				break
+			}
+		}
+	}
+	sort.Slice(wins, func(i, j int) bool { return wins[i].Name < wins[j].Name })
+	return wins, nil
+}
+
+// check checks the windows and shows the results.
+func (c *checker) check(wins []acme.WinInfo) {
+	c.misses = nil
+	for _, info := range wins {
+		w, err := acme.Open(info.ID, nil)
+		if err != nil {
+			c.w.Err(err.Error())
+			continue
+		}
+		body, err := w.ReadAll("body")
+		w.CloseFiles()
+		if err != nil {
+			c.w.Err(err.Error())
+			continue
+		}
+		for _, wd := range words(body, strings.HasSuffix(info.Name, ".go")) {
+			if !c.dict.correct(wd.text) {
+				c.misses = append(c.misses, miss{info.ID, info.Name, wd, c.dict.suggest(wd.text)})
+			}
+		}
+	}
+	c.show()
+}
+
+// show displays the misspellings in the +Spell window.
+func (c *checker) show() {
+	var buf bytes.Buffer
+	c.lines = []int{0}
+	for _, m := range c.misses {
+		line := fmt.Sprintf("%s:#%d,#%d\t%s\t%s\n", m.name, m.word.q0, m.word.q1, m.word.text, strings.Join(m.suggest, " "))
+		buf.WriteString(line)
+		c.lines = append(c.lines, c.lines[len(c.lines)-1]+len([]rune(line)))
+	}
+	if err := c.w.ReplaceBody(buf.Bytes()); err != nil {
+		c.w.Err(err.Error())
+	}
+	c.w.Clean()
+}
+
+// loop handles the events in the +Spell window.
+func (c *checker) loop() {
+	for e := range c.w.EventChan() {
+		switch e.C2 {
+		case 'x', 'X':
+			cmd := strings.TrimSpace(string(e.Text))
+			if cmd == "Check" {
+				wins, err := c.windows()
+				if err != nil {
+					c.w.Err(err.Error())
+					break
+				}
+				c.check(wins)
+				break
+			}
+			if e.C2 == 'X' {
+				if i := c.lineAt(e.Q0); i >= 0 && contains(c.misses[i].suggest, cmd) {
+					if err := c.replace(i, cmd); err != nil {
+						c.w.Err(err.Error())
+					}
+					break
+				}
+			}
+			c.w.WriteEvent(e)
+		case 'l', 'L':
+			c.w.WriteEvent(e)
+		}
+	}
+}
+
+func (c *checker) lineAt(q int) int {
+	for i := 0; i+1 < len(c.lines); i++ {
+		if c.lines[i] <= q && q < c.lines[i+1] {
+			return i
+		}
+	}
+	return -1
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// replace replaces the misspelled word i with text in its window,
+// and adjusts the addresses of the words after it.
+func (c *checker) replace(i int, text string) error {
+	m := c.misses[i]
+	w, err := acme.Open(m.id, nil)
+	if err != nil {
+		return err
+	}
+	defer w.CloseFiles()
+	if err := w.Addr("#%d,#%d", m.word.q0, m.word.q1); err != nil {
+		return err
+	}
+	old, err := w.ReadAll("xdata")
+	if err != nil {
+		return err
+	}
+	if string(old) != m.word.text {
+		return fmt.Errorf("%s:#%d,#%d: text has changed; Check again", m.name, m.word.q0, m.word.q1)
+	}
+	if _, err := w.Write("data", []byte(text)); err != nil {
+		return err
+	}
+
+	delta := len([]rune(text)) - len([]rune(m.word.text))
+	c.misses = append(c.misses[:i], c.misses[i+1:]...)
+	for j := range c.misses {
+		if n := &c.misses[j]; n.id == m.id && n.word.q0 >= m.word.q1 {
+			n.word.q0 += delta
+			n.word.q1 += delta
+		}
+	}
+	c.show()
+	return nil
+}
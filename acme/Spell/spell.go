@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"go/scanner"
+	"go/token"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A dictionary is a set of correctly spelled words.
+type dictionary map[string]bool
+
+// readWords adds the words in r, one per line, to d.
+// Anything after the first tab or space on a line is ignored.
+func (d dictionary) readWords(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if f := strings.Fields(s.Text()); len(f) > 0 {
+			d[f[0]] = true
+		}
+	}
+	return s.Err()
+}
+
+// loadWords adds the words in the named file to d.
+func (d dictionary) loadWords(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return d.readWords(f)
+}
+
+// correct reports whether word is spelled correctly.
+// A capitalized word is also accepted in lower case,
+// and a possessive is accepted if the word without it is.
+func (d dictionary) correct(word string) bool {
+	for {
+		if d[word] || d[strings.ToLower(word)] {
+			return true
+		}
+		switch {
+		case strings.HasSuffix(word, "'s"):
+			word = strings.TrimSuffix(word, "'s")
+		case strings.HasSuffix(word, "'"):
+			word = strings.TrimSuffix(word, "'")
+		default:
+			return false
+		}
+	}
+}
+
+// maxSuggest is the maximum number of suggestions for a misspelling.
+const maxSuggest = 5
+
+// suggest returns the words in d at edit distance 1 from word,
+// other than word itself,
+// capitalized if word is.
+func (d dictionary) suggest(word string) []string {
+	lower := []rune(strings.ToLower(word))
+	seen := map[string]bool{string(lower): true}
+	var out []string
+	try := func(r []rune) {
+		s := string(r)
+		if !seen[s] && d[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	for i := 0; i <= len(lower); i++ {
+		if i < len(lower) {
+			try(concat(lower[:i], lower[i+1:])) // deletion
+		}
+		if i+1 < len(lower) {
+			try(concat(lower[:i], []rune{lower[i+1], lower[i]}, lower[i+2:])) // transposition
+		}
+		for c := 'a'; c <= 'z'; c++ {
+			if i < len(lower) {
+				try(concat(lower[:i], []rune{c}, lower[i+1:])) // replacement
+			}
+			try(concat(lower[:i], []rune{c}, lower[i:])) // insertion
+		}
+	}
+	sort.Strings(out)
+	if len(out) > maxSuggest {
+		out = out[:maxSuggest]
+	}
+	if r, _ := utf8.DecodeRuneInString(word); unicode.IsUpper(r) {
+		for i, s := range out {
+			out[i] = strings.ToUpper(s[:1]) + s[1:]
+		}
+	}
+	return out
+}
+
+func concat(parts ...[]rune) []rune {
+	var r []rune
+	for _, p := range parts {
+		r = append(r, p...)
+	}
+	return r
+}
+
+// A word is a word in a text, with its location as rune offsets.
+type word struct {
+	text   string
+	q0, q1 int
+}
+
+// words returns the words to check in src.
+// If isGo is set, src is Go source, and only the words in
+// comments and string literals, other than import paths, are checked.
+func words(src []byte, isGo bool) []word {
+	var spans [][2]int // byte offsets
+	if !isGo {
+		spans = wordSpans(src, 0, spans)
+	} else {
+		fset := token.NewFileSet()
+		file := fset.AddFile("", fset.Base(), len(src))
+		var s scanner.Scanner
+		s.Init(file, src, nil, scanner.ScanComments)
+		importing, paren := false, false
+		for {
+			pos, tok, lit := s.Scan()
+			if tok == token.EOF {
+				break
+			}
+			off := file.Offset(pos)
+			end := off + len(lit)
+			if end > len(src) {
+				end = len(src)
+			}
+			switch tok {
+			case token.IMPORT:
+				importing = true
+			case token.LPAREN:
+				paren = importing
+			case token.RPAREN:
+				importing, paren = false, false
+			case token.SEMICOLON:
+				if !paren {
+					importing = false
+				}
+			case token.COMMENT:
+				spans = wordSpans(src[:end], off, spans)
+			case token.STRING:
+				if !importing {
+					spans = wordSpans(src[:end], off, spans)
+				}
+			}
+		}
+	}
+
+	// Convert byte offsets to rune offsets.
+	var out []word
+	q, b := 0, 0
+	for _, sp := range spans {
+		q += utf8.RuneCount(src[b:sp[0]])
+		n := utf8.RuneCount(src[sp[0]:sp[1]])
+		out = append(out, word{string(src[sp[0]:sp[1]]), q, q + n})
+		q += n
+		b = sp[1]
+	}
+	return out
+}
+
+// wordSpans appends to spans the byte offsets of the words in src[off:],
+// skipping words that look like code: identifiers with digits or
+// underscores, names in mixed case, paths and URLs, and format verbs.
+func wordSpans(src []byte, off int, spans [][2]int) [][2]int {
+	isWordRune := func(r rune) bool { return unicode.IsLetter(r) || r == '\'' }
+	for i := off; i < len(src); {
+		r, size := utf8.DecodeRune(src[i:])
+		if !unicode.IsLetter(r) {
+			i += size
+			continue
+		}
+		j := i
+		for j < len(src) {
+			r, size := utf8.DecodeRune(src[j:])
+			if !isWordRune(r) {
+				break
+			}
+			j += size
+		}
+		k := j
+		for k > i && src[k-1] == '\'' {
+			k--
+		}
+		if plain(src, i, k) {
+			spans = append(spans, [2]int{i, k})
+		}
+		i = j
+	}
+	return spans
+}
+
+// plain reports whether src[i:j] is a plain word, worth checking.
+func plain(src []byte, i, j int) bool {
+	w := string(src[i:j])
+	if utf8.RuneCountInString(w) < 2 {
+		return false
+	}
+	for k, r := range w {
+		if k > 0 && unicode.IsUpper(r) {
+			return false
+		}
+	}
+	if i > 0 && strings.IndexByte("_0123456789./\\%@$#&", src[i-1]) >= 0 {
+		return false
+	}
+	if j < len(src) {
+		if strings.IndexByte("_0123456789/\\@", src[j]) >= 0 {
+			return false
+		}
+		if (src[j] == '.' || src[j] == ':') && j+1 < len(src) && !unicode.IsSpace(rune(src[j+1])) && src[j+1] != '"' && src[j+1] != '`' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testDict(t *testing.T) dictionary {
+	d := make(dictionary)
+	err := d.readWords(strings.NewReader("the\nquick\nbrown\nfox\nfoxes\nreads\nwords\nread\nroads\nacme\nfile\nfiles\tplural\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestCorrect(t *testing.T) {
+	d := testDict(t)
+	for w, ok := range map[string]bool{
+		"the":    true,
+		"The":    true,
+		"fox's":  true,
+		"foxes'": true,
+		"files":  true,
+		"quikc":  false,
+		"plural": false,
+		"ACME":   true,
+	} {
+		if d.correct(w) != ok {
+			t.Errorf("correct(%q) = %v, want %v", w, !ok, ok)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	d := testDict(t)
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"quikc", []string{"quick"}},
+		{"fxo", []string{"fox"}},
+		{"Teh", []string{"The"}},
+		{"rea", []string{"read"}},
+		{"reds", []string{"reads"}},
+		{"fox", nil},
+		{"zzzz", nil},
+	}
+	for _, tt := range tests {
+		if got := d.suggest(tt.word); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("suggest(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestWords(t *testing.T) {
+	text := func(ws []word) []string {
+		var out []string
+		for _, w := range ws {
+			out = append(out, w.text)
+		}
+		return out
+	}
+
+	plain := "Thé quikc fox_1 read x.go and ReadAll, don't stop.\nSee http://acme.org/x or a/b.\n"
+	want := []string{"Thé", "quikc", "read", "and", "don't", "stop", "See", "or"}
+	ws := words([]byte(plain), false)
+	if got := text(ws); !reflect.DeepEqual(got, want) {
+		t.Errorf("words(plain) = %q, want %q", got, want)
+	}
+	if w := ws[1]; w.q0 != 4 || w.q1 != 9 {
+		t.Errorf("quikc at #%d,#%d, want #4,#9", w.q0, w.q1)
+	}
+
+	src := `// Package x reeds filles.
+package x
+
+import (
+	"fmt"
+	stringz "strings"
+)
+
+import "os/exec"
+
+var greting = "helo, %s\n"
+
+/* Tabble of wrods. */
+var x = 'c' + ` + "`raw strng`" + `
+`
+	want = []string{"Package", "reeds", "filles", "helo", "Tabble", "of", "wrods", "raw", "strng"}
+	ws = words([]byte(src), true)
+	if got := text(ws); !reflect.DeepEqual(got, want) {
+		t.Errorf("words(Go) = %q, want %q", got, want)
+	}
+	for _, w := range ws {
+		if got := string([]rune(src)[w.q0:w.q1]); got != w.text {
+			t.Errorf("word %q at #%d,#%d holds %q", w.text, w.q0, w.q1, got)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Tree shows a directory as an expandable tree in an acme window.
+//
+// Usage:
+//
+//	Tree [-g glob]... [dir]
+//
+// Tree opens a window named dir/+tree (by default, the current directory)
+// listing the directory's entries, with subdirectories' names ending in a slash.
+// Executing (button 2) a subdirectory's line expands it to show its
+// entries, indented, or collapses it again.
+// Looking (button 3) at a line sends the file or directory to the plumber,
+// so that acme opens it.
+//
+// The -g flag shows only the files whose names match the glob pattern,
+// which uses the syntax of path.Match; it may be repeated to show
+// the files matching any of several patterns. Directories are always shown.
+// Executing Filter with arguments replaces the patterns;
+// executing Filter alone shows all files again.
+//
+// The tree is redisplayed, keeping the expanded directories expanded,
+// when a file in it is written with Put, and on Get.
+package main // import "9fans.net/go/acme/Tree"
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"9fans.net/go/acme"
+	"9fans.net/go/plan9"
+	"9fans.net/go/plumb"
+)
+
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, " ") }
+func (l *listFlag) Set(s string) error { *l = append(*l, s); return nil }
+
+var globs listFlag
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("Tree: ")
+	flag.Var(&globs, "g", "show only files matching `glob`")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: Tree [-g glob]... [dir]\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	flag.Parse()
+	dir := "."
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		dir = flag.Arg(0)
+	default:
+		flag.Usage()
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if info, err := os.Stat(dir); err != nil {
+		log.Fatal(err)
+	} else if !info.IsDir() {
+		log.Fatalf("%s is not a directory", dir)
+	}
+
+	w, err := acme.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	w.Name("%s/+tree", strings.TrimSuffix(dir, "/"))
+	w.AddTag("Get", "Filter")
+	w.SetErrorPrefix(dir + "/")
+
+	t := newTree(dir, globs)
+	redraw(w, t)
+
+	puts := make(chan bool, 1)
+	go watch(t, puts)
+
+	events := w.EventChan()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok || e.C2 == 0 {
+				return
+			}
+			handle(w, t, e)
+		case <-puts:
+			redraw(w, t)
+		}
+	}
+}
+
+// watch sends to puts each time acme writes a file in the tree.
+func watch(t *tree, puts chan<- bool) {
+	r, err := acme.Log()
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	for {
+		ev, err := r.Read()
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		if ev.Op == "put" && t.contains(ev.Name) {
+			select {
+			case puts <- true:
+			default:
+			}
+		}
+	}
+}
+
+func redraw(w *acme.Win, t *tree) {
+	if err := w.ReplaceBody(t.render()); err != nil {
+		w.Err(err.Error())
+	}
+	w.Clean()
+}
+
+func handle(w *acme.Win, t *tree, e *acme.Event) {
+	switch e.C2 {
+	case 'x': // execute in tag
+		cmd := strings.TrimSpace(string(e.Text))
+		if len(e.Arg) > 0 {
+			cmd += " " + string(e.Arg)
+		}
+		switch f := strings.Fields(cmd); {
+		case len(f) > 0 && f[0] == "Get":
+			redraw(w, t)
+		case len(f) > 0 && f[0] == "Filter":
+			t.globs = f[1:]
+			redraw(w, t)
+		default:
+			w.WriteEvent(e)
+		}
+	case 'X': // execute in body
+		i := t.lineAt(e.Q0)
+		if i < 0 {
+			w.WriteEvent(e)
+			return
+		}
+		// Executing a file name would run it; ignore that.
+		if t.toggle(i) {
+			redraw(w, t)
+		}
+	case 'L': // look in body
+		i := t.lineAt(e.Q0)
+		if i < 0 {
+			w.WriteEvent(e)
+			return
+		}
+		if err := open(t.path(i)); err != nil {
+			w.Err(err.Error())
+		}
+	case 'l':
+		w.WriteEvent(e)
+	}
+}
+
+// open sends the file name to the plumber.
+func open(name string) error {
+	fid, err := plumb.Open("send", plan9.OWRITE)
+	if err != nil {
+		return err
+	}
+	defer fid.Close()
+	m := &plumb.Message{
+		Src:  "Tree",
+		Dir:  filepath.Dir(name),
+		Type: "text",
+		Data: []byte(name),
+	}
+	return m.Send(fid)
+}
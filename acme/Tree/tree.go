@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A tree is the state of a directory tree view.
+type tree struct {
+	root     string          // absolute path of the root directory
+	expanded map[string]bool // expanded directories, by path relative to root
+	globs    []string        // show only files matching one of these, if any
+
+	lines []line // the lines of the last rendering
+	offs  []int  // rune offset of the start of each line, and of the end
+}
+
+// A line is a single line in the rendered tree.
+type line struct {
+	rel string // path relative to root; "." for the root
+	dir bool
+}
+
+func newTree(root string, globs []string) *tree {
+	return &tree{
+		root:     root,
+		expanded: map[string]bool{".": true},
+		globs:    globs,
+	}
+}
+
+// match reports whether the file name passes the glob filter.
+func (t *tree) match(name string) bool {
+	if len(t.globs) == 0 {
+		return true
+	}
+	for _, g := range t.globs {
+		if ok, _ := path.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the text of the tree: the root directory,
+// followed by the entries of each expanded directory,
+// indented one tab per level, with directory names ending in a slash.
+// Files not matching the glob filter are omitted,
+// but all directories are shown so they can be expanded.
+func (t *tree) render() []byte {
+	var buf bytes.Buffer
+	t.lines = t.lines[:0]
+	t.offs = append(t.offs[:0], 0)
+	add := func(depth int, text string, l line) {
+		buf.WriteString(strings.Repeat("\t", depth))
+		buf.WriteString(text)
+		buf.WriteString("\n")
+		t.lines = append(t.lines, l)
+		t.offs = append(t.offs, t.offs[len(t.offs)-1]+depth+len([]rune(text))+1)
+	}
+
+	var walk func(rel string, depth int)
+	walk = func(rel string, depth int) {
+		infos, err := ioutil.ReadDir(filepath.Join(t.root, filepath.FromSlash(rel)))
+		if err != nil {
+			add(depth, "# "+err.Error(), line{rel: rel})
+			return
+		}
+		for _, info := range infos {
+			crel := path.Join(rel, info.Name())
+			if info.IsDir() {
+				add(depth, info.Name()+"/", line{rel: crel, dir: true})
+				if t.expanded[crel] {
+					walk(crel, depth+1)
+				}
+				continue
+			}
+			if t.match(info.Name()) {
+				add(depth, info.Name(), line{rel: crel})
+			}
+		}
+	}
+	add(0, strings.TrimSuffix(t.root, "/")+"/", line{rel: ".", dir: true})
+	walk(".", 1)
+	return buf.Bytes()
+}
+
+// lineAt returns the index of the line holding the rune offset q
+// in the last rendering, or -1 if there is none.
+func (t *tree) lineAt(q int) int {
+	for i := 0; i+1 < len(t.offs); i++ {
+		if t.offs[i] <= q && q < t.offs[i+1] {
+			return i
+		}
+	}
+	return -1
+}
+
+// toggle expands or collapses the directory on line i,
+// reporting whether line i is a directory below the root.
+// Collapsing a directory keeps the expansion of its subdirectories,
+// so that they reappear when it is expanded again.
+func (t *tree) toggle(i int) bool {
+	if i < 0 || i >= len(t.lines) {
+		return false
+	}
+	l := t.lines[i]
+	if !l.dir || l.rel == "." {
+		return false
+	}
+	if t.expanded[l.rel] {
+		delete(t.expanded, l.rel)
+	} else {
+		t.expanded[l.rel] = true
+	}
+	return true
+}
+
+// path returns the absolute path of the file on line i.
+func (t *tree) path(i int) string {
+	return filepath.Join(t.root, filepath.FromSlash(t.lines[i].rel))
+}
+
+// contains reports whether the absolute path name is within the tree.
+func (t *tree) contains(name string) bool {
+	return name == t.root || strings.HasPrefix(name, strings.TrimSuffix(t.root, "/")+"/")
+}
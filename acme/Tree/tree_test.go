@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.go", "b.txt", "sub/c.go", "sub/deep/d.go", "sub/e.txt"} {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(name), 0777)
+		if err := ioutil.WriteFile(name, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tr := newTree(dir, nil)
+	check := func(want string) {
+		t.Helper()
+		if got := string(tr.render()); got != dir+"/\n"+want {
+			t.Errorf("render:\n%s\nwant:\n%s/\n%s", got, dir, want)
+		}
+	}
+	check("\ta.go\n\tb.txt\n\tsub/\n")
+
+	// Expand sub, on line 3.
+	if tr.lineAt(tr.offs[3]+2) != 3 || !tr.toggle(3) {
+		t.Fatalf("toggle(3) failed; offs = %v", tr.offs)
+	}
+	check("\ta.go\n\tb.txt\n\tsub/\n\t\tc.go\n\t\tdeep/\n\t\te.txt\n")
+	if tr.toggle(0) || tr.toggle(1) || tr.toggle(99) {
+		t.Errorf("toggle of root, file, or missing line succeeded")
+	}
+	if p := tr.path(4); p != filepath.Join(dir, "sub", "c.go") {
+		t.Errorf("path(4) = %s", p)
+	}
+
+	// Expand sub/deep, then filter and collapse sub:
+	// sub/deep stays expanded underneath.
+	tr.toggle(5)
+	tr.globs = []string{"*.go"}
+	check("\ta.go\n\tsub/\n\t\tc.go\n\t\tdeep/\n\t\t\td.go\n")
+	tr.toggle(2)
+	check("\ta.go\n\tsub/\n")
+
+	// New files appear on refresh, with expansion state kept.
+	tr.toggle(2)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "f.go"), nil, 0666)
+	check("\ta.go\n\tsub/\n\t\tc.go\n\t\tdeep/\n\t\t\td.go\n\t\tf.go\n")
+
+	if !tr.contains(filepath.Join(dir, "sub", "f.go")) || tr.contains(dir+"x/a.go") {
+		t.Errorf("contains is wrong")
+	}
+	if tr.lineAt(-1) != -1 || tr.lineAt(tr.offs[len(tr.offs)-1]) != -1 {
+		t.Errorf("lineAt outside tree found a line")
+	}
+}
@@ -35,12 +35,16 @@ type Win struct {
 	errors     *client.Fid
 	ebuf       *bufio.Reader
 	c          chan *Event
+	cstop      chan struct{} // closed by stopEvents
 	next, prev *Win
 	buf        []byte
 	e2, e3, e4 Event
 	name       string
 
 	errorPrefix string
+
+	rec    *Recorder // records event file traffic, if non-nil
+	replay bool      // events come from a recording, not acme
 }
 
 var fsys *client.Fsys
@@ -155,6 +159,9 @@ func Open(id int, ctl *client.Fid) (*Win, error) {
 }
 
 func (w *Win) fid(name string) (*client.Fid, error) {
+	if w.replay {
+		return nil, errors.New("acme: replayed window has no " + name + " file")
+	}
 	var f **client.Fid
 	var mode uint8 = plan9.ORDWR
 	switch name {
@@ -192,7 +199,18 @@ func (w *Win) fid(name string) (*client.Fid, error) {
 // replacing single tabs with runs of tabs as needed to align columns.
 func (w *Win) PrintTabbed(text string) {
 	tab, font, _ := w.Font()
+	var width func(string) int
+	if font != nil {
+		width = font.StringWidth
+	}
+	w.Write("body", formatTabbed(text, tab, width))
+}
 
+// formatTabbed returns text with its single tabs replaced by runs of tabs
+// aligning the columns of each block of consecutive lines containing tabs,
+// given the tab stop width and a function returning the width of a string,
+// both in pixels. If width is nil or tab is 0, the tabs are left as they are.
+func formatTabbed(text string, tab int, width func(string) int) []byte {
 	lines := strings.SplitAfter(text, "\n")
 	var allRows [][]string
 	for _, line := range lines {
@@ -223,13 +241,13 @@ func (w *Win) PrintTabbed(text string) {
 		allRows = allRows[i:]
 
 		var wid []int
-		if font != nil {
+		if width != nil {
 			for _, row := range rows {
 				for len(wid) < len(row) {
 					wid = append(wid, 0)
 				}
 				for i, col := range row {
-					n := font.StringWidth(col)
+					n := width(col)
 					if wid[i] < n {
 						wid[i] = n
 					}
@@ -243,11 +261,11 @@ func (w *Win) PrintTabbed(text string) {
 				if i == len(row)-1 {
 					break
 				}
-				if font == nil || tab == 0 {
+				if width == nil || tab == 0 {
 					buf.WriteString("\t")
 					continue
 				}
-				pos := font.StringWidth(col)
+				pos := width(col)
 				for pos <= wid[i] {
 					buf.WriteString("\t")
 					pos += tab - pos%tab
@@ -257,7 +275,7 @@ func (w *Win) PrintTabbed(text string) {
 		}
 	}
 
-	w.Write("body", buf.Bytes())
+	return buf.Bytes()
 }
 
 var fontCache struct {
@@ -267,21 +285,15 @@ var fontCache struct {
 
 // Font returns the window's current tab width (in zeros) and font.
 func (w *Win) Font() (tab int, font *draw.Font, err error) {
-	ctl := make([]byte, 1000)
-	w.Seek("ctl", 0, 0)
-	n, err := w.Read("ctl", ctl)
+	ctl, err := w.ReadCtl()
 	if err != nil {
 		return 0, nil, err
 	}
-	f := strings.Fields(string(ctl[:n]))
-	if len(f) < 8 {
-		return 0, nil, fmt.Errorf("malformed ctl file")
-	}
-	tab, _ = strconv.Atoi(f[7])
+	tab = ctl.TabWidth
 	if tab == 0 {
 		return 0, nil, fmt.Errorf("malformed ctl file")
 	}
-	name := f[6]
+	name := ctl.Font
 
 	fontCache.Lock()
 	font = fontCache.m[name]
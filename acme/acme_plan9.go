@@ -22,12 +22,16 @@ type Win struct {
 	errors     *os.File
 	ebuf       *bufio.Reader
 	c          chan *Event
+	cstop      chan struct{} // closed by stopEvents
 	next, prev *Win
 	buf        []byte
 	e2, e3, e4 Event
 	name       string
 
 	errorPrefix string
+
+	rec    *Recorder // records event file traffic, if non-nil
+	replay bool      // events come from a recording, not acme
 }
 
 func mountAcme() {
@@ -140,6 +144,9 @@ func Open(id int, ctl *os.File) (*Win, error) {
 }
 
 func (w *Win) fid(name string) (*os.File, error) {
+	if w.replay {
+		return nil, errors.New("acme: replayed window has no " + name + " file")
+	}
 	var f **os.File
 	var mode int = os.O_RDWR
 	switch name {
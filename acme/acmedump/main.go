@@ -0,0 +1,115 @@
+// Acmedump lists, filters, and rewrites acme dump files.
+//
+// Usage:
+//
+//	acmedump [-f file] [-w] [-d pattern]... [-r old=new]...
+//
+// Acmedump reads the dump file (default $HOME/acme.dump) written by
+// acme's Dump command. With no -d or -r flags, it lists the dumped
+// windows, one per line, giving the column, window ID, kind, and name.
+//
+// The -d flag drops the windows whose names match the pattern,
+// which uses the syntax of path.Match and may also match
+// only the final element of the name.
+// The -r flag replaces the directory prefix old with new
+// in window names and directories, as after moving a project.
+// The edited dump is written to standard output, or,
+// with -w, back to the dump file.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"9fans.net/go/acme/dump"
+)
+
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, " ") }
+func (l *listFlag) Set(s string) error { *l = append(*l, s); return nil }
+
+var (
+	file     = flag.String("f", "", "read dump `file` (default $HOME/acme.dump)")
+	write    = flag.Bool("w", false, "write the edited dump back to the file")
+	drops    listFlag
+	rewrites listFlag
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("acmedump: ")
+	flag.Var(&drops, "d", "drop windows matching `pattern`")
+	flag.Var(&rewrites, "r", "rewrite path prefix `old=new`")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: acmedump [-f file] [-w] [-d pattern]... [-r old=new]...\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+	}
+
+	name := *file
+	if name == "" {
+		name = filepath.Join(os.Getenv("HOME"), "acme.dump")
+	}
+	d, err := dump.ReadFile(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(drops) == 0 && len(rewrites) == 0 {
+		for _, w := range d.Windows {
+			fmt.Printf("%d\t%d\t%c\t%s\n", w.Column, w.ID, w.Kind, w.Name())
+		}
+		return
+	}
+
+	for _, pat := range drops {
+		if _, err := path.Match(pat, ""); err != nil {
+			log.Fatalf("bad pattern %q: %v", pat, err)
+		}
+	}
+	d.Filter(func(w *dump.Window) bool {
+		name := w.Name()
+		for _, pat := range drops {
+			if match(pat, name) || match(pat, path.Base(name)) {
+				return false
+			}
+		}
+		return true
+	})
+	for _, r := range rewrites {
+		i := strings.Index(r, "=")
+		if i < 0 {
+			log.Fatalf("bad rewrite %q: want old=new", r)
+		}
+		d.Rewrite(r[:i], r[i+1:])
+	}
+
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil {
+		log.Fatal(err)
+	}
+	if !*write {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0666); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func match(pat, name string) bool {
+	ok, _ := path.Match(pat, name)
+	return ok
+}
@@ -0,0 +1,222 @@
+// Acmefocus tracks the focused acme window and the window history.
+//
+// Usage:
+//
+//	acmefocus serve
+//	acmefocus [prev [n]]
+//	acmefocus focus
+//	acmefocus list
+//	acmefocus recent [dir]
+//
+// Acmefocus serve follows acme's log of focus events and answers
+// queries about them on the Unix socket acmefocus in the name space directory.
+// The other forms query a running server.
+//
+// Acmefocus prev shows the window focused n windows (by default, one) before
+// the focused one. Executed from a window's tag, it jumps back to the
+// previously focused window; executing it again, before focusing another
+// window, jumps back again from the window shown.
+// Acmefocus with no arguments is shorthand for acmefocus prev.
+//
+// Acmefocus focus prints the ID and name of the focused window,
+// and acmefocus list prints those of the open windows,
+// most recently focused first.
+// Acmefocus recent prints the names of the files in dir
+// (by default, the current directory) most recently focused,
+// whether or not their windows are still open.
+package main // import "9fans.net/go/acme/acmefocus"
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"9fans.net/go/acme"
+	"9fans.net/go/plan9/client"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: acmefocus serve\n")
+	fmt.Fprintf(os.Stderr, "       acmefocus [prev [n] | focus | list | recent [dir]]\n")
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("acmefocus: ")
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"prev"}
+	}
+
+	socket := filepath.Join(client.Namespace(), "acmefocus")
+	switch args[0] {
+	case "serve":
+		if len(args) != 1 {
+			usage()
+		}
+		serve(socket)
+	case "prev":
+		n := 1
+		if len(args) > 2 {
+			usage()
+		}
+		if len(args) == 2 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				usage()
+			}
+		}
+		lines := query(socket, fmt.Sprintf("prev %d", n))
+		if len(lines) == 0 {
+			log.Fatal("no previous window")
+		}
+		id, err := strconv.Atoi(strings.Fields(lines[0])[0])
+		if err != nil {
+			log.Fatalf("bad reply %q", lines[0])
+		}
+		w, err := acme.Open(id, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := w.Show(); err != nil {
+			log.Fatal(err)
+		}
+		w.CloseFiles()
+	case "focus", "list":
+		if len(args) != 1 {
+			usage()
+		}
+		for _, line := range query(socket, args[0]) {
+			fmt.Println(line)
+		}
+	case "recent":
+		dir := "."
+		switch len(args) {
+		case 1:
+		case 2:
+			dir = args[1]
+		default:
+			usage()
+		}
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, line := range query(socket, "recent "+dir) {
+			fmt.Println(line)
+		}
+	default:
+		usage()
+	}
+}
+
+// serve runs the tracker, answering queries on the Unix socket.
+func serve(socket string) {
+	if c, err := net.Dial("unix", socket); err == nil {
+		c.Close()
+		log.Fatalf("already running on %s", socket)
+	}
+	os.Remove(socket)
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(socket)
+
+	r, err := acme.Log()
+	if err != nil {
+		log.Fatal(err)
+	}
+	t := acme.NewTracker(0)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				log.Print(err)
+				return
+			}
+			go handle(t, c)
+		}
+	}()
+	if err := t.Run(r); err != nil && err != io.EOF {
+		log.Print(err)
+	}
+}
+
+func handle(t *acme.Tracker, c net.Conn) {
+	defer c.Close()
+	req, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil {
+		return
+	}
+	io.WriteString(c, answer(t, strings.TrimSpace(req)))
+}
+
+// answer returns the reply to the query req:
+// lines of text, or a single line beginning "error: ".
+func answer(t *acme.Tracker, req string) string {
+	var b strings.Builder
+	verb, arg := req, ""
+	if i := strings.Index(req, " "); i >= 0 {
+		verb, arg = req[:i], req[i+1:]
+	}
+	switch verb {
+	case "prev":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return "error: bad prev count\n"
+		}
+		if w, ok := t.Jump(n); ok {
+			fmt.Fprintf(&b, "%d\t%s\n", w.ID, w.Name)
+		}
+	case "focus":
+		if w, ok := t.Focused(); ok {
+			fmt.Fprintf(&b, "%d\t%s\n", w.ID, w.Name)
+		}
+	case "list":
+		for _, w := range t.Windows() {
+			fmt.Fprintf(&b, "%d\t%s\n", w.ID, w.Name)
+		}
+	case "recent":
+		for _, name := range t.Recent(arg) {
+			fmt.Fprintf(&b, "%s\n", name)
+		}
+	default:
+		return "error: unknown query " + strconv.Quote(req) + "\n"
+	}
+	return b.String()
+}
+
+// query sends req to the server and returns the lines of its reply.
+func query(socket, req string) []string {
+	c, err := net.Dial("unix", socket)
+	if err != nil {
+		log.Fatalf("%v (is acmefocus serve running?)", err)
+	}
+	defer c.Close()
+	if _, err := io.WriteString(c, req+"\n"); err != nil {
+		log.Fatal(err)
+	}
+	var lines []string
+	s := bufio.NewScanner(c)
+	for s.Scan() {
+		if msg := s.Text(); strings.HasPrefix(msg, "error: ") {
+			log.Fatal(strings.TrimPrefix(msg, "error: "))
+		}
+		lines = append(lines, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		log.Fatal(err)
+	}
+	return lines
+}
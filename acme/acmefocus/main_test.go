@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"9fans.net/go/acme"
+)
+
+func TestAnswer(t *testing.T) {
+	tr := acme.NewTracker(0)
+	tr.Update(acme.LogEvent{ID: 1, Op: "focus", Name: "/a/x.go"})
+	tr.Update(acme.LogEvent{ID: 2, Op: "focus", Name: "/a/y.go"})
+	tr.Update(acme.LogEvent{ID: 3, Op: "focus", Name: "/b/"})
+
+	tests := []struct {
+		req, reply string
+	}{
+		{"focus", "3\t/b/\n"},
+		{"prev 1", "2\t/a/y.go\n"},
+		{"prev 1", "1\t/a/x.go\n"}, // jumps back again from the window shown
+		{"prev 1", ""},
+		{"focus", "3\t/b/\n"},
+		{"prev x", "error: bad prev count\n"},
+		{"list", "3\t/b/\n2\t/a/y.go\n1\t/a/x.go\n"},
+		{"recent /a", "/a/y.go\n/a/x.go\n"},
+		{"recent /b", ""},
+		{"jump", "error: unknown query \"jump\"\n"},
+	}
+	for _, tt := range tests {
+		if reply := answer(tr, tt.req); reply != tt.reply {
+			t.Errorf("answer(%q) = %q, want %q", tt.req, reply, tt.reply)
+		}
+	}
+}
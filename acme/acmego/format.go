@@ -0,0 +1,173 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A formatter formats the contents of a file.
+type formatter interface {
+	// Format returns the formatted form of src, the contents of the named file.
+	// Errors are reported using the file's name, as in "x.go:12:3: message".
+	Format(name string, src []byte) ([]byte, error)
+}
+
+// goFormatter formats Go files using goimports, if it is installed,
+// or else using go/format.
+type goFormatter struct{}
+
+func (goFormatter) Format(name string, src []byte) ([]byte, error) {
+	if _, err := exec.LookPath("goimports"); err != nil {
+		out, err := format.Source(src)
+		if err != nil {
+			return nil, fmt.Errorf("%s", fixAddrs(name, err.Error()))
+		}
+		return out, nil
+	}
+	cmd := exec.Command("goimports", "-srcdir", name)
+	return run(cmd, name, src)
+}
+
+// A cmdFormatter formats files by running a command that reads
+// the file on standard input and writes the formatted file on standard output.
+// Arguments of the form $file are replaced by the file name.
+type cmdFormatter struct {
+	args []string
+}
+
+func (f *cmdFormatter) Format(name string, src []byte) ([]byte, error) {
+	args := make([]string, len(f.args))
+	for i, a := range f.args {
+		args[i] = strings.Replace(a, "$file", name, -1)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = filepath.Dir(name)
+	return run(cmd, name, src)
+}
+
+// run runs cmd with src on standard input, returning its standard output.
+func run(cmd *exec.Cmd, name string, src []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(src)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = fmt.Sprintf("%s: %v", filepath.Base(cmd.Path), err)
+		}
+		return nil, fmt.Errorf("%s", fixAddrs(name, msg))
+	}
+	return stdout.Bytes(), nil
+}
+
+// stdinRE matches the names formatters use for standard input
+// at the start of an error line.
+var stdinRE = regexp.MustCompile(`^(?:<standard input>|<stdin>|stdin|-):(\d)`)
+
+// lineRE matches an error line beginning with a bare line number.
+var lineRE = regexp.MustCompile(`^\d+(?::\d+)?: `)
+
+// fixAddrs rewrites the error lines in msg to begin with name,
+// so that they are file:line addresses that acme can open.
+func fixAddrs(name, msg string) string {
+	lines := strings.Split(msg, "\n")
+	for i, line := range lines {
+		if m := stdinRE.FindStringSubmatchIndex(line); m != nil {
+			// Not ReplaceAllString, which would expand any $ in name.
+			lines[i] = name + ":" + line[m[2]:]
+			continue
+		}
+		if lineRE.MatchString(line) {
+			lines[i] = name + ":" + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// A registry maps file name suffixes to formatters.
+type registry map[string]formatter
+
+// defaultRegistry returns the registry used when there is no configuration file.
+func defaultRegistry() registry {
+	return registry{".go": goFormatter{}}
+}
+
+// lookup returns the formatter for the named file,
+// using the longest matching suffix, or nil if there is none.
+func (r registry) lookup(name string) formatter {
+	best := ""
+	for suffix := range r {
+		if strings.HasSuffix(name, suffix) && len(suffix) > len(best) {
+			best = suffix
+		}
+	}
+	if best == "" {
+		return nil
+	}
+	return r[best]
+}
+
+// readConfig reads a configuration file into r.
+// Each line of the file gives a file name suffix followed by
+// the command that formats files with that suffix:
+//
+//	# suffix  command
+//	.rs       rustfmt --emit=stdout
+//	.c        clang-format --assume-filename=$file
+//	.sh       shfmt
+//
+// The command "go" names the built-in Go formatter,
+// and the command "none" disables formatting.
+// Blank lines and lines beginning with # are ignored.
+func (r registry) readConfig(file string, rd io.Reader) error {
+	s := bufio.NewScanner(rd)
+	for n := 1; s.Scan(); n++ {
+		f := strings.Fields(s.Text())
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		if len(f) < 2 {
+			return fmt.Errorf("%s:%d: missing command for %s", file, n, f[0])
+		}
+		switch {
+		case len(f) == 2 && f[1] == "go":
+			r[f[0]] = goFormatter{}
+		case len(f) == 2 && f[1] == "none":
+			delete(r, f[0])
+		default:
+			r[f[0]] = &cmdFormatter{args: f[1:]}
+		}
+	}
+	return s.Err()
+}
+
+// loadConfig returns the registry configured by the named file,
+// which need not exist.
+func loadConfig(file string) (registry, error) {
+	r := defaultRegistry()
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	if err := r.readConfig(file, f); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
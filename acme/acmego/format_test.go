@@ -0,0 +1,90 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestFixAddrs(t *testing.T) {
+	tests := []struct{ in, out string }{
+		{"<standard input>:3:1: expected 'package'", "/a/x.go:3:1: expected 'package'"},
+		{"12:5: missing ','\n13:1: expected '}'", "/a/x.go:12:5: missing ','\n/a/x.go:13:1: expected '}'"},
+		{"-:7: syntax error", "/a/x.go:7: syntax error"},
+		{"error: cannot format", "error: cannot format"},
+	}
+	for _, tt := range tests {
+		if got := fixAddrs("/a/x.go", tt.in); got != tt.out {
+			t.Errorf("fixAddrs(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+	// A $ in the file name is kept as is.
+	if got, want := fixAddrs("/a/$1/x$y.go", "<stdin>:3:1: bad\n4: worse"), "/a/$1/x$y.go:3:1: bad\n/a/$1/x$y.go:4: worse"; got != want {
+		t.Errorf("fixAddrs with $ in name = %q, want %q", got, want)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := defaultRegistry()
+	config := `
+# formatters
+.rs	rustfmt --emit=stdout
+.c	clang-format --assume-filename=$file
+.pb.go	none
+.tmpl.go	go
+`
+	if err := r.readConfig("config", strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := r.lookup("/a/x.rs").(*cmdFormatter); !ok || strings.Join(f.args, " ") != "rustfmt --emit=stdout" {
+		t.Errorf("lookup(x.rs) = %#v", r.lookup("/a/x.rs"))
+	}
+	if _, ok := r.lookup("/a/x.go").(goFormatter); !ok {
+		t.Errorf("lookup(x.go) = %#v", r.lookup("/a/x.go"))
+	}
+	if f := r.lookup("/a/x.txt"); f != nil {
+		t.Errorf("lookup(x.txt) = %#v, want nil", f)
+	}
+
+	err := r.readConfig("config", strings.NewReader("\n.sh\n"))
+	if err == nil || err.Error() != "config:2: missing command for .sh" {
+		t.Errorf("readConfig with missing command: %v", err)
+	}
+}
+
+func TestGoFormatterFallback(t *testing.T) {
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", "")
+	defer os.Setenv("PATH", path)
+
+	out, err := goFormatter{}.Format("/a/x.go", []byte("package x\nfunc  f( ) {}\n"))
+	if err != nil || string(out) != "package x\n\nfunc f() {}\n" {
+		t.Errorf("Format = %q, %v", out, err)
+	}
+	_, err = goFormatter{}.Format("/a/x.go", []byte("package x\nfunc {\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "/a/x.go:2:") {
+		t.Errorf("Format of bad source: %v", err)
+	}
+}
+
+func TestCmdFormatter(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	f := &cmdFormatter{args: []string{"sh", "-c", `tr a-z A-Z; echo "# $0"`, "$file"}}
+	out, err := f.Format("/tmp/x.txt", []byte("hello\n"))
+	if err != nil || string(out) != "HELLO\n# /tmp/x.txt\n" {
+		t.Errorf("Format = %q, %v", out, err)
+	}
+
+	f = &cmdFormatter{args: []string{"sh", "-c", `echo "<stdin>:4: bad input" >&2; exit 1`}}
+	_, err = f.Format("/tmp/x.txt", nil)
+	if err == nil || err.Error() != "/tmp/x.txt:4: bad input" {
+		t.Errorf("Format error = %v", err)
+	}
+}
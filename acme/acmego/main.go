@@ -6,27 +6,55 @@
 // Each time a .go file is written, acmego checks whether the
 // import block needs adjustment. If so, it makes the changes
 // in the window body but does not write the file.
+// Acmego uses goimports if it is installed, or else formats
+// the file with go/format.
+//
+// Other files can be formatted by listing formatter commands in
+// a configuration file (default $HOME/lib/acmego), one per line:
+//
+//	# suffix  command
+//	.rs       rustfmt --emit=stdout
+//	.c        clang-format --assume-filename=$file
+//	.sh       shfmt
+//
+// A command reads the file on standard input and writes the
+// formatted file on standard output; an argument $file is replaced
+// by the file name. Acmego updates the body of such files to the
+// command's output, rewriting only the lines that changed.
+// The command "go" names the built-in Go formatter,
+// and "none" disables formatting for the suffix.
+//
+// Formatter errors are written to the +Errors window for the file's
+// directory, as file:line addresses.
 package main
 
 import (
 	"bytes"
 	"flag"
-	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
-	"strconv"
-	"strings"
+	"path/filepath"
 	"unicode/utf8"
 
 	"9fans.net/go/acme"
+	"9fans.net/go/acme/imports"
 )
 
-var gofmt = flag.Bool("f", false, "run gofmt on the entire file after Put")
+var (
+	gofmt  = flag.Bool("f", false, "run gofmt on the entire file after Put")
+	config = flag.String("config", filepath.Join(os.Getenv("HOME"), "lib", "acmego"), "read formatters from `file`")
+)
+
+var formatters registry
 
 func main() {
 	flag.Parse()
+	var err error
+	formatters, err = loadConfig(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
 	l, err := acme.Log()
 	if err != nil {
 		log.Fatal(err)
@@ -37,13 +65,15 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
-		if event.Name != "" && event.Op == "put" && strings.HasSuffix(event.Name, ".go") {
-			reformat(event.ID, event.Name)
+		if event.Name != "" && event.Op == "put" {
+			if f := formatters.lookup(event.Name); f != nil {
+				reformat(event.ID, event.Name, f)
+			}
 		}
 	}
 }
 
-func reformat(id int, name string) {
+func reformat(id int, name string, f formatter) {
 	w, err := acme.Open(id, nil)
 	if err != nil {
 		log.Print(err)
@@ -56,13 +86,9 @@ func reformat(id int, name string) {
 		//log.Print(err)
 		return
 	}
-	new, err := exec.Command("goimports", name).CombinedOutput()
+	new, err := f.Format(name, old)
 	if err != nil {
-		if strings.Contains(string(new), "fatal error") {
-			fmt.Fprintf(os.Stderr, "goimports %s: %v\n%s", name, err, new)
-		} else {
-			fmt.Fprintf(os.Stderr, "%s", new)
-		}
+		acme.Err(name, err.Error())
 		return
 	}
 
@@ -70,13 +96,13 @@ func reformat(id int, name string) {
 		return
 	}
 
-	if !*gofmt {
-		oldTop, err := readImports(bytes.NewReader(old), true)
+	if _, ok := f.(goFormatter); ok && !*gofmt {
+		oldTop, err := imports.ReadImports(bytes.NewReader(old), true)
 		if err != nil {
 			//log.Print(err)
 			return
 		}
-		newTop, err := readImports(bytes.NewReader(new), true)
+		newTop, err := imports.ReadImports(bytes.NewReader(new), true)
 		if err != nil {
 			//log.Print(err)
 			return
@@ -89,21 +115,6 @@ func reformat(id int, name string) {
 		return
 	}
 
-	f, err := ioutil.TempFile("", "acmego")
-	if err != nil {
-		log.Print(err)
-		return
-	}
-	if _, err := f.Write(new); err != nil {
-		log.Print(err)
-		return
-	}
-	tmp := f.Name()
-	f.Close()
-	defer os.Remove(tmp)
-
-	diff, _ := exec.Command("9", "diff", name, tmp).CombinedOutput()
-
 	latest, err := w.ReadAll("body")
 	if err != nil {
 		log.Print(err)
@@ -114,91 +125,7 @@ func reformat(id int, name string) {
 		return
 	}
 
-	w.Write("ctl", []byte("mark"))
-	w.Write("ctl", []byte("nomark"))
-	diffLines := strings.Split(string(diff), "\n")
-	for i := len(diffLines) - 1; i >= 0; i-- {
-		line := diffLines[i]
-		if line == "" {
-			continue
-		}
-		if line[0] == '<' || line[0] == '-' || line[0] == '>' {
-			continue
-		}
-		j := 0
-		for j < len(line) && line[j] != 'a' && line[j] != 'c' && line[j] != 'd' {
-			j++
-		}
-		if j >= len(line) {
-			log.Printf("cannot parse diff line: %q", line)
-			break
-		}
-		oldStart, oldEnd := parseSpan(line[:j])
-		newStart, newEnd := parseSpan(line[j+1:])
-		if oldStart == 0 || newStart == 0 {
-			continue
-		}
-		switch line[j] {
-		case 'a':
-			err := w.Addr("%d+#0", oldStart)
-			if err != nil {
-				log.Print(err)
-				break
-			}
-			w.Write("data", findLines(new, newStart, newEnd))
-		case 'c':
-			err := w.Addr("%d,%d", oldStart, oldEnd)
-			if err != nil {
-				log.Print(err)
-				break
-			}
-			w.Write("data", findLines(new, newStart, newEnd))
-		case 'd':
-			err := w.Addr("%d,%d", oldStart, oldEnd)
-			if err != nil {
-				log.Print(err)
-				break
-			}
-			w.Write("data", nil)
-		}
-	}
-}
-
-func parseSpan(text string) (start, end int) {
-	i := strings.Index(text, ",")
-	if i < 0 {
-		n, err := strconv.Atoi(text)
-		if err != nil {
-			log.Printf("cannot parse span %q", text)
-			return 0, 0
-		}
-		return n, n
-	}
-	start, err1 := strconv.Atoi(text[:i])
-	end, err2 := strconv.Atoi(text[i+1:])
-	if err1 != nil || err2 != nil {
-		log.Printf("cannot parse span %q", text)
-		return 0, 0
-	}
-	return start, end
-}
-
-func findLines(text []byte, start, end int) []byte {
-	i := 0
-
-	start--
-	for ; i < len(text) && start > 0; i++ {
-		if text[i] == '\n' {
-			start--
-			end--
-		}
-	}
-	startByte := i
-	for ; i < len(text) && end > 0; i++ {
-		if text[i] == '\n' {
-			end--
-		}
+	if err := w.ReplaceBody(new); err != nil {
+		log.Print(err)
 	}
-	endByte := i
-	return text[startByte:endByte]
 }
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// A client is a connection to a language server.
+type client struct {
+	conn *conn
+
+	// docMu guards docs. It is held while sending the notification
+	// for a change to docs, so that the server sees the changes
+	// in the order they were made: didOpen before didChange,
+	// and versions in increasing order.
+	// It is separate from mu, which the connection's read loop needs
+	// to record diagnostics, so that a blocked send cannot stall the reads.
+	docMu sync.Mutex
+	docs  map[string]*document // open documents, by URI
+
+	mu    sync.Mutex
+	diags map[string][]Diagnostic // latest diagnostics, by URI
+
+	// onDiagnostics, if non-nil, is called with each
+	// set of diagnostics published by the server.
+	onDiagnostics func(uri string, diags []Diagnostic)
+
+	// onMessage, if non-nil, is called with messages
+	// the server asks to show or log.
+	onMessage func(msg string)
+}
+
+// A document is a file open in the server.
+type document struct {
+	version int
+	text    string
+}
+
+// newClient returns a client for the server reading from r and writing to w.
+func newClient(r io.Reader, w io.Writer) *client {
+	c := &client{
+		docs:  make(map[string]*document),
+		diags: make(map[string][]Diagnostic),
+	}
+	c.conn = newConn(r, w, c.handle)
+	return c
+}
+
+func (c *client) handle(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "textDocument/publishDiagnostics":
+		var p PublishDiagnosticsParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if len(p.Diagnostics) == 0 {
+			delete(c.diags, p.URI)
+		} else {
+			c.diags[p.URI] = p.Diagnostics
+		}
+		c.mu.Unlock()
+		if c.onDiagnostics != nil {
+			c.onDiagnostics(p.URI, p.Diagnostics)
+		}
+		return nil, nil
+	case "window/showMessage", "window/logMessage":
+		var p struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(params, &p) == nil && c.onMessage != nil {
+			c.onMessage(p.Message)
+		}
+		return nil, nil
+	case "workspace/configuration":
+		var p struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(params, &p)
+		return make([]interface{}, len(p.Items)), nil
+	case "window/workDoneProgress/create", "client/registerCapability", "client/unregisterCapability":
+		return nil, nil
+	}
+	return nil, &rpcError{Code: errMethodNotFound, Message: "method not supported: " + method}
+}
+
+// initialize performs the initialization handshake for the workspace rooted at dir.
+func (c *client) initialize(ctx context.Context, dir string) error {
+	params := map[string]interface{}{
+		"processId": nil,
+		"rootUri":   fileURI(dir),
+		"workspaceFolders": []map[string]string{
+			{"uri": fileURI(dir), "name": filepath.Base(dir)},
+		},
+		"capabilities": map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"hover": map[string]interface{}{
+					"contentFormat": []string{"plaintext"},
+				},
+				"publishDiagnostics": map[string]interface{}{},
+			},
+			"workspace": map[string]interface{}{
+				"workspaceEdit": map[string]interface{}{"documentChanges": true},
+				"configuration": true,
+			},
+		},
+	}
+	if err := c.conn.call(ctx, "initialize", params, nil); err != nil {
+		return err
+	}
+	return c.conn.notify("initialized", struct{}{})
+}
+
+// shutdown asks the server to shut down and exit.
+func (c *client) shutdown(ctx context.Context) error {
+	if err := c.conn.call(ctx, "shutdown", nil, nil); err != nil {
+		return err
+	}
+	return c.conn.notify("exit", nil)
+}
+
+// sync tells the server the current text of the named file,
+// opening the document if necessary.
+// It sends nothing if the server already has that text.
+func (c *client) sync(name, lang, text string) error {
+	uri := fileURI(name)
+	c.docMu.Lock()
+	defer c.docMu.Unlock()
+	d := c.docs[uri]
+	if d != nil && d.text == text {
+		return nil
+	}
+	if d == nil {
+		d = &document{version: 1, text: text}
+		c.docs[uri] = d
+		return c.conn.notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": TextDocumentItem{URI: uri, LanguageID: lang, Version: d.version, Text: text},
+		})
+	}
+	d.version++
+	d.text = text
+	return c.conn.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   VersionedTextDocumentIdentifier{URI: uri, Version: d.version},
+		"contentChanges": []map[string]string{{"text": text}},
+	})
+}
+
+// save tells the server the named file was written.
+func (c *client) save(name string) error {
+	return c.conn.notify("textDocument/didSave", map[string]interface{}{
+		"textDocument": TextDocumentIdentifier{URI: fileURI(name)},
+	})
+}
+
+// close tells the server the named file is no longer open.
+func (c *client) close(name string) error {
+	uri := fileURI(name)
+	c.docMu.Lock()
+	defer c.docMu.Unlock()
+	d := c.docs[uri]
+	delete(c.docs, uri)
+	if d == nil {
+		return nil
+	}
+	return c.conn.notify("textDocument/didClose", map[string]interface{}{
+		"textDocument": TextDocumentIdentifier{URI: uri},
+	})
+}
+
+func positionParams(name string, pos Position) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: fileURI(name)},
+		Position:     pos,
+	}
+}
+
+// definition returns the locations defining the identifier at pos.
+func (c *client) definition(ctx context.Context, name string, pos Position) ([]Location, error) {
+	var raw json.RawMessage
+	if err := c.conn.call(ctx, "textDocument/definition", positionParams(name, pos), &raw); err != nil {
+		return nil, err
+	}
+	return locations(raw)
+}
+
+// locations decodes a result that may be null, a Location, or a list of Locations.
+func locations(raw json.RawMessage) ([]Location, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '[' {
+		var locs []Location
+		err := json.Unmarshal(raw, &locs)
+		return locs, err
+	}
+	var loc Location
+	if err := json.Unmarshal(raw, &loc); err != nil {
+		return nil, err
+	}
+	return []Location{loc}, nil
+}
+
+// hover returns the hover text for the identifier at pos.
+func (c *client) hover(ctx context.Context, name string, pos Position) (string, error) {
+	var result *struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if err := c.conn.call(ctx, "textDocument/hover", positionParams(name, pos), &result); err != nil {
+		return "", err
+	}
+	if result == nil {
+		return "", nil
+	}
+	return hoverText(result.Contents), nil
+}
+
+// references returns the references to the identifier at pos,
+// including its declaration.
+func (c *client) references(ctx context.Context, name string, pos Position) ([]Location, error) {
+	params := struct {
+		TextDocumentPositionParams
+		Context struct {
+			IncludeDeclaration bool `json:"includeDeclaration"`
+		} `json:"context"`
+	}{TextDocumentPositionParams: positionParams(name, pos)}
+	params.Context.IncludeDeclaration = true
+	var locs []Location
+	err := c.conn.call(ctx, "textDocument/references", params, &locs)
+	return locs, err
+}
+
+// rename returns the edits that rename the identifier at pos to newName.
+func (c *client) rename(ctx context.Context, name string, pos Position, newName string) (*WorkspaceEdit, error) {
+	params := struct {
+		TextDocumentPositionParams
+		NewName string `json:"newName"`
+	}{positionParams(name, pos), newName}
+	var edit WorkspaceEdit
+	if err := c.conn.call(ctx, "textDocument/rename", params, &edit); err != nil {
+		return nil, err
+	}
+	return &edit, nil
+}
+
+// format returns the edits that format the named file.
+func (c *client) format(ctx context.Context, name string, tabWidth int) ([]TextEdit, error) {
+	params := map[string]interface{}{
+		"textDocument": TextDocumentIdentifier{URI: fileURI(name)},
+		"options":      map[string]interface{}{"tabSize": tabWidth, "insertSpaces": false},
+	}
+	var edits []TextEdit
+	err := c.conn.call(ctx, "textDocument/formatting", params, &edits)
+	return edits, err
+}
+
+// diagnostics returns the latest diagnostics for all files, sorted by file name.
+func (c *client) diagnostics() map[string][]Diagnostic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := make(map[string][]Diagnostic)
+	for uri, d := range c.diags {
+		m[uriFile(uri)] = d
+	}
+	return m
+}
+
+// sortedNames returns the keys of m in sorted order.
+func sortedNames(m map[string][]Diagnostic) []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
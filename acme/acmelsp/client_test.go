@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A step is one exchange in a scripted language server session.
+type step struct {
+	method string // method the client must send next
+	check  func(m *message) error
+	result interface{} // result to reply with, for requests
+
+	// then is a message the server sends after the reply.
+	then interface{}
+}
+
+// fakeServer runs a scripted language server session on r and w.
+// It reports the first deviation from the script on the returned channel,
+// or nil when the script completes.
+// Responses to requests from the server are sent on replies
+// rather than matched against the script.
+func fakeServer(r io.Reader, w io.Writer, script []step, replies chan<- *message) <-chan error {
+	done := make(chan error, 1)
+	br := bufio.NewReader(r)
+	send := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	}
+	read := func() (*message, error) {
+		data, err := readMessage(br)
+		if err != nil {
+			return nil, err
+		}
+		var m message
+		return &m, json.Unmarshal(data, &m)
+	}
+	go func() {
+		defer io.Copy(ioutil.Discard, br)
+		for i, s := range script {
+			m, err := read()
+			for err == nil && m.Method == "" {
+				replies <- m
+				m, err = read()
+			}
+			if err != nil {
+				done <- fmt.Errorf("step %d (%s): %v", i, s.method, err)
+				return
+			}
+			if m.Method != s.method {
+				done <- fmt.Errorf("step %d: got method %q, want %q", i, m.Method, s.method)
+				return
+			}
+			if s.check != nil {
+				if err := s.check(m); err != nil {
+					done <- fmt.Errorf("step %d (%s): %v", i, s.method, err)
+					return
+				}
+			}
+			if m.Method != "" && m.ID != nil {
+				send(&response{JSONRPC: "2.0", ID: *m.ID, Result: s.result})
+			}
+			if s.then != nil {
+				send(s.then)
+			}
+		}
+		done <- nil
+	}()
+	return done
+}
+
+func TestClient(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	defer sw.Close()
+	defer cw.Close()
+
+	const name = "/src/x.go"
+	uri := "file:///src/x.go"
+	loc := Location{URI: uri, Range: Range{Start: Position{Line: 3, Character: 5}, End: Position{Line: 3, Character: 6}}}
+	diag := Diagnostic{Range: loc.Range, Message: "undefined: y"}
+
+	script := []step{
+		{method: "initialize", result: map[string]interface{}{"capabilities": map[string]interface{}{}},
+			then: &request{JSONRPC: "2.0", ID: 100, Method: "workspace/configuration",
+				Params: map[string]interface{}{"items": []interface{}{map[string]string{"section": "gopls"}}}}},
+		{method: "initialized"},
+		{method: "textDocument/didOpen", check: func(m *message) error {
+			var v struct{ TextDocument TextDocumentItem }
+			json.Unmarshal(m.Params, &v)
+			if v.TextDocument.URI != uri || v.TextDocument.Text != "package x\n" || v.TextDocument.Version != 1 {
+				return fmt.Errorf("bad didOpen %s", m.Params)
+			}
+			return nil
+		}, then: &notification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics",
+			Params: PublishDiagnosticsParams{URI: uri, Diagnostics: []Diagnostic{diag}}}},
+		{method: "textDocument/definition", result: loc},
+		{method: "textDocument/hover", result: map[string]interface{}{
+			"contents": map[string]string{"kind": "plaintext", "value": "func f()"}}},
+		{method: "textDocument/didChange", check: func(m *message) error {
+			var v struct {
+				TextDocument   VersionedTextDocumentIdentifier
+				ContentChanges []struct{ Text string }
+			}
+			json.Unmarshal(m.Params, &v)
+			if v.TextDocument.Version != 2 || len(v.ContentChanges) != 1 || v.ContentChanges[0].Text != "package y\n" {
+				return fmt.Errorf("bad didChange %s", m.Params)
+			}
+			return nil
+		}},
+		{method: "textDocument/references", result: []Location{loc, loc}},
+		{method: "textDocument/rename", result: map[string]interface{}{
+			"documentChanges": []TextDocumentEdit{{
+				TextDocument: VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+				Edits:        []TextEdit{{Range: loc.Range, NewText: "z"}},
+			}}}},
+		{method: "textDocument/didClose"},
+		{method: "shutdown"},
+		{method: "exit"},
+	}
+	replies := make(chan *message, 1)
+	done := fakeServer(sr, sw, script, replies)
+
+	c := newClient(cr, cw)
+	diags := make(chan []Diagnostic, 1)
+	c.onDiagnostics = func(u string, d []Diagnostic) {
+		if u == uri {
+			diags <- d
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := c.initialize(ctx, "/src"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.sync(name, "go", "package x\n"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-replies:
+		if m.ID == nil || string(*m.ID) != "100" || string(m.Result) != "[null]" {
+			t.Errorf("workspace/configuration reply = %+v", m)
+		}
+	case err := <-done:
+		t.Fatalf("server finished early: %v", err)
+	}
+	select {
+	case d := <-diags:
+		if !reflect.DeepEqual(d, []Diagnostic{diag}) {
+			t.Errorf("diagnostics = %+v", d)
+		}
+	case err := <-done:
+		t.Fatalf("server finished early: %v", err)
+	}
+	if got := formatDiagnostics(name, c.diagnostics()[name]); got != "/src/x.go:4: undefined: y\n" {
+		t.Errorf("formatDiagnostics = %q", got)
+	}
+
+	locs, err := c.definition(ctx, name, Position{})
+	if err != nil || !reflect.DeepEqual(locs, []Location{loc}) {
+		t.Errorf("definition = %+v, %v", locs, err)
+	}
+	text, err := c.hover(ctx, name, Position{})
+	if err != nil || text != "func f()" {
+		t.Errorf("hover = %q, %v", text, err)
+	}
+	if err := c.sync(name, "go", "package y\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.sync(name, "go", "package y\n"); err != nil { // unchanged: sends nothing
+		t.Fatal(err)
+	}
+	locs, err = c.references(ctx, name, Position{})
+	if err != nil || len(locs) != 2 {
+		t.Errorf("references = %+v, %v", locs, err)
+	}
+	edit, err := c.rename(ctx, name, Position{}, "z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fe := edit.fileEdits(); len(fe[uri]) != 1 || fe[uri][0].NewText != "z" {
+		t.Errorf("rename edits = %+v", fe)
+	}
+	if err := c.close(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncOrder(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	sr, cw := io.Pipe()
+	c := newClient(r, cw)
+
+	// Concurrent syncs must reach the server in order:
+	// didOpen first, then each version once, increasing.
+	const n = 20
+	go func() {
+		for i := 0; i < n; i++ {
+			go c.sync("/src/x.go", "go", fmt.Sprintf("package x%d\n", i))
+		}
+	}()
+	br := bufio.NewReader(sr)
+	for i := 0; i < n; i++ {
+		data, err := readMessage(br)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m struct {
+			Method string
+			Params struct{ TextDocument struct{ Version int } }
+		}
+		json.Unmarshal(data, &m)
+		want := "textDocument/didChange"
+		if i == 0 {
+			want = "textDocument/didOpen"
+		}
+		if m.Method != want || m.Params.TextDocument.Version != i+1 {
+			t.Fatalf("message %d = %s version %d, want %s version %d", i, m.Method, m.Params.TextDocument.Version, want, i+1)
+		}
+	}
+}
+
+func TestServerRequest(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	c := newClient(r, ioutil.Discard)
+	if _, err := c.handle("no/such/method", nil); err == nil {
+		t.Errorf("unknown method succeeded")
+	}
+	v, err := c.handle("workspace/configuration", json.RawMessage(`{"items":[{},{}]}`))
+	if err != nil || len(v.([]interface{})) != 2 {
+		t.Errorf("workspace/configuration = %v, %v", v, err)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	text := []byte("ab\nc𝔸d\n\ne")
+	tests := []struct {
+		q   int
+		pos Position
+	}{
+		{0, Position{0, 0}},
+		{2, Position{0, 2}},
+		{3, Position{1, 0}},
+		{5, Position{1, 3}},
+		{6, Position{1, 4}},
+		{8, Position{3, 0}},
+		{9, Position{3, 1}},
+	}
+	for _, tt := range tests {
+		if got := position(text, tt.q); got != tt.pos {
+			t.Errorf("position(%d) = %v, want %v", tt.q, got, tt.pos)
+		}
+		if got := runeOffset(text, tt.pos); got != tt.q {
+			t.Errorf("runeOffset(%v) = %d, want %d", tt.pos, got, tt.q)
+		}
+	}
+	if got := runeOffset(text, Position{0, 10}); got != 2 {
+		t.Errorf("runeOffset past end of line = %d, want 2", got)
+	}
+	if got := runeOffset(text, Position{10, 0}); got != 9 {
+		t.Errorf("runeOffset past end of text = %d, want 9", got)
+	}
+
+	edits := acmeEdits(text, []TextEdit{
+		{Range: Range{Start: Position{1, 1}, End: Position{1, 3}}, NewText: "B"},
+		{Range: Range{Start: Position{0, 0}, End: Position{0, 0}}, NewText: "<"},
+	})
+	if got := string(applyEdits(text, edits)); got != "<ab\ncBd\n\ne" {
+		t.Errorf("applyEdits = %q", got)
+	}
+}
+
+func TestHoverText(t *testing.T) {
+	for _, tt := range []struct{ in, out string }{
+		{`"plain"`, "plain"},
+		{`{"kind":"markdown","value":"doc"}`, "doc"},
+		{`["a",{"language":"go","value":"func f()"}]`, "a\nfunc f()"},
+		{`null`, ""},
+	} {
+		if got := hoverText(json.RawMessage(tt.in)); got != tt.out {
+			t.Errorf("hoverText(%s) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A conn is a JSON-RPC 2.0 connection using the
+// Content-Length framing of the Language Server Protocol.
+type conn struct {
+	r *bufio.Reader
+
+	wmu sync.Mutex
+	w   io.Writer
+
+	mu      sync.Mutex
+	seq     int64
+	pending map[int64]chan *message
+	err     error // read error, once the connection is broken
+	done    chan struct{}
+
+	// handle is called for each request and notification from the server.
+	// For notifications, its result is ignored.
+	handle func(method string, params json.RawMessage) (interface{}, error)
+}
+
+// A message is any incoming JSON-RPC message.
+type message struct {
+	ID     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+	Result json.RawMessage  `json:"result"`
+	Error  *rpcError        `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+type request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+}
+
+type errorResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   *rpcError       `json:"error"`
+}
+
+const errMethodNotFound = -32601
+
+var errClosed = errors.New("connection closed")
+
+// newConn returns a connection reading from r and writing to w.
+// It starts a goroutine reading messages, which calls handle
+// for each request or notification from the server.
+func newConn(r io.Reader, w io.Writer, handle func(string, json.RawMessage) (interface{}, error)) *conn {
+	c := &conn{
+		r:       bufio.NewReader(r),
+		w:       w,
+		pending: make(map[int64]chan *message),
+		done:    make(chan struct{}),
+		handle:  handle,
+	}
+	go c.readLoop()
+	return c
+}
+
+// call sends a request and waits for its response,
+// unmarshaling the result into result, if non-nil.
+func (c *conn) call(ctx context.Context, method string, params, result interface{}) error {
+	ch := make(chan *message, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.seq++
+	id := c.seq
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+	if err := c.send(&request{JSONRPC: "2.0", ID: id, Method: method, Params: params}); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		c.notify("$/cancelRequest", map[string]int64{"id": id})
+		return ctx.Err()
+	case <-c.done:
+		return c.err
+	case m := <-ch:
+		if m.Error != nil {
+			return fmt.Errorf("%s: %v", method, m.Error)
+		}
+		if result == nil || len(m.Result) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(m.Result, result); err != nil {
+			return fmt.Errorf("%s: %v", method, err)
+		}
+		return nil
+	}
+}
+
+// notify sends a notification.
+func (c *conn) notify(method string, params interface{}) error {
+	return c.send(&notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (c *conn) send(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(data)
+	return err
+}
+
+func (c *conn) readLoop() {
+	var err error
+	for {
+		var data []byte
+		data, err = readMessage(c.r)
+		if err != nil {
+			break
+		}
+		var m message
+		if err = json.Unmarshal(data, &m); err != nil {
+			err = fmt.Errorf("malformed message: %v", err)
+			break
+		}
+		switch {
+		case m.Method != "" && m.ID != nil:
+			go c.reply(&m)
+		case m.Method != "":
+			c.handle(m.Method, m.Params)
+		case m.ID != nil:
+			id, err := strconv.ParseInt(string(*m.ID), 10, 64)
+			if err != nil {
+				continue
+			}
+			c.mu.Lock()
+			ch := c.pending[id]
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- &m
+			}
+		}
+	}
+	if err == io.EOF {
+		err = errClosed
+	}
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// reply handles a request from the server and sends the response.
+func (c *conn) reply(m *message) {
+	result, err := c.handle(m.Method, m.Params)
+	if err != nil {
+		e, ok := err.(*rpcError)
+		if !ok {
+			e = &rpcError{Code: -32603, Message: err.Error()}
+		}
+		c.send(&errorResponse{JSONRPC: "2.0", ID: *m.ID, Error: e})
+		return
+	}
+	c.send(&response{JSONRPC: "2.0", ID: *m.ID, Result: result})
+}
+
+// readMessage reads a single framed message.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	hdr, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || len(hdr) == 0 && strings.Contains(err.Error(), "EOF") {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	n, err := strconv.Atoi(hdr.Get("Content-Length"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("bad Content-Length %q", hdr.Get("Content-Length"))
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,572 @@
+// Acmelsp connects acme to a language server.
+//
+// Usage:
+//
+//	acmelsp [-server command] [-lang id] [-ext suffixes] [dir]
+//
+// Acmelsp starts the language server (default gopls) for the workspace
+// rooted at dir (default the current directory) and talks to it
+// using the Language Server Protocol over the server's standard input and output.
+// It watches the acme log for windows on files with the given suffixes
+// (default .go), sending their bodies to the server when they are
+// opened, written, or used by a command.
+//
+// Acmelsp creates a window named dir/+LSP with these commands in its tag,
+// each of which applies to the selection in the most recently focused file window:
+//
+//	Def         show and open the definition of the identifier
+//	Hov         show the documentation for the identifier
+//	Refs        list the references to the identifier
+//	Rename new  rename the identifier to new, in all files
+//	Fmt         format the file
+//	Diag        list the current diagnostics
+//
+// Results are shown in the +LSP window as file:line addresses.
+// Diagnostics published by the server are written to dir/+Errors.
+// Deleting the +LSP window shuts down the server and exits.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"9fans.net/go/acme"
+)
+
+var (
+	serverFlag = flag.String("server", "gopls", "run language server `command`")
+	langFlag   = flag.String("lang", "go", "language `id` of tracked files")
+	extFlag    = flag.String("ext", ".go", "comma-separated file name `suffixes` to track")
+)
+
+// timeout bounds each request to the server.
+const timeout = 30 * time.Second
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("acmelsp: ")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: acmelsp [-server command] [-lang id] [-ext suffixes] [dir]\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	args := strings.Fields(*serverFlag)
+	if len(args) == 0 {
+		flag.Usage()
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		log.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		log.Fatal(err)
+	}
+
+	b := &bridge{
+		c:    newClient(stdout, stdin),
+		dir:  dir,
+		lang: *langFlag,
+		exts: strings.Split(*extFlag, ","),
+		wins: make(map[int]string),
+	}
+	b.c.onDiagnostics = b.showDiagnostics
+	b.c.onMessage = func(msg string) { log.Print(msg) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	err = b.c.initialize(ctx, dir)
+	cancel()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	b.lsp, err = acme.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	b.lsp.Name("%s/+LSP", dir)
+	b.lsp.SetErrorPrefix(dir + "/")
+	b.lsp.AddTag("Def", "Hov", "Refs", "Rename", "Fmt", "Diag")
+	b.lsp.Clean()
+
+	go func() {
+		b.router().Run(context.Background(), b.lsp)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		b.c.shutdown(ctx)
+		cancel()
+		stdin.Close()
+		cmd.Wait()
+		os.Exit(0)
+	}()
+
+	if wins, err := acme.Windows(); err == nil {
+		for _, info := range wins {
+			if b.tracks(info.Name) {
+				b.open(info.ID, info.Name)
+			}
+		}
+	}
+
+	l, err := acme.Log()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for {
+		e, err := l.Read()
+		if err != nil {
+			log.Fatal(err)
+		}
+		b.logEvent(e)
+	}
+}
+
+// A bridge connects acme windows to a language server client.
+type bridge struct {
+	c    *client
+	dir  string
+	lang string
+	exts []string
+	lsp  *acme.Win // the +LSP window
+
+	mu    sync.Mutex
+	wins  map[int]string // tracked windows, by ID
+	focus int            // ID of the most recently focused tracked window
+}
+
+// tracks reports whether the bridge tracks windows on the named file.
+func (b *bridge) tracks(name string) bool {
+	if !filepath.IsAbs(name) {
+		return false
+	}
+	for _, ext := range b.exts {
+		if ext != "" && strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *bridge) logEvent(e acme.LogEvent) {
+	switch e.Op {
+	case "new", "zerox", "get":
+		if b.tracks(e.Name) {
+			b.open(e.ID, e.Name)
+		}
+	case "put":
+		if b.tracks(e.Name) {
+			b.open(e.ID, e.Name)
+			b.c.save(e.Name)
+		}
+	case "focus":
+		b.mu.Lock()
+		_, ok := b.wins[e.ID]
+		b.mu.Unlock()
+		if !ok && b.tracks(e.Name) {
+			b.open(e.ID, e.Name)
+			ok = true
+		}
+		if ok {
+			b.mu.Lock()
+			b.focus = e.ID
+			b.mu.Unlock()
+		}
+	case "del":
+		b.mu.Lock()
+		name, ok := b.wins[e.ID]
+		delete(b.wins, e.ID)
+		if b.focus == e.ID {
+			b.focus = 0
+		}
+		others := false
+		for _, n := range b.wins {
+			if n == name {
+				others = true
+			}
+		}
+		b.mu.Unlock()
+		if ok && !others {
+			b.c.close(name)
+		}
+	}
+}
+
+// open starts tracking the window and sends its body to the server.
+func (b *bridge) open(id int, name string) {
+	b.mu.Lock()
+	b.wins[id] = name
+	if b.focus == 0 {
+		b.focus = id
+	}
+	b.mu.Unlock()
+
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		return
+	}
+	defer w.CloseFiles()
+	if _, err := b.syncWin(w, name); err != nil {
+		log.Print(err)
+	}
+}
+
+// syncWin sends the window body to the server and returns it.
+func (b *bridge) syncWin(w *acme.Win, name string) ([]byte, error) {
+	body, err := w.ReadAll("body")
+	if err != nil {
+		return nil, err
+	}
+	return body, b.c.sync(name, b.lang, string(body))
+}
+
+// A target is the selection in a file window to which a command applies.
+type target struct {
+	w    *acme.Win
+	name string
+	body []byte
+	pos  Position
+}
+
+// target returns the selection in the most recently focused file window.
+// The caller must call t.w.CloseFiles.
+func (b *bridge) target() (*target, error) {
+	b.mu.Lock()
+	id, name := b.focus, b.wins[b.focus]
+	b.mu.Unlock()
+	if id == 0 {
+		return nil, errors.New("no file window")
+	}
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := b.syncWin(w, name)
+	if err != nil {
+		w.CloseFiles()
+		return nil, err
+	}
+	if err := w.AddrToDot(); err != nil {
+		w.CloseFiles()
+		return nil, err
+	}
+	q0, _, err := w.ReadAddr()
+	if err != nil {
+		w.CloseFiles()
+		return nil, err
+	}
+	return &target{w: w, name: name, body: body, pos: position(body, q0)}, nil
+}
+
+func (b *bridge) router() *acme.Router {
+	r := acme.NewRouter()
+	r.Register(&acme.Command{Name: "Def", Help: "show the definition of the selected identifier", Run: b.def})
+	r.Register(&acme.Command{Name: "Hov", Help: "show documentation for the selected identifier", Run: b.hov})
+	r.Register(&acme.Command{Name: "Refs", Help: "list references to the selected identifier", Run: b.refs})
+	r.Register(&acme.Command{Name: "Rename", Help: "rename the selected identifier", Parse: parseName, Run: b.rename})
+	r.Register(&acme.Command{Name: "Fmt", Help: "format the file", Run: b.format})
+	r.Register(&acme.Command{Name: "Diag", Help: "list diagnostics", Run: b.diag})
+	return r
+}
+
+func parseName(arg string) (interface{}, error) {
+	if arg == "" || strings.ContainsAny(arg, " \t\n") {
+		return nil, errors.New("usage: Rename newname")
+	}
+	return arg, nil
+}
+
+// show replaces the body of the +LSP window with text.
+func (b *bridge) show(text string) {
+	b.lsp.Clear()
+	b.lsp.Write("body", []byte(text))
+	b.lsp.Addr("#0")
+	b.lsp.DotToAddr()
+	b.lsp.Show()
+	b.lsp.Clean()
+}
+
+func (b *bridge) def(ctx context.Context, call *acme.Call) error {
+	t, err := b.target()
+	if err != nil {
+		return err
+	}
+	defer t.w.CloseFiles()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	locs, err := b.c.definition(ctx, t.name, t.pos)
+	if err != nil {
+		return err
+	}
+	if len(locs) == 0 {
+		b.show("no definition\n")
+		return nil
+	}
+	b.show(b.formatLocations(locs, false))
+	return b.openLocation(locs[0])
+}
+
+func (b *bridge) hov(ctx context.Context, call *acme.Call) error {
+	t, err := b.target()
+	if err != nil {
+		return err
+	}
+	defer t.w.CloseFiles()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	text, err := b.c.hover(ctx, t.name, t.pos)
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		text = "no information"
+	}
+	b.show(strings.TrimRight(text, "\n") + "\n")
+	return nil
+}
+
+func (b *bridge) refs(ctx context.Context, call *acme.Call) error {
+	t, err := b.target()
+	if err != nil {
+		return err
+	}
+	defer t.w.CloseFiles()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	locs, err := b.c.references(ctx, t.name, t.pos)
+	if err != nil {
+		return err
+	}
+	if len(locs) == 0 {
+		b.show("no references\n")
+		return nil
+	}
+	b.show(b.formatLocations(locs, true))
+	return nil
+}
+
+func (b *bridge) rename(ctx context.Context, call *acme.Call) error {
+	t, err := b.target()
+	if err != nil {
+		return err
+	}
+	defer t.w.CloseFiles()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	edit, err := b.c.rename(ctx, t.name, t.pos, call.Value.(string))
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	for uri, edits := range edit.fileEdits() {
+		name := uriFile(uri)
+		if err := b.applyFileEdits(name, edits); err != nil {
+			return err
+		}
+		fmt.Fprintf(&out, "%s: %d edits\n", name, len(edits))
+	}
+	b.show(out.String())
+	return nil
+}
+
+func (b *bridge) format(ctx context.Context, call *acme.Call) error {
+	t, err := b.target()
+	if err != nil {
+		return err
+	}
+	defer t.w.CloseFiles()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	edits, err := b.c.format(ctx, t.name, 8)
+	if err != nil {
+		return err
+	}
+	if len(edits) == 0 {
+		return nil
+	}
+	if err := t.w.Edit(acmeEdits(t.body, edits)); err != nil {
+		return err
+	}
+	_, err = b.syncWin(t.w, t.name)
+	return err
+}
+
+func (b *bridge) diag(ctx context.Context, call *acme.Call) error {
+	all := b.c.diagnostics()
+	if len(all) == 0 {
+		b.show("no diagnostics\n")
+		return nil
+	}
+	var out strings.Builder
+	for _, name := range sortedNames(all) {
+		out.WriteString(formatDiagnostics(name, all[name]))
+	}
+	acme.Err(b.dir+"/", out.String())
+	return nil
+}
+
+// showDiagnostics writes newly published diagnostics to +Errors.
+func (b *bridge) showDiagnostics(uri string, diags []Diagnostic) {
+	if len(diags) > 0 {
+		acme.Err(b.dir+"/", formatDiagnostics(uriFile(uri), diags))
+	}
+}
+
+// formatDiagnostics formats diags for the named file as file:line lines.
+func formatDiagnostics(name string, diags []Diagnostic) string {
+	var out strings.Builder
+	for _, d := range diags {
+		msg := strings.Replace(strings.TrimSpace(d.Message), "\n", "\n\t", -1)
+		fmt.Fprintf(&out, "%s:%d: %s\n", name, d.Range.Start.Line+1, msg)
+	}
+	return out.String()
+}
+
+// formatLocations formats locs as file:line lines,
+// followed by the text of the line if withText is set.
+func (b *bridge) formatLocations(locs []Location, withText bool) string {
+	files := make(map[string][][]byte)
+	var out strings.Builder
+	for _, loc := range locs {
+		name := uriFile(loc.URI)
+		line := loc.Range.Start.Line
+		fmt.Fprintf(&out, "%s:%d", name, line+1)
+		if withText {
+			lines, ok := files[name]
+			if !ok {
+				data, _ := b.fileText(name)
+				lines = bytes.Split(data, []byte("\n"))
+				files[name] = lines
+			}
+			if line < len(lines) {
+				fmt.Fprintf(&out, ": %s", bytes.TrimSpace(lines[line]))
+			}
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// window returns the ID of a window on the named file, or 0 if there is none.
+func (b *bridge) window(name string) int {
+	b.mu.Lock()
+	for id, n := range b.wins {
+		if n == name {
+			b.mu.Unlock()
+			return id
+		}
+	}
+	b.mu.Unlock()
+	wins, err := acme.Windows()
+	if err != nil {
+		return 0
+	}
+	for _, info := range wins {
+		if info.Name == name {
+			return info.ID
+		}
+	}
+	return 0
+}
+
+// fileText returns the text of the named file,
+// from its window if it has one.
+func (b *bridge) fileText(name string) ([]byte, error) {
+	if id := b.window(name); id != 0 {
+		if w, err := acme.Open(id, nil); err == nil {
+			defer w.CloseFiles()
+			return w.ReadAll("body")
+		}
+	}
+	return ioutil.ReadFile(name)
+}
+
+// applyFileEdits applies the edits to the named file: to the body
+// of its window, if it has one, or else to the file itself.
+func (b *bridge) applyFileEdits(name string, edits []TextEdit) error {
+	if id := b.window(name); id != 0 {
+		w, err := acme.Open(id, nil)
+		if err != nil {
+			return err
+		}
+		defer w.CloseFiles()
+		body, err := w.ReadAll("body")
+		if err != nil {
+			return err
+		}
+		if err := w.Edit(acmeEdits(body, edits)); err != nil {
+			return err
+		}
+		if b.tracks(name) {
+			_, err = b.syncWin(w, name)
+		}
+		return err
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, applyEdits(data, acmeEdits(data, edits)), info.Mode())
+}
+
+// openLocation shows loc in a window, opening the file if necessary.
+func (b *bridge) openLocation(loc Location) error {
+	name := uriFile(loc.URI)
+	var w *acme.Win
+	var err error
+	if id := b.window(name); id != 0 {
+		w, err = acme.Open(id, nil)
+		if err != nil {
+			return err
+		}
+	} else {
+		w, err = acme.New()
+		if err != nil {
+			return err
+		}
+		w.Name("%s", name)
+		w.Get()
+	}
+	defer w.CloseFiles()
+	text, err := w.ReadAll("body")
+	if err != nil {
+		return err
+	}
+	if err := w.Addr("#%d", runeOffset(text, loc.Range.Start)); err != nil {
+		return err
+	}
+	w.DotToAddr()
+	return w.Show()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"9fans.net/go/acme"
+)
+
+// The subset of the Language Server Protocol used by acmelsp.
+// See https://microsoft.github.io/language-server-protocol/specification.
+
+// A Position is a zero-based line and UTF-16 code unit offset.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type VersionedTextDocumentIdentifier struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+}
+
+type TextDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Message  string `json:"message"`
+}
+
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+type TextDocumentEdit struct {
+	TextDocument VersionedTextDocumentIdentifier `json:"textDocument"`
+	Edits        []TextEdit                      `json:"edits"`
+}
+
+type WorkspaceEdit struct {
+	Changes         map[string][]TextEdit `json:"changes,omitempty"`
+	DocumentChanges []TextDocumentEdit    `json:"documentChanges,omitempty"`
+}
+
+// fileEdits returns the edits in e, by file URI.
+func (e *WorkspaceEdit) fileEdits() map[string][]TextEdit {
+	m := make(map[string][]TextEdit)
+	for uri, edits := range e.Changes {
+		m[uri] = append(m[uri], edits...)
+	}
+	for _, d := range e.DocumentChanges {
+		m[d.TextDocument.URI] = append(m[d.TextDocument.URI], d.Edits...)
+	}
+	return m
+}
+
+// hoverText returns the text of the contents of a hover result,
+// which may be a MarkupContent, a MarkedString, or a list of MarkedStrings.
+func hoverText(contents json.RawMessage) string {
+	var s string
+	if json.Unmarshal(contents, &s) == nil {
+		return s
+	}
+	var v struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(contents, &v) == nil && v.Value != "" {
+		return v.Value
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(contents, &list) == nil {
+		var parts []string
+		for _, c := range list {
+			if t := hoverText(c); t != "" {
+				parts = append(parts, t)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// fileURI returns the file URI for the absolute path name.
+func fileURI(name string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(name)}
+	return u.String()
+}
+
+// uriFile returns the path name for a file URI.
+func uriFile(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// runeOffset returns the rune offset in text of the position p.
+// Positions past the end of a line or of the text are clamped.
+func runeOffset(text []byte, p Position) int {
+	q := 0
+	i := 0
+	for line := 0; line < p.Line; line++ {
+		for i < len(text) && text[i] != '\n' {
+			_, n := utf8.DecodeRune(text[i:])
+			i += n
+			q++
+		}
+		if i == len(text) {
+			return q
+		}
+		i++
+		q++
+	}
+	for u := 0; u < p.Character && i < len(text) && text[i] != '\n'; {
+		r, n := utf8.DecodeRune(text[i:])
+		i += n
+		q++
+		if r >= 0x10000 {
+			u += 2
+		} else {
+			u++
+		}
+	}
+	return q
+}
+
+// position returns the position of the rune offset q in text.
+func position(text []byte, q int) Position {
+	var p Position
+	for i := 0; q > 0 && i < len(text); q-- {
+		r, n := utf8.DecodeRune(text[i:])
+		i += n
+		switch {
+		case r == '\n':
+			p.Line++
+			p.Character = 0
+		case r >= 0x10000:
+			p.Character += 2
+		default:
+			p.Character++
+		}
+	}
+	return p
+}
+
+// acmeEdits converts LSP text edits on text to acme body edits.
+func acmeEdits(text []byte, edits []TextEdit) []acme.Edit {
+	var out []acme.Edit
+	for _, e := range edits {
+		out = append(out, acme.Edit{
+			Q0:   runeOffset(text, e.Range.Start),
+			Q1:   runeOffset(text, e.Range.End),
+			Text: []byte(e.NewText),
+		})
+	}
+	return out
+}
+
+// applyEdits returns text with the edits applied.
+// The edits must not overlap.
+func applyEdits(text []byte, edits []acme.Edit) []byte {
+	edits = append([]acme.Edit(nil), edits...)
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Q0 < edits[j].Q0 })
+	var out []byte
+	last := 0
+	for _, e := range edits {
+		i0 := acme.ByteOffset(text, e.Q0)
+		out = append(out, text[last:i0]...)
+		out = append(out, e.Text...)
+		last = acme.ByteOffset(text, e.Q1)
+	}
+	return append(out, text[last:]...)
+}
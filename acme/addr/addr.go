@@ -0,0 +1,629 @@
+// Package addr implements the address language of the sam and acme text editors.
+//
+// An address identifies a range of runes in a text.
+// The simple addresses are
+//
+//	#n	the empty range after rune n
+//	n	line n
+//	/re/	the next match of the regular expression re, searching forward
+//	?re?	the previous match of re, searching backward
+//	.	dot, the current selection
+//	$	the empty range at the end of the text
+//
+// Simple addresses may be combined with + and -, which move forward
+// and backward relative to the preceding address (a missing operand
+// means one line), and juxtaposed addresses are joined by an implied +.
+// The compound address a1,a2 is the range from the start of a1 to
+// the end of a2; a1;a2 is the same except that a2 is evaluated with
+// dot set to a1. A missing left operand means 0 and a missing right
+// operand means $, so that "," is the whole text.
+//
+// Regular expressions use the syntax of package regexp,
+// with ^ and $ matching at line boundaries.
+package addr // import "9fans.net/go/acme/addr"
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var (
+	ErrRange  = errors.New("address out of range")
+	ErrSearch = errors.New("no match for regexp")
+	ErrOrder  = errors.New("addresses out of order")
+	ErrSyntax = errors.New("bad address syntax")
+)
+
+// An Addr is a parsed address.
+type Addr struct {
+	src string
+	a   *addr
+}
+
+type addr struct {
+	typ  byte // '#', 'l', '/', '?', '.', '$', '+', '-', ',', ';'
+	num  int
+	re   *regexp.Regexp
+	left *addr // left operand of ',' and ';'
+	next *addr // next simple address, or right operand of ',' and ';'
+}
+
+// String returns the text from which a was parsed.
+func (a *Addr) String() string {
+	return a.src
+}
+
+// Parse parses the address s, which must contain only an address.
+func Parse(s string) (*Addr, error) {
+	a, rest, err := ParsePrefix(s)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, ErrSyntax
+	}
+	return a, nil
+}
+
+// ParsePrefix parses the address at the beginning of s
+// and returns it along with the text following it.
+// If s does not begin with an address, ParsePrefix returns a nil Addr.
+func ParsePrefix(s string) (a *Addr, rest string, err error) {
+	p := &parser{s: s}
+	defer func() {
+		if v := recover(); v != nil {
+			e, ok := v.(parseError)
+			if !ok {
+				panic(v)
+			}
+			a, rest, err = nil, s, e.err
+		}
+	}()
+	x := p.compound()
+	if x == nil {
+		return nil, s, nil
+	}
+	return &Addr{src: s[:p.pos], a: x}, s[p.pos:], nil
+}
+
+type parseError struct{ err error }
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) errorf(err error) {
+	panic(parseError{err})
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) skipSpace() byte {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+	return p.peek()
+}
+
+func (p *parser) compound() *addr {
+	left := p.simple()
+	pos := p.pos
+	c := p.skipSpace()
+	if c != ',' && c != ';' {
+		p.pos = pos
+		return left
+	}
+	p.pos++
+	return &addr{typ: c, left: left, next: p.compound()}
+}
+
+func (p *parser) simple() *addr {
+	a := new(addr)
+	pos := p.pos
+	switch c := p.skipSpace(); {
+	case c == '#':
+		p.pos++
+		a.typ = '#'
+		a.num = p.number(1)
+	case '0' <= c && c <= '9':
+		a.typ = 'l'
+		a.num = p.number(0)
+	case c == '/' || c == '?':
+		p.pos++
+		a.typ = c
+		a.re = p.regexp(c)
+	case c == '.' || c == '$' || c == '+' || c == '-':
+		p.pos++
+		a.typ = c
+	default:
+		p.pos = pos
+		return nil
+	}
+	if a.next = p.simple(); a.next != nil {
+		switch a.next.typ {
+		case '.', '$':
+			p.errorf(ErrSyntax)
+		case 'l', '#', '/', '?':
+			if a.typ != '+' && a.typ != '-' {
+				// Juxtaposition implies +.
+				a.next = &addr{typ: '+', next: a.next}
+			}
+		}
+	}
+	return a
+}
+
+func (p *parser) number(def int) int {
+	start := p.pos
+	n := 0
+	for p.pos < len(p.s) && '0' <= p.s[p.pos] && p.s[p.pos] <= '9' {
+		n = n*10 + int(p.s[p.pos]-'0')
+		p.pos++
+	}
+	if p.pos == start {
+		return def
+	}
+	return n
+}
+
+// regexp parses a regular expression terminated by delim,
+// the end of a line, or the end of the input.
+// A backslash before delim quotes it.
+func (p *parser) regexp(delim byte) *regexp.Regexp {
+	var b strings.Builder
+	for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+		c := p.s[p.pos]
+		if c == delim {
+			p.pos++
+			break
+		}
+		if c == '\\' && p.pos+1 < len(p.s) {
+			if p.s[p.pos+1] == delim {
+				b.WriteByte(delim)
+				p.pos += 2
+				continue
+			}
+			b.WriteByte(c)
+			p.pos++
+			c = p.s[p.pos]
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+	if b.Len() == 0 {
+		p.errorf(errors.New("no previous regular expression"))
+	}
+	re, err := Compile(b.String())
+	if err != nil {
+		p.errorf(err)
+	}
+	return re
+}
+
+// Compile compiles a regular expression as used in addresses,
+// with ^ and $ matching at line boundaries.
+func Compile(expr string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("(?m:" + expr + ")")
+	if err != nil {
+		return nil, errors.New("bad regexp: " + expr)
+	}
+	return re, nil
+}
+
+// Eval parses the address expr and evaluates it in text,
+// with dot set to the rune range [q0, q1).
+// It returns the resulting rune range.
+func Eval(expr string, text []rune, q0, q1 int) (int, int, error) {
+	a, err := Parse(expr)
+	if err != nil {
+		return 0, 0, err
+	}
+	return a.Eval(text, q0, q1)
+}
+
+// Eval evaluates a in text, with dot set to the rune range [q0, q1).
+// It returns the resulting rune range.
+func (a *Addr) Eval(text []rune, q0, q1 int) (int, int, error) {
+	if q0 < 0 || q1 < q0 || q1 > len(text) {
+		return 0, 0, ErrRange
+	}
+	t := &Text{r: text}
+	r, err := t.eval(a.a, Range{q0, q1}, Range{q0, q1}, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	return r.Q0, r.Q1, nil
+}
+
+// A Range is a range of runes [Q0, Q1) in a text.
+type Range struct {
+	Q0, Q1 int
+}
+
+// A Text is a rune buffer in which addresses can be evaluated
+// and regular expressions matched.
+// It caches the UTF-8 form of the text needed for matching,
+// so repeated evaluations in the same text are cheaper
+// than repeated calls to Eval.
+type Text struct {
+	r   []rune
+	s   string
+	off []int // off[q] is the byte offset in s of rune q
+}
+
+// NewText returns a Text holding the runes r.
+// The caller must not modify r while the Text is in use.
+func NewText(r []rune) *Text {
+	return &Text{r: r}
+}
+
+// Len returns the number of runes in t.
+func (t *Text) Len() int {
+	return len(t.r)
+}
+
+// Runes returns the runes in t.
+func (t *Text) Runes() []rune {
+	return t.r
+}
+
+// Eval evaluates a in t, with dot set to the range dot.
+func (t *Text) Eval(a *Addr, dot Range) (Range, error) {
+	if dot.Q0 < 0 || dot.Q1 < dot.Q0 || dot.Q1 > len(t.r) {
+		return Range{}, ErrRange
+	}
+	return t.eval(a.a, dot, dot, 0)
+}
+
+func (t *Text) init() {
+	if t.off != nil {
+		return
+	}
+	t.s = string(t.r)
+	t.off = make([]int, len(t.r)+1)
+	i := 0
+	for q, r := range t.r {
+		t.off[q] = i
+		n := utf8.RuneLen(r)
+		if n < 0 {
+			n = utf8.RuneLen(utf8.RuneError) // string conversion replaces invalid runes
+		}
+		i += n
+	}
+	t.off[len(t.r)] = i
+}
+
+// runeAt returns the rune offset of the byte offset i in t.s.
+func (t *Text) runeAt(i int) int {
+	lo, hi := 0, len(t.off)-1
+	for lo < hi {
+		m := (lo + hi) / 2
+		if t.off[m] < i {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+	return lo
+}
+
+func (t *Text) eval(a *addr, r, dot Range, sign int) (Range, error) {
+	var err error
+	for ; a != nil; a = a.next {
+		switch a.typ {
+		case 'l':
+			r, err = t.lineAddr(a.num, r, sign)
+			sign = 0
+		case '#':
+			r, err = t.charAddr(a.num, r, sign)
+			sign = 0
+		case '.':
+			r = dot
+		case '$':
+			r = Range{len(t.r), len(t.r)}
+		case '?', '/':
+			if a.typ == '?' {
+				sign = -sign
+				if sign == 0 {
+					sign = -1
+				}
+			}
+			if sign >= 0 {
+				r, err = t.Search(a.re, r.Q1, true)
+			} else {
+				r, err = t.Search(a.re, r.Q0, false)
+			}
+			sign = 0
+		case ',', ';':
+			a1 := Range{0, 0}
+			if a.left != nil {
+				a1, err = t.eval(a.left, r, dot, 0)
+				if err != nil {
+					return Range{}, err
+				}
+			}
+			if a.typ == ';' {
+				r, dot = a1, a1
+			}
+			a2 := Range{len(t.r), len(t.r)}
+			if a.next != nil {
+				a2, err = t.eval(a.next, r, dot, 0)
+				if err != nil {
+					return Range{}, err
+				}
+			}
+			if a2.Q1 < a1.Q0 {
+				return Range{}, ErrOrder
+			}
+			return Range{a1.Q0, a2.Q1}, nil
+		case '+', '-':
+			sign = 1
+			if a.typ == '-' {
+				sign = -1
+			}
+			if a.next == nil || a.next.typ == '+' || a.next.typ == '-' {
+				r, err = t.lineAddr(1, r, sign)
+			}
+		}
+		if err != nil {
+			return Range{}, err
+		}
+	}
+	return r, nil
+}
+
+func (t *Text) charAddr(n int, r Range, sign int) (Range, error) {
+	switch {
+	case sign == 0:
+		r.Q0, r.Q1 = n, n
+	case sign < 0:
+		r.Q0 -= n
+		r.Q1 = r.Q0
+	default:
+		r.Q1 += n
+		r.Q0 = r.Q1
+	}
+	if r.Q0 < 0 || r.Q1 > len(t.r) {
+		return Range{}, ErrRange
+	}
+	return r, nil
+}
+
+func (t *Text) lineAddr(n int, r Range, sign int) (Range, error) {
+	text := t.r
+	var a Range
+	if sign >= 0 {
+		var p int
+		if n == 0 {
+			if sign == 0 || r.Q1 == 0 {
+				return Range{0, 0}, nil
+			}
+			a.Q0 = r.Q1
+			p = r.Q1 - 1
+		} else {
+			nl := 0
+			if sign == 0 || r.Q1 == 0 {
+				p = 0
+				nl = 1
+			} else {
+				p = r.Q1 - 1
+				if text[p] == '\n' {
+					nl = 1
+				}
+				p++
+			}
+			for nl < n {
+				if p >= len(text) {
+					return Range{}, ErrRange
+				}
+				if text[p] == '\n' {
+					nl++
+				}
+				p++
+			}
+			a.Q0 = p
+		}
+		for p < len(text) {
+			p++
+			if text[p-1] == '\n' {
+				break
+			}
+		}
+		a.Q1 = p
+	} else {
+		p := r.Q0
+		if n == 0 {
+			a.Q1 = r.Q0
+		} else {
+			for nl := 0; nl < n; {
+				if p == 0 {
+					if nl++; nl != n {
+						return Range{}, ErrRange
+					}
+				} else {
+					c := text[p-1]
+					if c != '\n' {
+						p--
+					} else if nl++; nl != n {
+						p--
+					}
+				}
+			}
+			a.Q1 = p
+			if p > 0 {
+				p--
+			}
+		}
+		for p > 0 && text[p-1] != '\n' {
+			p--
+		}
+		a.Q0 = p
+	}
+	return a, nil
+}
+
+// Search searches t for a match of re.
+// If forward is true, Search finds the first match beginning at or after q,
+// wrapping around to the beginning of the text if necessary.
+// Otherwise it finds the last match ending at or before q,
+// wrapping around to the end of the text.
+// As in sam and acme, an empty match at q itself is skipped.
+func (t *Text) Search(re *regexp.Regexp, q int, forward bool) (Range, error) {
+	t.init()
+	if forward {
+		r, ok := t.searchForward(re, q)
+		if ok && r.Q0 == r.Q1 && r.Q0 == q {
+			if q++; q > len(t.r) {
+				q = 0
+			}
+			r, ok = t.searchForward(re, q)
+		}
+		if !ok {
+			return Range{}, ErrSearch
+		}
+		return r, nil
+	}
+	r, ok := t.searchBackward(re, q)
+	if ok && r.Q0 == r.Q1 && r.Q1 == q {
+		if q--; q < 0 {
+			q = len(t.r)
+		}
+		r, ok = t.searchBackward(re, q)
+	}
+	if !ok {
+		return Range{}, ErrSearch
+	}
+	return r, nil
+}
+
+func (t *Text) searchForward(re *regexp.Regexp, q int) (Range, bool) {
+	if m := t.matchFrom(re, q); m != nil {
+		return *m, true
+	}
+	if m := t.matchFrom(re, 0); m != nil {
+		return *m, true
+	}
+	return Range{}, false
+}
+
+// matchFrom returns the first match of re beginning at or after rune q.
+func (t *Text) matchFrom(re *regexp.Regexp, q int) *Range {
+	if q == 0 {
+		m := re.FindStringIndex(t.s)
+		if m == nil {
+			return nil
+		}
+		return &Range{t.runeAt(m[0]), t.runeAt(m[1])}
+	}
+	// Match starting one rune early, consuming that rune before re,
+	// so that ^ and \b see the text before q.
+	j := t.off[q-1]
+	pre := contextRegexp(`(?s:.)(` + re.String() + `)`)
+	if pre == nil {
+		return nil
+	}
+	m := pre.FindStringSubmatchIndex(t.s[j:])
+	if m == nil {
+		return nil
+	}
+	return &Range{t.runeAt(j + m[2]), t.runeAt(j + m[3])}
+}
+
+// matchAt returns the match of re beginning at rune q and ending
+// at or before rune end, if any. Like matchFrom, it matches with
+// the text before q as context. If the match in the whole text
+// ends after end, matchAt tries again with the text cut at end.
+func (t *Text) matchAt(re *regexp.Regexp, q, end int) *Range {
+	j, expr := t.off[q], `\A(`+re.String()+`)`
+	if q > 0 {
+		j, expr = t.off[q-1], `\A(?s:.)(`+re.String()+`)`
+	}
+	pre := contextRegexp(expr)
+	if pre == nil {
+		return nil
+	}
+	m := pre.FindStringSubmatchIndex(t.s[j:])
+	if m != nil && j+m[3] > t.off[end] {
+		m = pre.FindStringSubmatchIndex(t.s[j:t.off[end]])
+	}
+	if m == nil {
+		return nil
+	}
+	return &Range{q, t.runeAt(j + m[3])}
+}
+
+// contextRegexps caches the regular expressions compiled by contextRegexp,
+// which are derived from those used in searches.
+var contextRegexps struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}
+
+// maxContextRegexps limits the size of the contextRegexps cache.
+const maxContextRegexps = 64
+
+// contextRegexp returns the compiled form of expr, or nil if it does not compile.
+func contextRegexp(expr string) *regexp.Regexp {
+	c := &contextRegexps
+	c.Lock()
+	defer c.Unlock()
+	if re, ok := c.m[expr]; ok {
+		return re
+	}
+	if c.m == nil || len(c.m) >= maxContextRegexps {
+		c.m = make(map[string]*regexp.Regexp)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		re = nil
+	}
+	c.m[expr] = re
+	return re
+}
+
+// searchBackward returns the match of re that begins nearest before q
+// and ends at or before q, trying each start position in turn,
+// or, if there is none, the match that begins nearest the end of the text,
+// as if the search had wrapped around.
+func (t *Text) searchBackward(re *regexp.Regexp, q int) (Range, bool) {
+	for p := q; p >= 0; p-- {
+		if m := t.matchAt(re, p, q); m != nil {
+			return *m, true
+		}
+	}
+	n := len(t.r)
+	for p := n; p > q; p-- {
+		if m := t.matchAt(re, p, n); m != nil {
+			return *m, true
+		}
+	}
+	return Range{}, false
+}
+
+// FindAll returns the successive non-overlapping matches of re
+// in the range r of t. Each match is a slice of rune offsets
+// identifying the match and its parenthesized subexpressions,
+// as in regexp.FindAllStringSubmatchIndex;
+// an offset of -1 means that subexpression did not match.
+func (t *Text) FindAll(re *regexp.Regexp, r Range) [][]int {
+	t.init()
+	b0 := t.off[r.Q0]
+	all := re.FindAllStringSubmatchIndex(t.s[b0:t.off[r.Q1]], -1)
+	for _, m := range all {
+		for i, b := range m {
+			if b >= 0 {
+				m[i] = t.runeAt(b0 + b)
+			}
+		}
+	}
+	return all
+}
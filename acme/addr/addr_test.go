@@ -0,0 +1,150 @@
+package addr
+
+import (
+	"testing"
+)
+
+const text = "one\ntwo\nthree\nfour two\nfive\n"
+
+var evalTests = []struct {
+	addr   string
+	q0, q1 int // dot
+	r0, r1 int // result
+	err    error
+}{
+	{"#0", 0, 0, 0, 0, nil},
+	{"#5", 0, 0, 5, 5, nil},
+	{"#100", 0, 0, 0, 0, ErrRange},
+	{"0", 3, 3, 0, 0, nil},
+	{"1", 0, 0, 0, 4, nil},
+	{"2", 0, 0, 4, 8, nil},
+	{"5", 0, 0, 23, 28, nil},
+	{"6", 0, 0, 28, 28, nil},
+	{"7", 0, 0, 0, 0, ErrRange},
+	{"$", 0, 0, 28, 28, nil},
+	{".", 5, 7, 5, 7, nil},
+	{",", 5, 7, 0, 28, nil},
+	{"2,3", 0, 0, 4, 14, nil},
+	{"3,2", 0, 0, 8, 8, nil},
+	{"4,2", 0, 0, 0, 0, ErrOrder},
+	{",$", 0, 0, 0, 28, nil},
+	{"3,", 0, 0, 8, 28, nil},
+	{"/two/", 0, 0, 4, 7, nil},
+	{"/two/", 4, 7, 19, 22, nil},
+	{"/two/", 19, 22, 4, 7, nil},
+	{"?two?", 19, 22, 4, 7, nil},
+	{"?two?", 4, 7, 19, 22, nil},
+	{"/^f/", 0, 0, 14, 15, nil},
+	{"/^f/", 14, 15, 23, 24, nil},
+	{"/o$/", 0, 0, 6, 7, nil},
+	{"/xyz/", 0, 0, 0, 0, ErrSearch},
+	{"/t.o", 0, 0, 4, 7, nil},
+	{"/a\\/b/", 0, 0, 0, 0, ErrSearch},
+	{"+", 4, 8, 8, 14, nil},
+	{"-", 8, 14, 4, 8, nil},
+	{"+2", 0, 4, 8, 14, nil},
+	{"-2", 14, 23, 4, 8, nil},
+	{"2+", 0, 0, 8, 14, nil},
+	{"2-", 0, 0, 0, 4, nil},
+	{"#3+#2", 0, 0, 5, 5, nil},
+	{"#3-#2", 0, 0, 1, 1, nil},
+	{"2-#0", 0, 0, 4, 4, nil},
+	{"3-#0+#2", 0, 0, 10, 10, nil},
+	{"-#0,+#0", 5, 7, 5, 7, nil},
+	{"2/o/", 0, 0, 15, 16, nil},
+	{"/three/;/two/", 0, 0, 8, 22, nil},
+	{"/three/,/two/", 0, 0, 8, 7, ErrOrder},
+	{".,.+#2", 5, 5, 5, 7, nil},
+	{"0/one/", 10, 10, 0, 3, nil},
+	{"$-/f/", 0, 0, 23, 24, nil},
+	{"3.", 0, 0, 0, 0, ErrSyntax},
+	{"3 x", 0, 0, 0, 0, ErrSyntax},
+}
+
+func TestEval(t *testing.T) {
+	r := []rune(text)
+	for _, tt := range evalTests {
+		q0, q1, err := Eval(tt.addr, r, tt.q0, tt.q1)
+		if tt.err != nil {
+			if err != tt.err {
+				t.Errorf("Eval(%q, #%d,#%d) = %d, %d, %v, want error %v", tt.addr, tt.q0, tt.q1, q0, q1, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || q0 != tt.r0 || q1 != tt.r1 {
+			t.Errorf("Eval(%q, #%d,#%d) = %d, %d, %v, want %d, %d", tt.addr, tt.q0, tt.q1, q0, q1, err, tt.r0, tt.r1)
+		}
+	}
+}
+
+func TestEvalUTF8(t *testing.T) {
+	r := []rune("héllo\nwörld\n")
+	q0, q1, err := Eval("/ö/", r, 0, 0)
+	if err != nil || q0 != 7 || q1 != 8 {
+		t.Errorf("Eval(/ö/) = %d, %d, %v, want 7, 8", q0, q1, err)
+	}
+	q0, q1, err = Eval("2", r, 0, 0)
+	if err != nil || q0 != 6 || q1 != 12 {
+		t.Errorf("Eval(2) = %d, %d, %v, want 6, 12", q0, q1, err)
+	}
+}
+
+func TestSearchContext(t *testing.T) {
+	tests := []struct {
+		text, addr string
+		q, r0, r1  int
+	}{
+		{"xaa", "/[^b]a/", 1, 1, 3},
+		{"xaa", "/^a/", 1, 0, 0},
+		{"ab\nab", "/^a/", 1, 3, 4},
+		{"ab\nab", "/^a/", 3, 3, 4},
+		{"ab ab", "/\\bb/", 0, 0, 0},
+		{"ab ab", "/\\ba/", 1, 3, 4},
+		{"xyxy", "/xy/", 1, 2, 4},
+		{"xyxy", "/xy/", 3, 0, 2},
+		{"aaa", "?aa?", 3, 1, 3},
+		{"xaa", "?[^b]a?", 3, 1, 3},
+		{"ab\nab", "?^a?", 5, 3, 4},
+		{"ab\nab", "?^a?", 3, 0, 1},
+		{"ab ab", "?\\bb?", 5, 0, 0},
+		{"ab ab", "?b$?", 2, 4, 5},
+		{"aaaa", "?a+?", 2, 1, 2},
+	}
+	for _, tt := range tests {
+		q0, q1, err := Eval(tt.addr, []rune(tt.text), tt.q, tt.q)
+		if tt.r0 == tt.r1 {
+			if err != ErrSearch {
+				t.Errorf("Eval(%q) in %q from #%d = %d, %d, %v, want error %v", tt.addr, tt.text, tt.q, q0, q1, err, ErrSearch)
+			}
+			continue
+		}
+		if err != nil || q0 != tt.r0 || q1 != tt.r1 {
+			t.Errorf("Eval(%q) in %q from #%d = %d, %d, %v, want %d, %d", tt.addr, tt.text, tt.q, q0, q1, err, tt.r0, tt.r1)
+		}
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct {
+		s, addr, rest string
+	}{
+		{",x/a/ d", ",", "x/a/ d"},
+		{"/a b/,/c/ s/x/y/", "/a b/,/c/", " s/x/y/"},
+		{"p", "", "p"},
+		{"3,5d", "3,5", "d"},
+	}
+	for _, tt := range tests {
+		a, rest, err := ParsePrefix(tt.s)
+		if err != nil {
+			t.Errorf("ParsePrefix(%q): %v", tt.s, err)
+			continue
+		}
+		addr := ""
+		if a != nil {
+			addr = a.String()
+		}
+		if addr != tt.addr || rest != tt.rest {
+			t.Errorf("ParsePrefix(%q) = %q, %q, want %q, %q", tt.s, addr, rest, tt.addr, tt.rest)
+		}
+	}
+}
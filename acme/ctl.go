@@ -0,0 +1,143 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A WinCtl holds the window state reported by reading the ctl file.
+type WinCtl struct {
+	ID       int    // window ID
+	TagLen   int    // length of the tag, in runes
+	BodyLen  int    // length of the body, in runes
+	IsDir    bool   // whether the window is a directory listing
+	Dirty    bool   // whether the window has unsaved changes
+	Width    int    // width of the window, in pixels
+	Font     string // name of the window's font
+	TabWidth int    // width of a tab stop, in pixels
+}
+
+// ReadCtl reads and parses the window's ctl file.
+func (w *Win) ReadCtl() (*WinCtl, error) {
+	buf := make([]byte, 1000)
+	if _, err := w.Seek("ctl", 0, 0); err != nil {
+		return nil, err
+	}
+	n, err := w.Read("ctl", buf)
+	if err != nil {
+		return nil, err
+	}
+	return parseCtl(buf[:n])
+}
+
+func parseCtl(b []byte) (*WinCtl, error) {
+	f := strings.Fields(string(b))
+	if len(f) < 8 {
+		return nil, fmt.Errorf("malformed ctl file")
+	}
+	var n [6]int
+	for i := range n {
+		var err error
+		n[i], err = strconv.Atoi(f[i])
+		if err != nil {
+			return nil, fmt.Errorf("malformed ctl file")
+		}
+	}
+	tab, err := strconv.Atoi(f[7])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ctl file")
+	}
+	return &WinCtl{
+		ID:       n[0],
+		TagLen:   n[1],
+		BodyLen:  n[2],
+		IsDir:    n[3] != 0,
+		Dirty:    n[4] != 0,
+		Width:    n[5],
+		Font:     f[6],
+		TabWidth: tab,
+	}, nil
+}
+
+// Clean marks the window clean, as though it had just been written.
+func (w *Win) Clean() error {
+	return w.Ctl("clean")
+}
+
+// Dirty marks the window dirty, as though its body had been modified.
+func (w *Win) Dirty() error {
+	return w.Ctl("dirty")
+}
+
+// Show scrolls the window so that dot is visible.
+func (w *Win) Show() error {
+	return w.Ctl("show")
+}
+
+// Get reloads the window body from its file, like executing Get.
+func (w *Win) Get() error {
+	return w.Ctl("get")
+}
+
+// Put writes the window body to its file, like executing Put.
+func (w *Win) Put() error {
+	return w.Ctl("put")
+}
+
+// DotToAddr sets dot, the window's selection, to the addr address.
+func (w *Win) DotToAddr() error {
+	return w.Ctl("dot=addr")
+}
+
+// AddrToDot sets the addr address to dot, the window's selection.
+func (w *Win) AddrToDot() error {
+	return w.Ctl("addr=dot")
+}
+
+// LimitToAddr restricts searches in the addr file to the current addr address.
+func (w *Win) LimitToAddr() error {
+	return w.Ctl("limit=addr")
+}
+
+// Mark starts a new undo step, so that the following changes
+// are undone separately from the earlier ones.
+func (w *Win) Mark() error {
+	return w.Ctl("mark")
+}
+
+// NoMark turns off automatic marking of changes,
+// so that the following changes are undone together.
+func (w *Win) NoMark() error {
+	return w.Ctl("nomark")
+}
+
+// SetFont sets the window's font.
+func (w *Win) SetFont(name string) error {
+	return w.Ctl("font %s", name)
+}
+
+// Dump sets the command that acme's Load uses to recreate the window.
+func (w *Win) Dump(cmd string) error {
+	return w.Ctl("dump %s", cmd)
+}
+
+// DumpDir sets the directory in which acme's Load runs the Dump command.
+func (w *Win) DumpDir(dir string) error {
+	return w.Ctl("dumpdir %s", dir)
+}
+
+// Menu shows the file-related commands, such as Put and Undo, in the window's tag.
+func (w *Win) Menu() error {
+	return w.Ctl("menu")
+}
+
+// NoMenu hides the file-related commands in the window's tag.
+func (w *Win) NoMenu() error {
+	return w.Ctl("nomenu")
+}
+
+// ClearTag removes the user-typed text after the | in the window's tag.
+func (w *Win) ClearTag() error {
+	return w.Ctl("cleartag")
+}
@@ -0,0 +1,33 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCtl(t *testing.T) {
+	ctl := "         12          35        1024           0           1         800 /lib/font/bit/lucsans/euro.8.font          32 "
+	want := &WinCtl{
+		ID:       12,
+		TagLen:   35,
+		BodyLen:  1024,
+		IsDir:    false,
+		Dirty:    true,
+		Width:    800,
+		Font:     "/lib/font/bit/lucsans/euro.8.font",
+		TabWidth: 32,
+	}
+	got, err := parseCtl([]byte(ctl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCtl = %+v, want %+v", got, want)
+	}
+
+	for _, bad := range []string{"", "1 2 3", "1 2 x 0 0 800 font 32", "1 2 3 0 0 800 font tab"} {
+		if _, err := parseCtl([]byte(bad)); err == nil {
+			t.Errorf("parseCtl(%q) succeeded, want error", bad)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// A hunk records that the lines a[a0:a1] are replaced by b[b0:b1].
+type hunk struct {
+	a0, a1 int
+	b0, b1 int
+}
+
+// diffLines returns the hunks that transform the lines a into b,
+// in increasing order, using the linear-space variant of
+// Myers's O(ND) algorithm.
+func diffLines(a, b []string) []hunk {
+	d := &differ{a: a, b: b}
+	d.diff(0, len(a), 0, len(b))
+
+	var hunks []hunk
+	ai, bi := 0, 0
+	for _, mt := range d.matches {
+		if mt.x > ai || mt.y > bi {
+			hunks = append(hunks, hunk{ai, mt.x, bi, mt.y})
+		}
+		ai, bi = mt.x+1, mt.y+1
+	}
+	if ai < len(a) || bi < len(b) {
+		hunks = append(hunks, hunk{ai, len(a), bi, len(b)})
+	}
+	return hunks
+}
+
+// A differ collects the matching lines of a and b, in increasing order.
+type differ struct {
+	a, b    []string
+	matches []match
+}
+
+type match struct{ x, y int }
+
+// diff adds the matches between a[a0:a1] and b[b0:b1].
+func (d *differ) diff(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.matches = append(d.matches, match{a0, b0})
+		a0++
+		b0++
+	}
+	n := 0
+	for a0 < a1-n && b0 < b1-n && d.a[a1-n-1] == d.b[b1-n-1] {
+		n++
+	}
+	if a0 < a1-n && b0 < b1-n {
+		if x, y, ok := d.split(a0, a1-n, b0, b1-n); ok {
+			d.diff(a0, x, b0, y)
+			d.diff(x, a1-n, y, b1-n)
+		}
+	}
+	for i := n; i > 0; i-- {
+		d.matches = append(d.matches, match{a1 - i, b1 - i})
+	}
+}
+
+// split finds a point (x, y) on a shortest edit path from (a0, b0) to (a1, b1),
+// by running the search forward from the start and backward from the end
+// until the two meet. It reports false if the ranges have no lines in common.
+// Only the furthest point on each diagonal is kept, so it uses linear space.
+func (d *differ) split(a0, a1, b0, b1 int) (x, y int, ok bool) {
+	a, b := d.a[a0:a1], d.b[b0:b1]
+	n, m := len(a), len(b)
+	max := (n + m + 1) / 2
+	off := max
+	vf := make([]int, 2*max+2)
+	vb := make([]int, 2*max+2)
+	for i := range vf {
+		vf[i] = -1
+		vb[i] = -1
+	}
+	vf[off+1] = 0
+	vb[off+1] = 0
+	delta := n - m
+	front := delta%2 != 0
+	// The ranges of diagonals worth searching shrink
+	// as paths run off the edges of the grid.
+	kf0, kf1, kb0, kb1 := 0, 0, 0, 0
+	for D := 0; D < max; D++ {
+		for k := -D + kf0; k <= D-kf1; k += 2 {
+			var x int
+			if k == -D || k != D && vf[off+k-1] < vf[off+k+1] {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			switch {
+			case x > n:
+				kf1 += 2
+			case y > m:
+				kf0 += 2
+			case front:
+				if kb := off + delta - k; kb >= 0 && kb < len(vb) && vb[kb] != -1 && x >= n-vb[kb] {
+					return a0 + x, b0 + y, true
+				}
+			}
+		}
+		for k := -D + kb0; k <= D-kb1; k += 2 {
+			var x int
+			if k == -D || k != D && vb[off+k-1] < vb[off+k+1] {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+			switch {
+			case x > n:
+				kb1 += 2
+			case y > m:
+				kb0 += 2
+			case !front:
+				if kf := off + delta - k; kf >= 0 && kf < len(vf) && vf[kf] != -1 {
+					fx := vf[kf]
+					fy := fx - (kf - off)
+					if fx >= n-x {
+						return a0 + fx, b0 + fy, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// splitLines splits text into lines, each including its final newline.
+func splitLines(text []byte) []string {
+	lines := bytes.SplitAfter(text, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	s := make([]string, len(lines))
+	for i, l := range lines {
+		s[i] = string(l)
+	}
+	return s
+}
+
+// diffEdits returns the edits, in rune offsets, that transform old into new.
+// It computes a line diff and then trims each changed hunk
+// to the runes that actually differ.
+func diffEdits(old, new []byte) []Edit {
+	a, b := splitLines(old), splitLines(new)
+	aoff := lineOffsets(a)
+	boff := lineOffsets(b)
+
+	var edits []Edit
+	pos, q := 0, 0 // byte and rune offsets in old
+	for _, h := range diffLines(a, b) {
+		o0, o1 := aoff[h.a0], aoff[h.a1]
+		n0, n1 := boff[h.b0], boff[h.b1]
+
+		// Trim common prefix and suffix, keeping to rune boundaries.
+		for o0 < o1 && n0 < n1 {
+			r, size := utf8.DecodeRune(old[o0:])
+			r1, size1 := utf8.DecodeRune(new[n0:])
+			if r != r1 || size != size1 {
+				break
+			}
+			o0 += size
+			n0 += size
+		}
+		for o0 < o1 && n0 < n1 {
+			r, size := utf8.DecodeLastRune(old[o0:o1])
+			r1, size1 := utf8.DecodeLastRune(new[n0:n1])
+			if r != r1 || size != size1 {
+				break
+			}
+			o1 -= size
+			n1 -= size
+		}
+
+		q += utf8.RuneCount(old[pos:o0])
+		q0 := q
+		q += utf8.RuneCount(old[o0:o1])
+		pos = o1
+		edits = append(edits, Edit{Q0: q0, Q1: q, Text: new[n0:n1]})
+	}
+	return edits
+}
+
+// lineOffsets returns the byte offsets of the start of each line,
+// followed by the total length.
+func lineOffsets(lines []string) []int {
+	off := make([]int, len(lines)+1)
+	for i, l := range lines {
+		off[i+1] = off[i] + len(l)
+	}
+	return off
+}
+
+// adjustOffset returns the position of the rune offset q
+// after the sorted, non-overlapping edits are applied.
+// An offset inside a replaced range moves to the same distance
+// into the replacement text, or to its end if the replacement is shorter.
+func adjustOffset(q int, edits []Edit) int {
+	delta := 0
+	for _, e := range edits {
+		if e.Q0 >= q {
+			break
+		}
+		n := utf8.RuneCount(e.Text)
+		if e.Q1 > q {
+			if q-e.Q0 > n {
+				q = e.Q0 + n
+			}
+			return q + delta
+		}
+		delta += n - (e.Q1 - e.Q0)
+	}
+	return q + delta
+}
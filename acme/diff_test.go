@@ -0,0 +1,155 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// applyEdits applies the sorted edits to text, as acme would.
+func applyEdits(text string, edits []Edit) string {
+	r := []rune(text)
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		r = append(r[:e.Q0], append([]rune(string(e.Text)), r[e.Q1:]...)...)
+	}
+	return string(r)
+}
+
+var diffTests = []struct {
+	old, new string
+	nedit    int
+}{
+	{"", "", 0},
+	{"a\nb\nc\n", "a\nb\nc\n", 0},
+	{"", "hello\n", 1},
+	{"hello\n", "", 1},
+	{"a\nb\nc\n", "a\nc\n", 1},
+	{"a\nb\nc\n", "a\nb\nx\nc\n", 1},
+	{"a\nb\nc\nd\ne\n", "x\nb\nc\nd\ny\n", 2},
+	{"func f() {\n\treturn  1\n}\n", "func f() {\n\treturn 1\n}\n", 1},
+	{"héllo wörld\n", "héllo world\n", 1},
+	{"日本\n語\n", "日本\n語\n中文\n", 1},
+	{"no newline", "no newline at end", 1},
+	{"a\nb\na\nb\na\n", "b\na\nb\na\nb\n", 2},
+}
+
+func TestDiffEdits(t *testing.T) {
+	for _, tt := range diffTests {
+		edits := diffEdits([]byte(tt.old), []byte(tt.new))
+		if got := applyEdits(tt.old, edits); got != tt.new {
+			t.Errorf("diffEdits(%q, %q) produced %q", tt.old, tt.new, got)
+		}
+		if len(edits) != tt.nedit {
+			t.Errorf("diffEdits(%q, %q) = %d edits, want %d: %+v", tt.old, tt.new, len(edits), tt.nedit, edits)
+		}
+		if _, err := sortEdits(edits); err != nil {
+			t.Errorf("diffEdits(%q, %q): %v", tt.old, tt.new, err)
+		}
+	}
+}
+
+// lcsLen returns the length of the longest common subsequence of a and b.
+func lcsLen(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func TestDiffLinesRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		s := make([]string, rnd.Intn(30))
+		for i := range s {
+			s[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		return s
+	}
+	for i := 0; i < 1000; i++ {
+		a, b := lines(), lines()
+		hunks := diffLines(a, b)
+		// Apply the hunks and count the lines kept.
+		var out []string
+		ai, kept := 0, 0
+		for _, h := range hunks {
+			out = append(out, a[ai:h.a0]...)
+			kept += h.a0 - ai
+			out = append(out, b[h.b0:h.b1]...)
+			ai = h.a1
+		}
+		out = append(out, a[ai:]...)
+		kept += len(a) - ai
+		if strings.Join(out, "") != strings.Join(b, "") {
+			t.Fatalf("diffLines(%q, %q) = %v, produces %q", a, b, hunks, out)
+		}
+		if want := lcsLen(a, b); kept != want {
+			t.Fatalf("diffLines(%q, %q) keeps %d lines, want %d", a, b, kept, want)
+		}
+	}
+}
+
+func TestDiffLinesMemory(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 4000; i++ {
+		b = append(b, fmt.Sprintf("line %d\n", i))
+	}
+	for i := 0; i < 2000; i++ {
+		a = append(a, fmt.Sprintf("old %d\n", i))
+	}
+	for _, tt := range []struct{ a, b []string }{{nil, b}, {a, b[:2000]}, {a, b}} {
+		var m0, m1 runtime.MemStats
+		runtime.ReadMemStats(&m0)
+		diffLines(tt.a, tt.b)
+		runtime.ReadMemStats(&m1)
+		if n := m1.TotalAlloc - m0.TotalAlloc; n > 4<<20 {
+			t.Errorf("diffLines of %d and %d lines allocated %d bytes", len(tt.a), len(tt.b), n)
+		}
+	}
+}
+
+func TestDiffEditsMinimal(t *testing.T) {
+	edits := diffEdits([]byte("héllo wörld\n"), []byte("héllo world\n"))
+	if len(edits) != 1 || edits[0].Q0 != 7 || edits[0].Q1 != 8 || string(edits[0].Text) != "o" {
+		t.Errorf("diffEdits = %+v, want single rune replacement at #7,#8", edits)
+	}
+}
+
+func TestAdjustOffset(t *testing.T) {
+	edits := []Edit{
+		{Q0: 2, Q1: 4, Text: []byte("xyz")},
+		{Q0: 10, Q1: 10, Text: []byte("ab")},
+		{Q0: 12, Q1: 20},
+	}
+	tests := []struct{ q, want int }{
+		{0, 0},
+		{2, 2},
+		{3, 3},
+		{4, 5},
+		{8, 9},
+		{10, 11},
+		{11, 14},
+		{15, 15},
+		{20, 15},
+		{25, 20},
+	}
+	for _, tt := range tests {
+		if got := adjustOffset(tt.q, edits); got != tt.want {
+			t.Errorf("adjustOffset(%d) = %d, want %d", tt.q, got, tt.want)
+		}
+	}
+}
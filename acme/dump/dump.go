@@ -0,0 +1,423 @@
+// Package dump reads and writes the dump files written by acme's Dump command
+// and read by its Load command.
+//
+// A dump file records acme's working directory and fonts, the position and tag
+// of each column, and for each window its column, position, selection, font and tag.
+// Dirty windows also have their body text saved, and windows run by
+// external programs record the command that recreates them (see acme.Win.Dump).
+package dump // import "9fans.net/go/acme/dump"
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"9fans.net/go/acme"
+)
+
+// A Dump is the contents of a dump file.
+type Dump struct {
+	Dir     string    // acme's working directory
+	VarFont string    // the variable-width font
+	FixFont string    // the fixed-width font
+	RowTag  string    // the tag above all the columns
+	Columns []*Column // the columns, left to right
+	Windows []*Window // the windows, column by column, top to bottom
+}
+
+// A Column describes a single column.
+type Column struct {
+	Pos float64 // the left edge, as a percentage of the row width
+	Tag string
+}
+
+// The kinds of window recorded in a dump file.
+const (
+	File  = 'f' // a clean file or directory, reloaded from disk
+	Dirty = 'F' // a window whose body is saved in the dump file
+	Exec  = 'e' // a window recreated by running a command
+	Zerox = 'x' // a copy of an earlier window
+)
+
+// A Window describes a single window.
+//
+// The meaning of DumpID depends on the kind of window.
+// For File windows it is the window ID, and for Zerox windows
+// it is the ID of the window being copied.
+// For Dirty windows acme records the window's index in its column,
+// and for Exec windows it is zero.
+type Window struct {
+	Kind   byte    // File, Dirty, Exec, or Zerox
+	Column int     // index of the window's column
+	DumpID int     // see below
+	Q0, Q1 int     // the selection in the body
+	Pos    float64 // the top edge, as a percentage of the column height
+	Font   string  // the font, if not the default
+
+	// The state reported by the window's ctl file at the time of the dump.
+	ID      int
+	TagLen  int
+	BodyLen int
+	IsDir   bool
+	IsDirty bool
+
+	Tag  string // the tag
+	Body string // the saved body, for Dirty windows
+
+	// The directory and command that recreate the window, for Exec windows.
+	DumpDir string
+	DumpCmd string
+}
+
+// Name returns the file name from the window's tag.
+func (w *Window) Name() string {
+	return acme.ParseTag(w.Tag).File
+}
+
+// Info returns the window's ID and name in the form used by acme.Windows.
+func (w *Window) Info() acme.WinInfo {
+	return acme.WinInfo{ID: w.ID, Name: w.Name()}
+}
+
+// SetName replaces the file name in the window's tag.
+func (w *Window) SetName(name string) {
+	w.Tag = quote(name) + w.Tag[nameEnd(w.Tag):]
+	w.TagLen = utf8.RuneCountInString(w.Tag)
+}
+
+// nameEnd returns the byte offset of the end of the file name in tag,
+// which may be quoted as in acme.ParseTag.
+func nameEnd(tag string) int {
+	if !strings.HasPrefix(tag, "'") {
+		if i := strings.IndexAny(tag, " \t"); i >= 0 {
+			return i
+		}
+		return len(tag)
+	}
+	for i := 1; i < len(tag); i++ {
+		if tag[i] == '\'' {
+			if i+1 < len(tag) && tag[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(tag)
+}
+
+func quote(name string) string {
+	if !strings.ContainsAny(name, " \t'") {
+		return name
+	}
+	return "'" + strings.Replace(name, "'", "''", -1) + "'"
+}
+
+// Read parses a dump file.
+func Read(r io.Reader) (*Dump, error) {
+	p := &parser{b: bufio.NewReader(r)}
+	d, err := p.dump()
+	if err != nil {
+		return nil, fmt.Errorf("dump file line %d: %v", p.line, err)
+	}
+	return d, nil
+}
+
+// ReadFile reads and parses the named dump file.
+func ReadFile(name string) (*Dump, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	d, err := Read(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return d, nil
+}
+
+type parser struct {
+	b    *bufio.Reader
+	line int
+}
+
+// readLine reads the next line, without its newline.
+func (p *parser) readLine() (string, error) {
+	s, err := p.b.ReadString('\n')
+	if err == io.EOF && s != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	p.line++
+	return strings.TrimSuffix(s, "\n"), nil
+}
+
+func (p *parser) dump() (*Dump, error) {
+	d := new(Dump)
+	var err error
+	for _, s := range []*string{&d.Dir, &d.VarFont, &d.FixFont} {
+		if *s, err = p.readLine(); err != nil {
+			return nil, unexpected(err)
+		}
+	}
+	line, err := p.readLine()
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	for _, f := range strings.Fields(line) {
+		pos, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad column position %q", f)
+		}
+		d.Columns = append(d.Columns, &Column{Pos: pos})
+	}
+
+	for {
+		line, err := p.readLine()
+		if err == io.EOF {
+			return d, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			continue
+		}
+		switch line[0] {
+		case 'w':
+			d.RowTag = strings.TrimPrefix(line[1:], " ")
+		case 'c':
+			if len(line) < 12 {
+				return nil, fmt.Errorf("short column line")
+			}
+			i, err := strconv.Atoi(strings.TrimSpace(line[1:12]))
+			if err != nil || i < 0 || i >= len(d.Columns) {
+				return nil, fmt.Errorf("bad column number %q", line[1:12])
+			}
+			d.Columns[i].Tag = strings.TrimPrefix(line[12:], " ")
+		case File, Dirty, Exec, Zerox:
+			w, err := p.window(line)
+			if err != nil {
+				return nil, err
+			}
+			d.Windows = append(d.Windows, w)
+		default:
+			return nil, fmt.Errorf("unknown record type %q", line[0])
+		}
+	}
+}
+
+func (p *parser) window(line string) (*Window, error) {
+	w := &Window{Kind: line[0]}
+	f := strings.Fields(line[1:])
+	n := 5
+	if w.Kind == Dirty {
+		n = 6
+	}
+	if len(f) < n || len(f) > n+1 {
+		return nil, fmt.Errorf("bad window line")
+	}
+	var ints []int
+	for i, s := range f[:n] {
+		if i == 4 {
+			continue
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad window line")
+		}
+		ints = append(ints, v)
+	}
+	pos, err := strconv.ParseFloat(f[4], 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad window position %q", f[4])
+	}
+	w.Column, w.DumpID, w.Q0, w.Q1, w.Pos = ints[0], ints[1], ints[2], ints[3], pos
+	if len(f) > n {
+		w.Font = f[n]
+	}
+	nbody := 0
+	if w.Kind == Dirty {
+		nbody = ints[4]
+	}
+
+	// ctl fields and tag
+	line, err = p.readLine()
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	const ctlLen = 5 * 12
+	if len(line) < ctlLen {
+		return nil, fmt.Errorf("short window tag line")
+	}
+	ctl := strings.Fields(line[:ctlLen])
+	if len(ctl) != 5 {
+		return nil, fmt.Errorf("bad window ctl fields")
+	}
+	var c [5]int
+	for i, s := range ctl {
+		if c[i], err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("bad window ctl fields")
+		}
+	}
+	w.ID, w.TagLen, w.BodyLen, w.IsDir, w.IsDirty = c[0], c[1], c[2], c[3] != 0, c[4] != 0
+	w.Tag = strings.Replace(line[ctlLen:], "\xff", "\n", -1)
+
+	if w.Kind == Dirty {
+		var b strings.Builder
+		for i := 0; i < nbody; i++ {
+			r, _, err := p.b.ReadRune()
+			if err != nil {
+				return nil, unexpected(err)
+			}
+			if r == '\n' {
+				p.line++
+			}
+			b.WriteRune(r)
+		}
+		w.Body = b.String()
+	}
+
+	if w.Kind == Exec {
+		if w.DumpDir, err = p.readLine(); err != nil {
+			return nil, unexpected(err)
+		}
+		if w.DumpCmd, err = p.readLine(); err != nil {
+			return nil, unexpected(err)
+		}
+	}
+	return w, nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Write writes d to w in the dump file format.
+func (d *Dump) Write(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "%s\n%s\n%s\n", d.Dir, d.VarFont, d.FixFont)
+	for i, c := range d.Columns {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(b, "%11.7f", c.Pos)
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(b, "w %s\n", d.RowTag)
+	for i, c := range d.Columns {
+		fmt.Fprintf(b, "c%11d %s\n", i, c.Tag)
+	}
+	for _, win := range d.Windows {
+		id := win.DumpID
+		if win.Kind == Dirty {
+			fmt.Fprintf(b, "%c%11d %11d %11d %11d %11.7f %11d %s\n", win.Kind, win.Column, id,
+				win.Q0, win.Q1, win.Pos, utf8.RuneCountInString(win.Body), win.Font)
+		} else {
+			fmt.Fprintf(b, "%c%11d %11d %11d %11d %11.7f %s\n", win.Kind, win.Column, id,
+				win.Q0, win.Q1, win.Pos, win.Font)
+		}
+		fmt.Fprintf(b, "%11d %11d %11d %11d %11d ", win.ID, win.TagLen, win.BodyLen, btoi(win.IsDir), btoi(win.IsDirty))
+		b.WriteString(strings.Replace(win.Tag, "\n", "\xff", -1))
+		b.WriteString("\n")
+		if win.Kind == Dirty {
+			b.WriteString(win.Body)
+		}
+		if win.Kind == Exec {
+			fmt.Fprintf(b, "%s\n%s\n", win.DumpDir, win.DumpCmd)
+		}
+	}
+	return b.Flush()
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Filter removes the windows for which keep returns false.
+// A Zerox window whose original is removed becomes a File window
+// in its place, and later copies of the same original refer to it,
+// so that Load still opens the file.
+func (d *Dump) Filter(keep func(w *Window) bool) {
+	// Acme records the original's window ID in the DumpID of a Zerox window.
+	moved := make(map[int]int)
+	var windows []*Window
+	for _, w := range d.Windows {
+		orig, promoted := 0, false
+		if w.Kind == Zerox {
+			if id, ok := moved[w.DumpID]; ok {
+				if id < 0 {
+					orig, promoted = w.DumpID, true
+					moved[orig] = w.ID
+					w.Kind = File
+					w.DumpID = w.ID
+				} else {
+					w.DumpID = id
+				}
+			}
+		}
+		if keep(w) {
+			windows = append(windows, w)
+			continue
+		}
+		switch {
+		case promoted:
+			// The next copy of the original takes its place.
+			moved[orig] = -1
+		case w.Kind == File || w.Kind == Dirty:
+			moved[w.ID] = -1
+		}
+	}
+	d.Windows = windows
+}
+
+// Rewrite replaces the directory prefix old with new
+// in acme's working directory, window names, and the
+// directories of Exec windows, as after moving a project.
+// It returns the number of windows changed.
+func (d *Dump) Rewrite(old, new string) int {
+	d.Dir = rewrite(d.Dir, old, new)
+	n := 0
+	for _, w := range d.Windows {
+		changed := false
+		if name := w.Name(); rewrite(name, old, new) != name {
+			w.SetName(rewrite(name, old, new))
+			changed = true
+		}
+		if dir := rewrite(w.DumpDir, old, new); dir != w.DumpDir {
+			w.DumpDir = dir
+			changed = true
+		}
+		if changed {
+			n++
+		}
+	}
+	return n
+}
+
+// rewrite replaces the path prefix old in s with new.
+// The prefix must be followed by a slash or the end of s.
+func rewrite(s, old, new string) string {
+	old = strings.TrimSuffix(old, "/")
+	new = strings.TrimSuffix(new, "/")
+	if s == old {
+		return new
+	}
+	if strings.HasPrefix(s, old+"/") {
+		return new + s[len(old):]
+	}
+	return s
+}
@@ -0,0 +1,158 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sample = "" +
+	"/home/gopher\n" +
+	"/lib/font/bit/lucsans/euro.8.font\n" +
+	"/lib/font/bit/lucm/unicode.9.font\n" +
+	"  0.0000000  50.0000000\n" +
+	"w Newcol Kill Putall Dump Exit\n" +
+	"c          0 New Cut Paste Snarf Sort Zerox Delcol\n" +
+	"c          1 New Cut Paste Snarf Sort Zerox Delcol\n" +
+	"f          0           5          10          12   0.0000000 \n" +
+	"          5          42         300           0           0 /home/gopher/proj/main.go Del Snarf | Look\n" +
+	"F          0           1           0           0  40.0000000          11 /lib/font/bit/lucm/unicode.9.font\n" +
+	"          7          45          11           0           1 /home/gopher/proj/notes Del Snarf Undo | Look\n" +
+	"héllo\n" +
+	"worldx          1           5           0           0   0.0000000 \n" +
+	"          9          42         300           0           0 /home/gopher/proj/main.go Del Snarf | Look\n" +
+	"e          1           0           0           0  60.0000000 \n" +
+	"         11          40           0           0           0 /home/gopher/proj/-win Del Snarf | Send\xff\n" +
+	"/home/gopher/proj\n" +
+	"win\n"
+
+func TestRoundTrip(t *testing.T) {
+	d, err := Read(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != sample {
+		t.Errorf("Write after Read:\n%q\nwant:\n%q", buf.String(), sample)
+	}
+}
+
+func TestRead(t *testing.T) {
+	d, err := Read(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Dir != "/home/gopher" || d.RowTag != "Newcol Kill Putall Dump Exit" {
+		t.Errorf("Dir, RowTag = %q, %q", d.Dir, d.RowTag)
+	}
+	if len(d.Columns) != 2 || d.Columns[1].Pos != 50 || d.Columns[1].Tag != "New Cut Paste Snarf Sort Zerox Delcol" {
+		t.Errorf("Columns = %+v", d.Columns)
+	}
+	var kinds []byte
+	var names []string
+	for _, w := range d.Windows {
+		kinds = append(kinds, w.Kind)
+		names = append(names, w.Name())
+	}
+	if string(kinds) != "fFxe" {
+		t.Errorf("kinds = %q, want %q", kinds, "fFxe")
+	}
+	wantNames := []string{"/home/gopher/proj/main.go", "/home/gopher/proj/notes", "/home/gopher/proj/main.go", "/home/gopher/proj/-win"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("names = %q, want %q", names, wantNames)
+	}
+	f := d.Windows[1]
+	if f.Body != "héllo\nworld" || !f.IsDirty || f.Font != "/lib/font/bit/lucm/unicode.9.font" || f.Pos != 40 {
+		t.Errorf("dirty window = %+v", f)
+	}
+	e := d.Windows[3]
+	if e.DumpDir != "/home/gopher/proj" || e.DumpCmd != "win" || !strings.HasSuffix(e.Tag, "\n") {
+		t.Errorf("exec window = %+v", e)
+	}
+	if info := d.Windows[0].Info(); info.ID != 5 || info.Name != "/home/gopher/proj/main.go" {
+		t.Errorf("Info = %+v", info)
+	}
+
+	for _, bad := range []string{
+		"",
+		"dir\nfont\nfont\nx\n",
+		sample[:len(sample)-5],
+		strings.Replace(sample, "\nf ", "\nq ", 1),
+	} {
+		if _, err := Read(strings.NewReader(bad)); err == nil {
+			t.Errorf("Read(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	d, err := Read(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Filter(func(w *Window) bool { return w.ID != 5 && w.Kind != Exec })
+	var got []string
+	for _, w := range d.Windows {
+		got = append(got, string(w.Kind)+w.Name())
+	}
+	want := []string{"F/home/gopher/proj/notes", "f/home/gopher/proj/main.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after Filter: %q, want %q", got, want)
+	}
+	if w := d.Windows[1]; w.DumpID != w.ID {
+		t.Errorf("promoted zerox DumpID = %d, want %d", w.DumpID, w.ID)
+	}
+}
+
+func TestFilterPromotedRemoved(t *testing.T) {
+	d, err := Read(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Add a second zerox of main.go after the first.
+	w := *d.Windows[2]
+	w.ID = 13
+	d.Windows = append(d.Windows, &w)
+
+	// Removing the original and the first zerox promotes the second.
+	d.Filter(func(w *Window) bool { return w.ID != 5 && w.ID != 9 })
+	var got []string
+	for _, w := range d.Windows {
+		got = append(got, fmt.Sprintf("%c%d/%d", w.Kind, w.ID, w.DumpID))
+	}
+	want := []string{"F7/1", "e11/0", "f13/13"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after Filter: %q, want %q", got, want)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	d, err := Read(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := d.Rewrite("/home/gopher/proj", "/home/gopher/my proj/"); n != 4 {
+		t.Errorf("Rewrite changed %d windows, want 4", n)
+	}
+	if d.Dir != "/home/gopher" {
+		t.Errorf("Dir = %q", d.Dir)
+	}
+	w := d.Windows[0]
+	if w.Tag != "'/home/gopher/my proj/main.go' Del Snarf | Look" || w.TagLen != len(w.Tag) {
+		t.Errorf("tag = %q (%d)", w.Tag, w.TagLen)
+	}
+	if w.Name() != "/home/gopher/my proj/main.go" {
+		t.Errorf("Name = %q", w.Name())
+	}
+	if d.Windows[3].DumpDir != "/home/gopher/my proj" {
+		t.Errorf("DumpDir = %q", d.Windows[3].DumpDir)
+	}
+	if n := d.Rewrite("/home/gopher/pro", "/x"); n != 0 {
+		t.Errorf("Rewrite of partial element changed %d windows", n)
+	}
+}
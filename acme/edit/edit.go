@@ -0,0 +1,546 @@
+// Package edit implements the structural regular expression command language
+// used by acme's Edit command and by sam.
+//
+// A script is a sequence of commands, each optionally preceded by an address
+// (see package 9fans.net/go/acme/addr) that sets dot for the command.
+// The commands are
+//
+//	a/text/	append text after dot
+//	i/text/	insert text before dot
+//	c/text/	change dot to text
+//	d	delete dot
+//	s/re/text/	substitute text for the first match of re in dot;
+//		s/re/text/g substitutes for all matches, and sN/re/text/ for the Nth
+//	x/re/ cmd	run cmd with dot set to each match of re in dot
+//	y/re/ cmd	run cmd with dot set to each text between matches of re in dot
+//	g/re/ cmd	run cmd if dot contains a match of re
+//	v/re/ cmd	run cmd if dot does not contain a match of re
+//	p	print the text of dot
+//	=	print the line address of dot; =# prints the rune address
+//	{ cmds }	run each of cmds with the same dot
+//
+// The text for a, i and c may also be given on the following lines,
+// terminated by a line containing only a period.
+// In the text and in substitutions, \n stands for a newline;
+// in substitutions, & stands for the matched text and \1 through \9
+// for the text matched by parenthesized subexpressions.
+//
+// As in sam, commands do not modify the text as they run.
+// Instead they record changes, expressed in terms of the original text,
+// which must not overlap and are applied together once the script is done.
+package edit // import "9fans.net/go/acme/edit"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"9fans.net/go/acme/addr"
+)
+
+// A Change records that the runes [Q0, Q1) of the original text
+// are to be replaced by Text.
+type Change struct {
+	Q0, Q1 int
+	Text   string
+}
+
+// A File is the text on which a script runs.
+type File struct {
+	Name string     // the file name, printed by =
+	Text []rune     // the text
+	Dot  addr.Range // the current selection
+}
+
+// A Script is a parsed sequence of commands.
+type Script struct {
+	src  string
+	cmds []*cmd
+}
+
+type cmd struct {
+	addr   *addr.Addr
+	c      byte
+	re     *regexp.Regexp
+	text   string // text for a, c, i; replacement for s
+	n      int    // s: which match to replace
+	global bool   // s: replace all matches
+	sharp  bool   // =: print rune address
+	sub    *cmd   // command for x, y, g, v
+	group  []*cmd // commands for {
+}
+
+// String returns the text from which s was parsed.
+func (s *Script) String() string {
+	return s.src
+}
+
+var errChanges = errors.New("changes out of sequence")
+
+// Parse parses the script.
+func Parse(script string) (*Script, error) {
+	p := &parser{s: script}
+	cmds, err := p.cmds(false)
+	if err != nil {
+		return nil, err
+	}
+	return &Script{src: script, cmds: cmds}, nil
+}
+
+// Run parses and runs the script on f, writing any output to out.
+// It returns the changes the script makes, in increasing order.
+func Run(script string, f *File, out io.Writer) ([]Change, error) {
+	s, err := Parse(script)
+	if err != nil {
+		return nil, err
+	}
+	return s.Run(f, out)
+}
+
+// Run runs the script on f, writing any output to out.
+// It returns the changes the script makes, in increasing order.
+// It does not modify f.
+func (s *Script) Run(f *File, out io.Writer) ([]Change, error) {
+	if f.Dot.Q0 < 0 || f.Dot.Q1 < f.Dot.Q0 || f.Dot.Q1 > len(f.Text) {
+		return nil, addr.ErrRange
+	}
+	x := &execer{f: f, t: addr.NewText(f.Text), out: out}
+	for _, c := range s.cmds {
+		if err := x.run(c, f.Dot); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(x.changes, func(i, j int) bool {
+		return x.changes[i].Q0 < x.changes[j].Q0
+	})
+	for i := 1; i < len(x.changes); i++ {
+		if x.changes[i].Q0 < x.changes[i-1].Q1 {
+			return nil, errChanges
+		}
+	}
+	return x.changes, nil
+}
+
+// Apply returns the result of applying the changes,
+// which must be in increasing order and not overlap, to text.
+func Apply(text []rune, changes []Change) []rune {
+	var out []rune
+	q := 0
+	for _, c := range changes {
+		out = append(out, text[q:c.Q0]...)
+		out = append(out, []rune(c.Text)...)
+		q = c.Q1
+	}
+	return append(out, text[q:]...)
+}
+
+type parser struct {
+	s      string
+	pos    int
+	lastRE *regexp.Regexp
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(format, args...)
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) skipSpace(newlines bool) {
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c != ' ' && c != '\t' && (!newlines || c != '\n') {
+			break
+		}
+		p.pos++
+	}
+}
+
+// cmds parses a sequence of commands,
+// up to the end of the input or, if inGroup is set, a closing brace.
+func (p *parser) cmds(inGroup bool) ([]*cmd, error) {
+	var cmds []*cmd
+	for {
+		p.skipSpace(true)
+		if p.pos >= len(p.s) {
+			if inGroup {
+				return nil, p.errorf("missing }")
+			}
+			return cmds, nil
+		}
+		if p.peek() == '}' {
+			if !inGroup {
+				return nil, p.errorf("unexpected }")
+			}
+			p.pos++
+			return cmds, nil
+		}
+		c, err := p.cmd()
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, c)
+	}
+}
+
+func (p *parser) cmd() (*cmd, error) {
+	p.skipSpace(false)
+	a, rest, err := addr.ParsePrefix(p.s[p.pos:])
+	if err != nil {
+		return nil, err
+	}
+	p.pos = len(p.s) - len(rest)
+	p.skipSpace(false)
+
+	c := &cmd{addr: a, c: p.peek()}
+	switch c.c {
+	case 0, '\n', '}':
+		if a == nil {
+			return nil, p.errorf("missing command")
+		}
+		// A bare address just sets dot.
+		c.c = 0
+		return c, nil
+	}
+	p.pos++
+	switch c.c {
+	case 'a', 'i', 'c':
+		c.text, err = p.text()
+	case 'd', 'p':
+		// no arguments
+	case '=':
+		if p.peek() == '#' {
+			p.pos++
+			c.sharp = true
+		}
+	case 's':
+		c.n = 1
+		if n := p.number(); n > 0 {
+			c.n = n
+		}
+		var delim byte
+		c.re, delim, err = p.regexp()
+		if err != nil {
+			return nil, err
+		}
+		c.text = p.delimited(delim, false)
+		if p.peek() == 'g' {
+			p.pos++
+			c.global = true
+		}
+	case 'x', 'y', 'g', 'v':
+		d := p.peek()
+		if (c.c == 'x' || c.c == 'y') && (d == 0 || d == ' ' || d == '\t' || d == '\n' || d == '{' || isLetter(d)) {
+			// x with no regexp loops over lines.
+			c.re = regexp.MustCompile(`(?m:.*(?:\n|\z))`)
+		} else {
+			c.re, _, err = p.regexp()
+			if err != nil {
+				return nil, err
+			}
+		}
+		p.skipSpace(false)
+		if d := p.peek(); d == 0 || d == '\n' || d == '}' {
+			if c.c == 'g' || c.c == 'v' {
+				return nil, p.errorf("missing command after %c", c.c)
+			}
+			c.sub = &cmd{c: 'p'}
+		} else {
+			c.sub, err = p.cmd()
+		}
+	case '{':
+		c.group, err = p.cmds(true)
+	default:
+		return nil, p.errorf("unknown command %c", c.c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func (p *parser) number() int {
+	n := 0
+	for p.pos < len(p.s) && '0' <= p.s[p.pos] && p.s[p.pos] <= '9' {
+		n = n*10 + int(p.s[p.pos]-'0')
+		p.pos++
+	}
+	return n
+}
+
+// regexp parses a delimited regular expression.
+// An empty expression repeats the previous one.
+func (p *parser) regexp() (*regexp.Regexp, byte, error) {
+	delim := p.peek()
+	if delim == 0 || delim == '\n' || delim == ' ' || delim == '\\' || isLetter(delim) || '0' <= delim && delim <= '9' {
+		return nil, 0, p.errorf("bad delimiter %q", delim)
+	}
+	p.pos++
+	expr := p.delimited(delim, true)
+	if expr == "" {
+		if p.lastRE == nil {
+			return nil, 0, p.errorf("no previous regular expression")
+		}
+		return p.lastRE, delim, nil
+	}
+	re, err := addr.Compile(expr)
+	if err != nil {
+		return nil, 0, err
+	}
+	p.lastRE = re
+	return re, delim, nil
+}
+
+// delimited returns the text up to the next unquoted delim,
+// newline, or end of input, and advances past the delimiter.
+// A backslash before delim quotes it; other backslash sequences
+// are preserved for the regexp or replacement parser,
+// except that if raw is false, \n is replaced by a newline.
+func (p *parser) delimited(delim byte, raw bool) string {
+	var b strings.Builder
+	for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+		c := p.s[p.pos]
+		p.pos++
+		if c == delim {
+			return b.String()
+		}
+		if c == '\\' && p.pos < len(p.s) && p.s[p.pos] != '\n' {
+			c1 := p.s[p.pos]
+			p.pos++
+			switch {
+			case c1 == delim:
+				b.WriteByte(delim)
+			case c1 == 'n' && !raw:
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(c)
+				b.WriteByte(c1)
+			}
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// text parses the text argument of a, c, or i.
+func (p *parser) text() (string, error) {
+	p.skipSpace(false)
+	if p.pos >= len(p.s) || p.peek() == '\n' {
+		// Text on following lines, up to a line containing a single period.
+		p.pos++
+		var b strings.Builder
+		for p.pos < len(p.s) {
+			end := strings.IndexByte(p.s[p.pos:], '\n')
+			var line string
+			if end < 0 {
+				line = p.s[p.pos:]
+				p.pos = len(p.s)
+			} else {
+				line = p.s[p.pos : p.pos+end]
+				p.pos += end + 1
+			}
+			if line == "." {
+				return b.String(), nil
+			}
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+		return b.String(), nil
+	}
+	delim := p.peek()
+	if isLetter(delim) || '0' <= delim && delim <= '9' || delim == '\\' {
+		return "", p.errorf("bad delimiter %q", delim)
+	}
+	p.pos++
+	return unquote(p.delimited(delim, false)), nil
+}
+
+// unquote replaces each backslash sequence \c left by delimited with c.
+func unquote(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+type execer struct {
+	f       *File
+	t       *addr.Text
+	out     io.Writer
+	changes []Change
+	nest    int
+}
+
+func (x *execer) change(q0, q1 int, text string) {
+	x.changes = append(x.changes, Change{q0, q1, text})
+}
+
+func (x *execer) run(c *cmd, dot addr.Range) error {
+	if c.addr != nil {
+		var err error
+		dot, err = x.t.Eval(c.addr, dot)
+		if err != nil {
+			return err
+		}
+	}
+	switch c.c {
+	case 0:
+		// Address only.
+	case 'a':
+		x.change(dot.Q1, dot.Q1, c.text)
+	case 'i':
+		x.change(dot.Q0, dot.Q0, c.text)
+	case 'c':
+		x.change(dot.Q0, dot.Q1, c.text)
+	case 'd':
+		x.change(dot.Q0, dot.Q1, "")
+	case 'p':
+		if x.out != nil {
+			io.WriteString(x.out, string(x.f.Text[dot.Q0:dot.Q1]))
+		}
+	case '=':
+		if x.out != nil {
+			x.printAddr(dot, c.sharp)
+		}
+	case 's':
+		return x.substitute(c, dot)
+	case 'x', 'y':
+		x.nest++
+		defer func() { x.nest-- }()
+		matches := x.t.FindAll(c.re, dot)
+		if c.c == 'x' {
+			for _, m := range matches {
+				if err := x.run(c.sub, addr.Range{Q0: m[0], Q1: m[1]}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		q := dot.Q0
+		for _, m := range matches {
+			if err := x.run(c.sub, addr.Range{Q0: q, Q1: m[0]}); err != nil {
+				return err
+			}
+			q = m[1]
+		}
+		return x.run(c.sub, addr.Range{Q0: q, Q1: dot.Q1})
+	case 'g', 'v':
+		found := c.re.MatchString(string(x.f.Text[dot.Q0:dot.Q1]))
+		if found == (c.c == 'g') {
+			x.nest++
+			defer func() { x.nest-- }()
+			return x.run(c.sub, dot)
+		}
+	case '{':
+		for _, sub := range c.group {
+			if err := x.run(sub, dot); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (x *execer) substitute(c *cmd, dot addr.Range) error {
+	n := 0
+	did := false
+	for _, m := range x.t.FindAll(c.re, dot) {
+		n++
+		if !c.global && n != c.n {
+			continue
+		}
+		x.change(m[0], m[1], x.expand(c.text, m))
+		did = true
+		if !c.global {
+			break
+		}
+	}
+	if !did && x.nest == 0 {
+		return errors.New("no substitution")
+	}
+	return nil
+}
+
+// expand returns the replacement text repl for the match m,
+// interpreting & and \1 through \9.
+func (x *execer) expand(repl string, m []int) string {
+	var b strings.Builder
+	text := x.f.Text
+	for i := 0; i < len(repl); i++ {
+		c := repl[i]
+		switch {
+		case c == '&':
+			b.WriteString(string(text[m[0]:m[1]]))
+		case c == '\\' && i+1 < len(repl):
+			i++
+			c = repl[i]
+			if '1' <= c && c <= '9' {
+				k := int(c - '0')
+				if 2*k+1 < len(m) && m[2*k] >= 0 {
+					b.WriteString(string(text[m[2*k]:m[2*k+1]]))
+				}
+				continue
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// printAddr prints the address of dot in the form acme uses,
+// file:line or file:line,line, or, if sharp is set, file:#q0,#q1.
+func (x *execer) printAddr(dot addr.Range, sharp bool) {
+	prefix := ""
+	if x.f.Name != "" {
+		prefix = x.f.Name + ":"
+	}
+	if sharp {
+		if dot.Q0 == dot.Q1 {
+			fmt.Fprintf(x.out, "%s#%d\n", prefix, dot.Q0)
+		} else {
+			fmt.Fprintf(x.out, "%s#%d,#%d\n", prefix, dot.Q0, dot.Q1)
+		}
+		return
+	}
+	text := x.f.Text
+	l0 := 1
+	for _, r := range text[:dot.Q0] {
+		if r == '\n' {
+			l0++
+		}
+	}
+	l1 := l0
+	for q := dot.Q0; q < dot.Q1; q++ {
+		// A range ending just after a newline ends on that line.
+		if text[q] == '\n' && q+1 < dot.Q1 {
+			l1++
+		}
+	}
+	if l0 == l1 {
+		fmt.Fprintf(x.out, "%s%d\n", prefix, l0)
+	} else {
+		fmt.Fprintf(x.out, "%s%d,%d\n", prefix, l0, l1)
+	}
+}
@@ -0,0 +1,75 @@
+package edit
+
+import (
+	"bytes"
+	"testing"
+
+	"9fans.net/go/acme/addr"
+)
+
+var runTests = []struct {
+	script string
+	text   string
+	q0, q1 int // dot
+	out    string
+	print  string
+	err    string
+}{
+	{",d", "hello\nworld\n", 0, 0, "", "", ""},
+	{"c/bye/", "hello\n", 0, 5, "bye\n", "", ""},
+	{"a/!/", "hello\n", 0, 5, "hello!\n", "", ""},
+	{"i/>/", "hello\n", 0, 5, ">hello\n", "", ""},
+	{",x/o/c/0/", "foo boo\n", 0, 0, "f00 b00\n", "", ""},
+	{",x/[a-z]+/ i/</", "ab cd\n", 0, 0, "<ab <cd\n", "", ""},
+	{",y/ / c/x/", "ab cd ef", 0, 0, "x x x", "", ""},
+	{",x g/b/ d", "abc\ndef\nbcd\n", 0, 0, "def\n", "", ""},
+	{",x v/b/ d", "abc\ndef\nbcd\n", 0, 0, "abc\nbcd\n", "", ""},
+	{",s/o/0/", "foo boo\n", 0, 0, "f0o boo\n", "", ""},
+	{",s/o/0/g", "foo boo\n", 0, 0, "f00 b00\n", "", ""},
+	{",s3/o/0/", "foo boo\n", 0, 0, "foo b0o\n", "", ""},
+	{",s/(\\w+) (\\w+)/\\2 \\1 [&]/", "foo boo\n", 0, 0, "boo foo [foo boo]\n", "", ""},
+	{",s/ /\\n/g", "a b c", 0, 0, "a\nb\nc", "", ""},
+	{",s/x/y/", "abc", 0, 0, "", "", "no substitution"},
+	{",x/a/ s/x/y/", "abc", 0, 0, "abc", "", ""},
+	{"2d", "one\ntwo\nthree\n", 0, 0, "one\nthree\n", "", ""},
+	{"/two/,/three/d", "one\ntwo\nthree\n", 0, 0, "one\n\n", "", ""},
+	{",x/t.*/ { i/[/ a/]/ }", "one\ntwo\nthree\n", 0, 0, "one\n[two]\n[three]\n", "", ""},
+	{"{\n\ta/]/\n\ti/[/\n}", "x", 0, 1, "[x]", "", ""},
+	{"a\nline one\nline two\n.\n", "x\n", 0, 2, "x\nline one\nline two\n", "", ""},
+	{"c/a\\/b/", "x", 0, 1, "a/b", "", ""},
+	{"c/a\\\\nb/", "x", 0, 1, "a\\nb", "", ""},
+	{",x/o/p", "foo\n", 0, 0, "foo\n", "oo", ""},
+	{",x/o/", "foo\n", 0, 0, "foo\n", "oo", ""},
+	{"/two/=", "one\ntwo\n", 0, 0, "one\ntwo\n", "f:2\n", ""},
+	{"/two/=#", "one\ntwo\n", 0, 0, "one\ntwo\n", "f:#4,#7\n", ""},
+	{",=", "one\ntwo\n", 0, 0, "one\ntwo\n", "f:1,2\n", ""},
+	{"{ c/a/ c/b/ }", "x", 0, 1, "", "", "changes out of sequence"},
+	{",x/o/ c/0/ z", "fo", 0, 0, "", "", "unknown command z"},
+	{"q", "x", 0, 0, "", "", "unknown command q"},
+	{"{ d", "x", 0, 0, "", "", "missing }"},
+	{"/zzz/d", "x", 0, 0, "", "", "no match for regexp"},
+}
+
+func TestRun(t *testing.T) {
+	for _, tt := range runTests {
+		f := &File{Name: "f", Text: []rune(tt.text), Dot: addr.Range{Q0: tt.q0, Q1: tt.q1}}
+		var out bytes.Buffer
+		changes, err := Run(tt.script, f, &out)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Run(%q): err = %v, want %q", tt.script, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Run(%q): %v", tt.script, err)
+			continue
+		}
+		if got := string(Apply(f.Text, changes)); got != tt.out {
+			t.Errorf("Run(%q) on %q = %q, want %q", tt.script, tt.text, got, tt.out)
+		}
+		if out.String() != tt.print {
+			t.Errorf("Run(%q) printed %q, want %q", tt.script, out.String(), tt.print)
+		}
+	}
+}
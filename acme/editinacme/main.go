@@ -6,10 +6,19 @@
 //
 // Usage:
 //
-//	editinacme <file>
+//	editinacme [-wait del|put] [+line] file[:addr] ...
 //
-// Editinacme uses the plumber to ask acme to open the file,
-// waits until the file's acme window is deleted, and exits.
+// Editinacme uses the plumber to ask acme to open each file,
+// waits until every file's acme window is deleted, and exits.
+// With -wait put, editinacme instead waits until each file is
+// written with Put (or its window deleted), which suits editors
+// run by commit hooks.
+//
+// A file name may be followed by an acme address, as in file.go:12,
+// file.go:12:5, file.go:#123, or file.go:/regexp/, or preceded by
+// an argument +line, as vi accepts, to select that text in the window.
+//
+// If the plumber is not running, editinacme opens the windows itself.
 package main
 
 import (
@@ -19,53 +28,164 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 
 	"9fans.net/go/acme"
 )
 
+var wait = flag.String("wait", "del", "wait for `event` (del or put) on each file")
+
+// A file is a file to edit, with an optional acme address.
+type file struct {
+	name string
+	addr string
+}
+
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("editinacme: ")
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "usage: editinacme file\n")
+		fmt.Fprintf(os.Stderr, "usage: editinacme [-wait del|put] [+line] file[:addr] ...\n")
 		os.Exit(2)
 	}
 	flag.Parse()
-	if flag.NArg() != 1 {
+	if flag.NArg() == 0 || *wait != "del" && *wait != "put" {
 		flag.Usage()
 	}
 
-	file := flag.Arg(0)
-	_, err := os.Stat(file)
+	files, err := parseArgs(flag.Args(), exists)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fullpath, err := filepath.Abs(file)
-	if err != nil {
-		log.Fatal(err)
-	}
-	file = fullpath
-
 	r, err := acme.Log()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	log.Printf("editing %s", file)
-
-	out, err := exec.Command("plumb", "-d", "edit", file).CombinedOutput()
-	if err != nil {
-		log.Fatalf("executing plumb: %v\n%s", err, out)
+	pending := make(map[string]bool)
+	for _, f := range files {
+		log.Printf("editing %s", f.name)
+		if err := open(f); err != nil {
+			log.Fatal(err)
+		}
+		pending[f.name] = true
 	}
 
-	for {
+	for len(pending) > 0 {
 		ev, err := r.Read()
 		if err != nil {
 			log.Fatalf("reading acme log: %v", err)
 		}
-		if ev.Op == "del" && ev.Name == file {
+		if (ev.Op == *wait || ev.Op == "del") && pending[ev.Name] {
+			delete(pending, ev.Name)
+		}
+	}
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+var (
+	lineArgRE = regexp.MustCompile(`^\+(\d+)$`)
+	addrRE    = regexp.MustCompile(`^(.+?):((\d+)(?::(\d+))?|#\d+|/.*/?)$`)
+)
+
+// parseArgs parses the command-line arguments into files with absolute names.
+// A name with an address suffix is taken as a file name alone
+// if exists reports that the whole argument names a file.
+func parseArgs(args []string, exists func(string) bool) ([]file, error) {
+	var files []file
+	addr := ""
+	for _, arg := range args {
+		if m := lineArgRE.FindStringSubmatch(arg); m != nil {
+			addr = m[1]
+			continue
+		}
+		f := file{name: arg, addr: addr}
+		addr = ""
+		if m := addrRE.FindStringSubmatch(arg); m != nil && !exists(arg) {
+			f.name = m[1]
+			f.addr = m[2]
+			if m[4] != "" {
+				// line:column
+				col, _ := strconv.Atoi(m[4])
+				f.addr = m[3]
+				if col > 1 {
+					f.addr += "-#0+#" + strconv.Itoa(col-1)
+				}
+			}
+		}
+		if !exists(f.name) {
+			return nil, fmt.Errorf("%s: no such file", f.name)
+		}
+		name, err := filepath.Abs(f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.name = name
+		files = append(files, f)
+	}
+	if addr != "" {
+		return nil, fmt.Errorf("+%s: missing file name", addr)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files")
+	}
+	return files, nil
+}
+
+// open asks acme to show f, using the plumber if possible.
+func open(f file) error {
+	args := []string{"-d", "edit"}
+	if f.addr != "" {
+		args = append(args, "-a", "addr="+f.addr)
+	}
+	args = append(args, f.name)
+	out, err := exec.Command("plumb", args...).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	log.Printf("plumb: %v %s; opening window directly", err, out)
+	return openWin(f)
+}
+
+// openWin shows f in its existing acme window, if any,
+// or else in a new window, without the plumber.
+func openWin(f file) error {
+	var w *acme.Win
+	wins, err := acme.Windows()
+	if err != nil {
+		return err
+	}
+	for _, info := range wins {
+		if info.Name == f.name {
+			if w, err = acme.Open(info.ID, nil); err != nil {
+				return err
+			}
 			break
 		}
 	}
+	if w == nil {
+		if w, err = acme.New(); err != nil {
+			return err
+		}
+		if err := w.Name("%s", f.name); err != nil {
+			return err
+		}
+		if err := w.Get(); err != nil {
+			return err
+		}
+	}
+	defer w.CloseFiles()
+	if f.addr != "" {
+		if err := w.Addr("%s", f.addr); err != nil {
+			return fmt.Errorf("%s:%s: %v", f.name, f.addr, err)
+		}
+		w.DotToAddr()
+	}
+	return w.Show()
 }
@@ -0,0 +1,46 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	existing := map[string]bool{
+		"/a/x.go":   true,
+		"/a/y.go":   true,
+		"/a/odd:12": true,
+		"/a/COMMIT": true,
+	}
+	exists := func(name string) bool { return existing[name] }
+
+	tests := []struct {
+		args []string
+		want []file
+	}{
+		{[]string{"/a/x.go"}, []file{{"/a/x.go", ""}}},
+		{[]string{"/a/x.go:12", "/a/y.go"}, []file{{"/a/x.go", "12"}, {"/a/y.go", ""}}},
+		{[]string{"/a/x.go:12:5"}, []file{{"/a/x.go", "12-#0+#4"}}},
+		{[]string{"/a/x.go:3:1"}, []file{{"/a/x.go", "3"}}},
+		{[]string{"/a/x.go:#40"}, []file{{"/a/x.go", "#40"}}},
+		{[]string{"/a/x.go:/func main/"}, []file{{"/a/x.go", "/func main/"}}},
+		{[]string{"+7", "/a/COMMIT", "/a/x.go"}, []file{{"/a/COMMIT", "7"}, {"/a/x.go", ""}}},
+		{[]string{"/a/odd:12"}, []file{{"/a/odd:12", ""}}},
+	}
+	for _, tt := range tests {
+		got, err := parseArgs(tt.args, exists)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseArgs(%q) = %v, %v, want %v", tt.args, got, err, tt.want)
+		}
+	}
+
+	for _, bad := range [][]string{{"/a/none"}, {"/a/none:12"}, {"/a/x.go", "+3"}, {}} {
+		if got, err := parseArgs(bad, exists); err == nil {
+			t.Errorf("parseArgs(%q) = %v, want error", bad, got)
+		}
+	}
+}
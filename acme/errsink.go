@@ -0,0 +1,218 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An ErrorSink reports errors in +Errors windows, like Err,
+// but without blocking its callers.
+//
+// Messages are buffered and written to each window in batches,
+// at most once per Interval. A message repeated consecutively is
+// written once, followed by a note of how many times it was repeated,
+// and messages beyond MaxPending in a single batch are dropped and counted.
+// If a window cannot be created or written, the batch is written to
+// Fallback if it is non-nil, and otherwise the error is returned
+// by the next call to Flush or Close.
+//
+// The zero ErrorSink is ready to use.
+// An ErrorSink is safe for use by multiple goroutines.
+type ErrorSink struct {
+	Interval   time.Duration // minimum time between writes; 0 means 100ms
+	MaxPending int           // maximum messages per batch; 0 means no limit
+	Fallback   io.Writer     // where to write messages acme cannot show, such as os.Stderr
+
+	mu      sync.Mutex
+	pending map[string]*errorBatch // by window name
+	order   []string               // window names in order of first message
+	timer   *time.Timer
+	last    time.Time // time of last flush
+	err     error     // first unreported error
+
+	flushMu sync.Mutex      // serializes flushes
+	wins    map[string]*Win // windows written, by name
+	write   func(name string, text []byte) error
+}
+
+// An errorBatch holds the messages waiting to be written to a window.
+type errorBatch struct {
+	buf     bytes.Buffer
+	n       int    // messages in buf
+	last    string // last message added to buf
+	repeat  int    // times last was repeated since being added
+	dropped int
+}
+
+// Err queues msg to be shown in the +Errors window
+// for errors related to a window titled src.
+// It adds a final newline to msg if needed.
+func (s *ErrorSink) Err(src, msg string) {
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+	name := errorsName(src)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		s.pending = make(map[string]*errorBatch)
+	}
+	b := s.pending[name]
+	if b == nil {
+		b = new(errorBatch)
+		s.pending[name] = b
+		s.order = append(s.order, name)
+	}
+	b.add(msg, s.MaxPending)
+
+	if s.timer == nil {
+		interval := s.Interval
+		if interval <= 0 {
+			interval = 100 * time.Millisecond
+		}
+		delay := interval - time.Since(s.last)
+		if delay < 0 {
+			delay = 0
+		}
+		s.timer = time.AfterFunc(delay, s.flushTimer)
+	}
+}
+
+// Errf is like Err but formats the message using fmt.Sprintf.
+func (s *ErrorSink) Errf(src, format string, args ...interface{}) {
+	s.Err(src, fmt.Sprintf(format, args...))
+}
+
+func (b *errorBatch) add(msg string, max int) {
+	if msg == b.last {
+		b.repeat++
+		return
+	}
+	b.endRepeat()
+	if max > 0 && b.n >= max {
+		b.dropped++
+		return
+	}
+	b.buf.WriteString(msg)
+	b.n++
+	b.last = msg
+}
+
+func (b *errorBatch) endRepeat() {
+	if b.repeat > 0 {
+		fmt.Fprintf(&b.buf, "last message repeated %d times\n", b.repeat)
+		b.repeat = 0
+	}
+}
+
+func (b *errorBatch) text() []byte {
+	b.endRepeat()
+	if b.dropped > 0 {
+		fmt.Fprintf(&b.buf, "%d more messages dropped\n", b.dropped)
+	}
+	return b.buf.Bytes()
+}
+
+func (s *ErrorSink) flushTimer() {
+	err := s.Flush()
+	if err != nil {
+		s.mu.Lock()
+		if s.err == nil {
+			s.err = err
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Flush writes the queued messages now.
+// It returns the first error writing them to acme that could not be
+// handled by writing to Fallback, or an earlier such error
+// from a flush made in the background.
+func (s *ErrorSink) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	pending, order := s.pending, s.order
+	s.pending, s.order = nil, nil
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.last = time.Now()
+	err := s.err
+	s.err = nil
+	s.mu.Unlock()
+
+	write := s.write
+	if write == nil {
+		write = s.writeWin
+	}
+	for _, name := range order {
+		text := pending[name].text()
+		if werr := write(name, text); werr != nil {
+			if s.Fallback != nil {
+				_, werr = s.Fallback.Write(text)
+			}
+			if werr != nil && err == nil {
+				err = fmt.Errorf("writing %s: %v", name, werr)
+			}
+		}
+	}
+	return err
+}
+
+// Close flushes the queued messages and returns any error from doing so,
+// as Flush does. The windows remain open.
+func (s *ErrorSink) Close() error {
+	return s.Flush()
+}
+
+// writeWin appends text to the named window, creating it if needed.
+func (s *ErrorSink) writeWin(name string, text []byte) error {
+	if s.wins == nil {
+		s.wins = make(map[string]*Win)
+	}
+	for try := 0; ; try++ {
+		w := s.wins[name]
+		if w == nil {
+			if w = Show(name); w == nil {
+				var err error
+				if w, err = New(); err != nil {
+					return err
+				}
+				if err := w.Name("%s", name); err != nil {
+					w.CloseFiles()
+					return err
+				}
+			}
+			s.wins[name] = w
+		}
+		err := appendErrors(w, text)
+		if err == nil || try > 0 {
+			return err
+		}
+		// The window may have been deleted. Try a new one.
+		delete(s.wins, name)
+		w.CloseFiles()
+	}
+}
+
+// appendErrors adds text to the end of w and shows it.
+func appendErrors(w *Win, text []byte) error {
+	if err := w.Addr("$"); err != nil {
+		return err
+	}
+	if _, err := w.Write("data", text); err != nil {
+		return err
+	}
+	if err := w.DotToAddr(); err != nil {
+		return err
+	}
+	return w.Show()
+}
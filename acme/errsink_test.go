@@ -0,0 +1,103 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestErrorSink(t *testing.T) {
+	var mu sync.Mutex
+	var writes []string
+	s := &ErrorSink{Interval: time.Hour, MaxPending: 3}
+	s.write = func(name string, text []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		writes = append(writes, name+": "+string(text))
+		return nil
+	}
+
+	s.Err("/a/x.go", "x.go:1: bad")
+	s.Err("/a/x.go", "x.go:1: bad\n")
+	s.Err("/a/x.go", "x.go:1: bad")
+	s.Err("/b/y.go", "y.go:2: worse")
+	s.Errf("/a/z.go", "z.go:%d: bad", 3)
+	s.Err("/a/x.go", "x.go:4: bad")
+	s.Err("/a/x.go", "x.go:5: bad")
+	s.Err("/a/x.go", "x.go:6: bad")
+	if len(writes) != 0 {
+		t.Fatalf("wrote %q before interval", writes)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/a/+Errors: x.go:1: bad\nlast message repeated 2 times\nz.go:3: bad\nx.go:4: bad\n2 more messages dropped\n",
+		"/b/+Errors: y.go:2: worse\n",
+	}
+	if !reflect.DeepEqual(writes, want) {
+		t.Errorf("writes:\n%q\nwant:\n%q", writes, want)
+	}
+
+	// With a short interval, the sink flushes by itself.
+	writes = nil
+	s.Interval = time.Millisecond
+	s.Err("x.go", "x.go:7: late")
+	for i := 0; ; i++ {
+		mu.Lock()
+		n := len(writes)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if i > 1000 {
+			t.Fatal("sink did not flush")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if want := []string{"+Errors: x.go:7: late\n"}; !reflect.DeepEqual(writes, want) {
+		t.Errorf("writes = %q, want %q", writes, want)
+	}
+}
+
+func TestErrorSinkFallback(t *testing.T) {
+	s := &ErrorSink{Interval: time.Hour}
+	s.write = func(name string, text []byte) error {
+		return errors.New("no acme")
+	}
+	s.Err("/a/x.go", "x.go:1: bad")
+	err := s.Close()
+	if err == nil || err.Error() != "writing /a/+Errors: no acme" {
+		t.Errorf("Close = %v", err)
+	}
+
+	var buf bytes.Buffer
+	s.Fallback = &buf
+	for i := 0; i < 3; i++ {
+		s.Err("/a/x.go", fmt.Sprintf("x.go:%d: bad", i))
+	}
+	if err := s.Flush(); err != nil || buf.String() != "x.go:0: bad\nx.go:1: bad\nx.go:2: bad\n" {
+		t.Errorf("Flush = %v, fallback got %q", err, buf.String())
+	}
+}
+
+func TestErrFallback(t *testing.T) {
+	old := defaultSink
+	defer func() { defaultSink = old }()
+	var buf bytes.Buffer
+	defaultSink = &ErrorSink{Fallback: &buf}
+	defaultSink.write = func(name string, text []byte) error {
+		return errors.New("no acme")
+	}
+
+	// Err writes at once, and to Fallback rather than exiting.
+	Err("/a/x.go", "x.go:1: bad")
+	Errf("/a/x.go", "x.go:%d: worse", 2)
+	if want := "x.go:1: bad\nx.go:2: worse\n"; buf.String() != want {
+		t.Errorf("fallback got %q, want %q", buf.String(), want)
+	}
+}
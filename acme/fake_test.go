@@ -0,0 +1,358 @@
+// +build !plan9
+
+package acme
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"9fans.net/go/acme/addr"
+	"9fans.net/go/plan9"
+	"9fans.net/go/plan9/client"
+)
+
+// A fakeAcme serves a few windows' files over 9P,
+// enough like acme for testing the window operations.
+type fakeAcme struct {
+	mu   sync.Mutex
+	wins map[int]*fakeWin
+}
+
+// A fakeWin is a window served by a fakeAcme.
+type fakeWin struct {
+	acme     *fakeAcme
+	id       int
+	tag      []rune
+	body     []rune
+	addr     [2]int
+	dot      [2]int
+	dirty    bool
+	ctl      []string // messages written to ctl
+	errors   []byte   // text written to errors
+	writes   []int    // sizes of the writes to data and body
+	events   []string // event file data not yet read
+	eventsIn []byte   // data written to the event file
+	wake     chan struct{}
+}
+
+var fakeFiles = []string{"", "addr", "body", "ctl", "data", "errors", "event", "tag", "xdata"}
+
+// testWin returns a window with the given body and tag, served by a fakeAcme.
+// The returned function restores the connection to acme.
+func testWin(t *testing.T, body, tag string) (*Win, *fakeWin, func()) {
+	fsysOnce.Do(mountAcme)
+	oldFsys, oldErr := fsys, fsysErr
+
+	a := &fakeAcme{wins: make(map[int]*fakeWin)}
+	fw := &fakeWin{acme: a, id: 1, body: []rune(body), tag: []rune(tag), wake: make(chan struct{}, 1)}
+	a.wins[fw.id] = fw
+	c1, c2 := net.Pipe()
+	go a.serve(c1)
+	conn, err := client.NewConn(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := conn.Attach(nil, "user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, fsysErr = f, nil
+	w, err := Open(fw.id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, fw, func() {
+		conn.Close()
+		fsys, fsysErr = oldFsys, oldErr
+	}
+}
+
+// sendEvent queues event data to be read from w's event file.
+func (w *fakeWin) sendEvent(data string) {
+	w.acme.mu.Lock()
+	w.events = append(w.events, data)
+	w.acme.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+type fakeFid struct {
+	win     *fakeWin
+	file    string
+	offset  int64
+	partial []byte // incomplete UTF-8 written
+	closed  chan struct{}
+}
+
+func (a *fakeAcme) serve(c net.Conn) {
+	var (
+		wmu  sync.Mutex
+		fids = make(map[uint32]*fakeFid)
+		fmu  sync.Mutex
+	)
+	reply := func(tx, rx *plan9.Fcall) {
+		rx.Tag = tx.Tag
+		wmu.Lock()
+		plan9.WriteFcall(c, rx)
+		wmu.Unlock()
+	}
+	rerror := func(tx *plan9.Fcall, err error) {
+		reply(tx, &plan9.Fcall{Type: plan9.Rerror, Ename: err.Error()})
+	}
+	r := bufio.NewReader(c)
+	for {
+		tx, err := plan9.ReadFcall(r)
+		if err != nil {
+			return
+		}
+		fmu.Lock()
+		f := fids[tx.Fid]
+		fmu.Unlock()
+		if f == nil && tx.Type != plan9.Tversion && tx.Type != plan9.Tattach {
+			rerror(tx, errors.New("unknown fid"))
+			continue
+		}
+		switch tx.Type {
+		default:
+			rerror(tx, errors.New("unsupported"))
+		case plan9.Tversion:
+			// Like acme, limit messages to 8 kB of data.
+			msize := tx.Msize
+			if msize > 8192+plan9.IOHDRSIZE {
+				msize = 8192 + plan9.IOHDRSIZE
+			}
+			reply(tx, &plan9.Fcall{Type: plan9.Rversion, Msize: msize, Version: plan9.VERSION9P})
+		case plan9.Tattach:
+			fmu.Lock()
+			fids[tx.Fid] = &fakeFid{}
+			fmu.Unlock()
+			reply(tx, &plan9.Fcall{Type: plan9.Rattach, Qid: plan9.Qid{Type: plan9.QTDIR}})
+		case plan9.Twalk:
+			nf := *f
+			var qids []plan9.Qid
+			for _, name := range tx.Wname {
+				if nf.win == nil {
+					id, _ := strconv.Atoi(name)
+					a.mu.Lock()
+					nf.win = a.wins[id]
+					a.mu.Unlock()
+					if nf.win == nil {
+						break
+					}
+					qids = append(qids, plan9.Qid{Path: uint64(id) << 8, Type: plan9.QTDIR})
+					continue
+				}
+				if nf.file != "" || !containsString(fakeFiles, name) {
+					break
+				}
+				nf.file = name
+				qids = append(qids, plan9.Qid{Path: uint64(nf.win.id)<<8 | uint64(len(name))})
+			}
+			if len(qids) < len(tx.Wname) {
+				rerror(tx, errors.New("file does not exist"))
+				break
+			}
+			nf.closed = make(chan struct{})
+			fmu.Lock()
+			fids[tx.Newfid] = &nf
+			fmu.Unlock()
+			reply(tx, &plan9.Fcall{Type: plan9.Rwalk, Wqid: qids})
+		case plan9.Topen:
+			reply(tx, &plan9.Fcall{Type: plan9.Ropen, Iounit: 8192})
+		case plan9.Tclunk:
+			fmu.Lock()
+			delete(fids, tx.Fid)
+			fmu.Unlock()
+			if f.closed != nil {
+				close(f.closed)
+			}
+			reply(tx, &plan9.Fcall{Type: plan9.Rclunk})
+		case plan9.Tread:
+			if f.file == "event" {
+				go func() {
+					data, err := a.readEvent(f, tx.Count)
+					if err != nil {
+						rerror(tx, err)
+						return
+					}
+					reply(tx, &plan9.Fcall{Type: plan9.Rread, Data: data})
+				}()
+				break
+			}
+			a.mu.Lock()
+			data, err := a.read(f, int64(tx.Offset), int(tx.Count))
+			a.mu.Unlock()
+			if err != nil {
+				rerror(tx, err)
+				break
+			}
+			reply(tx, &plan9.Fcall{Type: plan9.Rread, Data: data})
+		case plan9.Twrite:
+			a.mu.Lock()
+			err := a.write(f, tx.Data)
+			a.mu.Unlock()
+			if err != nil {
+				rerror(tx, err)
+				break
+			}
+			reply(tx, &plan9.Fcall{Type: plan9.Rwrite, Count: uint32(len(tx.Data))})
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// readEvent waits for event data for f's window,
+// returning an error if f is closed first, as when a window is deleted.
+func (a *fakeAcme) readEvent(f *fakeFid, count uint32) ([]byte, error) {
+	w := f.win
+	for {
+		a.mu.Lock()
+		if len(w.events) > 0 {
+			data := w.events[0]
+			w.events = w.events[1:]
+			a.mu.Unlock()
+			return []byte(data), nil
+		}
+		a.mu.Unlock()
+		select {
+		case <-w.wake:
+		case <-f.closed:
+			return nil, errors.New("window shut down")
+		}
+	}
+}
+
+// runes returns up to count bytes of whole runes from r.
+func runes(r []rune, count int) []rune {
+	n := 0
+	for i, c := range r {
+		n += utf8.RuneLen(c)
+		if n > count {
+			return r[:i]
+		}
+	}
+	return r
+}
+
+func (a *fakeAcme) read(f *fakeFid, offset int64, count int) ([]byte, error) {
+	w := f.win
+	slice := func(b []byte) []byte {
+		if offset >= int64(len(b)) {
+			return nil
+		}
+		b = b[offset:]
+		if len(b) > count {
+			b = b[:count]
+		}
+		return b
+	}
+	switch f.file {
+	case "addr":
+		return slice([]byte(fmt.Sprintf("%11d %11d ", w.addr[0], w.addr[1]))), nil
+	case "ctl":
+		dirty := 0
+		if w.dirty {
+			dirty = 1
+		}
+		return slice([]byte(fmt.Sprintf("%11d %11d %11d %11d %11d %11d %s %11d ",
+			w.id, len(w.tag), len(w.body), 0, dirty, 640, "/lib/font/bit/lucsans/euro.8.font", 32))), nil
+	case "body":
+		return slice([]byte(string(w.body))), nil
+	case "tag":
+		return slice([]byte(string(w.tag))), nil
+	case "data", "xdata":
+		end := len(w.body)
+		if f.file == "xdata" {
+			end = w.addr[1]
+		}
+		if w.addr[0] > end {
+			return nil, nil
+		}
+		r := runes(w.body[w.addr[0]:end], count)
+		w.addr[0] += len(r)
+		if f.file == "data" {
+			w.addr[1] = w.addr[0]
+		}
+		return []byte(string(r)), nil
+	}
+	return nil, errors.New("permission denied")
+}
+
+// fullRunes returns the complete runes in f.partial followed by b,
+// keeping any incomplete rune at the end for the next write.
+func (f *fakeFid) fullRunes(b []byte) []rune {
+	b = append(f.partial, b...)
+	n := len(b)
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				n = len(b) - i
+			}
+			break
+		}
+	}
+	f.partial = append([]byte(nil), b[n:]...)
+	return []rune(string(b[:n]))
+}
+
+func (a *fakeAcme) write(f *fakeFid, b []byte) error {
+	w := f.win
+	switch f.file {
+	case "addr":
+		q0, q1, err := addr.Eval(strings.TrimSpace(string(b)), w.body, w.addr[0], w.addr[1])
+		if err != nil {
+			return err
+		}
+		w.addr = [2]int{q0, q1}
+	case "ctl":
+		for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+			w.ctl = append(w.ctl, line)
+			switch line {
+			case "clean":
+				w.dirty = false
+			case "dirty":
+				w.dirty = true
+			case "dot=addr":
+				w.dot = w.addr
+			case "addr=dot":
+				w.addr = w.dot
+			}
+		}
+	case "body":
+		w.writes = append(w.writes, len(b))
+		w.body = append(w.body, f.fullRunes(b)...)
+	case "tag":
+		w.tag = append(w.tag, f.fullRunes(b)...)
+	case "data":
+		w.writes = append(w.writes, len(b))
+		r := f.fullRunes(b)
+		q0, q1 := w.addr[0], w.addr[1]
+		w.body = append(w.body[:q0], append(r, w.body[q1:]...)...)
+		w.addr = [2]int{q0 + len(r), q0 + len(r)}
+		w.dirty = true
+	case "errors":
+		w.errors = append(w.errors, b...)
+	case "event":
+		w.eventsIn = append(w.eventsIn, b...)
+	default:
+		return errors.New("permission denied")
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+// Package imports reads and edits the import declarations of Go source files.
+//
+// Parse locates the import block and the individual imports,
+// and Add, Remove and Sort compute the edits that change
+// a single import without reformatting the rest of the file.
+// AddWin, RemoveWin and SortWin apply those edits to an acme window body.
+package imports // import "9fans.net/go/acme/imports"
+
+import (
+	"bufio"
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	"9fans.net/go/acme"
+)
+
+// A Block describes the import declarations at the top of a Go source file.
+// All offsets are byte offsets in the source.
+type Block struct {
+	// Start and End delimit the import declarations.
+	// If there are none, both are the offset just after the package clause.
+	Start, End int
+
+	Decls   []Decl
+	Imports []Import
+}
+
+// A Decl is a single import declaration.
+type Decl struct {
+	Start, End     int // from the import keyword to the closing parenthesis or quote
+	Lparen, Rparen int // offsets of the parentheses, or -1 if there are none
+}
+
+// An Import is a single imported package.
+type Import struct {
+	Name       string // the local name: "", ".", "_", or an identifier
+	Path       string // the import path, unquoted
+	Start, End int    // from the name, if any, to the closing quote
+	Decl       int    // index of the import's declaration in Block.Decls
+}
+
+// Parse parses the import declarations in the Go source src.
+func Parse(src []byte) (*Block, error) {
+	r := &importReader{b: bufio.NewReader(bytes.NewReader(src))}
+	if _, err := r.readImports(true); err != nil {
+		return nil, err
+	}
+	b := &Block{Start: r.pkgEnd, End: r.pkgEnd, Decls: r.decls, Imports: r.imports}
+	if len(b.Decls) > 0 {
+		b.Start = b.Decls[0].Start
+		b.End = b.Decls[len(b.Decls)-1].End
+	}
+	return b, nil
+}
+
+// Find returns the first import of path, or nil if there is none.
+func (b *Block) Find(path string) *Import {
+	for i := range b.Imports {
+		if b.Imports[i].Path == path {
+			return &b.Imports[i]
+		}
+	}
+	return nil
+}
+
+// Add returns the edits to src that import path with the given local name,
+// which may be empty.
+// The import is added to the last parenthesized declaration,
+// in sorted order within the group of standard library
+// or other imports, as goimports arranges them.
+// If path is already imported, Add returns no edits.
+func Add(src []byte, name, path string) ([]acme.Edit, error) {
+	b, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if b.Find(path) != nil {
+		return nil, nil
+	}
+	spec := strconv.Quote(path)
+	if name != "" {
+		spec = name + " " + spec
+	}
+
+	d := -1
+	for i := range b.Decls {
+		if b.Decls[i].Lparen >= 0 {
+			d = i
+		}
+	}
+	if d < 0 {
+		if len(b.Decls) == 0 {
+			return edit(src, b.End, b.End, "\n\nimport "+spec), nil
+		}
+		return edit(src, b.End, b.End, "\nimport "+spec), nil
+	}
+
+	decl := b.Decls[d]
+	groups := b.groups(src, d)
+	if len(groups) == 0 {
+		return edit(src, decl.Lparen+1, decl.Lparen+1, "\n\t"+spec+"\n"), nil
+	}
+
+	// Pick the group: the first holding standard library imports,
+	// or the last holding others.
+	std := isStd(path)
+	var g []Import
+	if std {
+		for _, grp := range groups {
+			if isStd(grp[0].Path) {
+				g = grp
+				break
+			}
+		}
+	} else {
+		for i := len(groups) - 1; i >= 0; i-- {
+			if !isStd(groups[i][0].Path) {
+				g = groups[i]
+				break
+			}
+		}
+	}
+	if g == nil {
+		// Start a new group.
+		last := groups[len(groups)-1]
+		imp := last[len(last)-1]
+		indent := string(src[lineStart(src, imp.Start):imp.Start])
+		if std {
+			imp = groups[0][0]
+			at := lineStart(src, imp.Start)
+			return edit(src, at, at, indent+spec+"\n\n"), nil
+		}
+		at := lineEnd(src, imp.End)
+		return edit(src, at, at, "\n\n"+indent+spec), nil
+	}
+
+	for _, imp := range g {
+		if imp.Path > path {
+			at := lineStart(src, imp.Start)
+			return edit(src, at, at, string(src[at:imp.Start])+spec+"\n"), nil
+		}
+	}
+	imp := g[len(g)-1]
+	at := lineEnd(src, imp.End)
+	return edit(src, at, at, "\n"+string(src[lineStart(src, imp.Start):imp.Start])+spec), nil
+}
+
+// Remove returns the edits to src that remove all imports of path.
+// A declaration left empty is removed entirely.
+func Remove(src []byte, path string) ([]acme.Edit, error) {
+	b, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	remaining := make([]int, len(b.Decls))
+	for _, imp := range b.Imports {
+		if imp.Path != path {
+			remaining[imp.Decl]++
+		}
+	}
+	var edits []acme.Edit
+	done := make(map[int]bool)
+	for _, imp := range b.Imports {
+		if imp.Path != path {
+			continue
+		}
+		if d := b.Decls[imp.Decl]; remaining[imp.Decl] == 0 {
+			if !done[imp.Decl] {
+				done[imp.Decl] = true
+				i0, i1 := wholeLines(src, d.Start, d.End)
+				edits = append(edits, edit(src, i0, i1, "")...)
+			}
+			continue
+		}
+		i0, i1 := wholeLines(src, imp.Start, imp.End)
+		if i0 == imp.Start {
+			// Not on a line of its own: remove the spec and following separator.
+			for i1 < len(src) && (src[i1] == ' ' || src[i1] == '\t' || src[i1] == ';') {
+				i1++
+			}
+		}
+		edits = append(edits, edit(src, i0, i1, "")...)
+	}
+	return edits, nil
+}
+
+// Sort returns the edits to src that sort each group of imports
+// by import path. A group is a run of consecutive lines
+// in a parenthesized declaration, each holding a single import.
+func Sort(src []byte) ([]acme.Edit, error) {
+	b, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	var edits []acme.Edit
+	for d := range b.Decls {
+		for _, g := range b.groups(src, d) {
+			if len(g) < 2 {
+				continue
+			}
+			type line struct {
+				imp  Import
+				text string
+			}
+			lines := make([]line, len(g))
+			for i, imp := range g {
+				i0, i1 := lineStart(src, imp.Start), lineEnd(src, imp.End)
+				lines[i] = line{imp, string(src[i0:i1])}
+			}
+			sorted := append([]line(nil), lines...)
+			sort.SliceStable(sorted, func(i, j int) bool {
+				if sorted[i].imp.Path != sorted[j].imp.Path {
+					return sorted[i].imp.Path < sorted[j].imp.Path
+				}
+				return sorted[i].imp.Name < sorted[j].imp.Name
+			})
+			var old, new []string
+			for i := range lines {
+				old = append(old, lines[i].text)
+				new = append(new, sorted[i].text)
+			}
+			if strings.Join(old, "\n") == strings.Join(new, "\n") {
+				continue
+			}
+			i0 := lineStart(src, g[0].Start)
+			i1 := lineEnd(src, g[len(g)-1].End)
+			edits = append(edits, edit(src, i0, i1, strings.Join(new, "\n"))...)
+		}
+	}
+	return edits, nil
+}
+
+// AddWin adds an import of path with the given local name to the body of w.
+func AddWin(w *acme.Win, name, path string) error {
+	return editWin(w, func(src []byte) ([]acme.Edit, error) {
+		return Add(src, name, path)
+	})
+}
+
+// RemoveWin removes all imports of path from the body of w.
+func RemoveWin(w *acme.Win, path string) error {
+	return editWin(w, func(src []byte) ([]acme.Edit, error) {
+		return Remove(src, path)
+	})
+}
+
+// SortWin sorts the groups of imports in the body of w.
+func SortWin(w *acme.Win) error {
+	return editWin(w, Sort)
+}
+
+func editWin(w *acme.Win, f func(src []byte) ([]acme.Edit, error)) error {
+	src, err := w.ReadAll("body")
+	if err != nil {
+		return err
+	}
+	edits, err := f(src)
+	if err != nil || len(edits) == 0 {
+		return err
+	}
+	return w.Edit(edits)
+}
+
+// groups returns the groups of imports in the parenthesized declaration d:
+// runs of imports each on a line of its own, on consecutive lines.
+func (b *Block) groups(src []byte, d int) [][]Import {
+	var groups [][]Import
+	var g []Import
+	prevEnd := -1
+	for _, imp := range b.Imports {
+		if imp.Decl != d {
+			continue
+		}
+		i0, i1 := wholeLines(src, imp.Start, imp.End)
+		if i0 == imp.Start {
+			// Shares a line with something else.
+			if len(g) > 0 {
+				groups = append(groups, g)
+			}
+			g, prevEnd = nil, -1
+			continue
+		}
+		if i0 != prevEnd && len(g) > 0 {
+			groups = append(groups, g)
+			g = nil
+		}
+		g = append(g, imp)
+		prevEnd = i1
+	}
+	if len(g) > 0 {
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// isStd reports whether path looks like a standard library import path:
+// one whose first element has no dot.
+func isStd(path string) bool {
+	elem := path
+	if i := strings.Index(elem, "/"); i >= 0 {
+		elem = elem[:i]
+	}
+	return !strings.Contains(elem, ".")
+}
+
+// lineStart returns the offset of the start of the line containing src[i].
+func lineStart(src []byte, i int) int {
+	return bytes.LastIndexByte(src[:i], '\n') + 1
+}
+
+// lineEnd returns the offset of the newline ending the line containing src[i],
+// or len(src).
+func lineEnd(src []byte, i int) int {
+	if j := bytes.IndexByte(src[i:], '\n'); j >= 0 {
+		return i + j
+	}
+	return len(src)
+}
+
+// wholeLines returns the range of the lines containing src[i0:i1],
+// including the final newline,
+// if they hold nothing else but space and a trailing // comment.
+// Otherwise it returns i0, i1.
+func wholeLines(src []byte, i0, i1 int) (int, int) {
+	s, e := lineStart(src, i0), lineEnd(src, i1)
+	before := bytes.TrimSpace(src[s:i0])
+	after := bytes.TrimSpace(src[i1:e])
+	if len(before) > 0 || len(after) > 0 && !bytes.HasPrefix(after, []byte("//")) {
+		return i0, i1
+	}
+	if e < len(src) {
+		e++
+	}
+	return s, e
+}
+
+// edit returns the edit replacing the byte range src[i0:i1] with text.
+func edit(src []byte, i0, i1 int, text string) []acme.Edit {
+	return []acme.Edit{{
+		Q0:   acme.RuneOffset(src, i0),
+		Q1:   acme.RuneOffset(src, i1),
+		Text: []byte(text),
+	}}
+}
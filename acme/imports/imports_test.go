@@ -0,0 +1,170 @@
+package imports
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"9fans.net/go/acme"
+)
+
+const src = `// Package x does things.
+package x
+
+import "os"
+
+import (
+	"fmt"
+	str "strings" // for Join
+
+	"9fans.net/go/acme"
+	_ "example.com/y"
+)
+
+func main() {}
+`
+
+func TestParse(t *testing.T) {
+	b, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, imp := range b.Imports {
+		got = append(got, imp.Name+" "+imp.Path+" "+src[imp.Start:imp.End])
+	}
+	want := []string{
+		` os "os"`,
+		` fmt "fmt"`,
+		`str strings str "strings"`,
+		` 9fans.net/go/acme "9fans.net/go/acme"`,
+		`_ example.com/y _ "example.com/y"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("imports:\n%q\nwant:\n%q", got, want)
+	}
+	if len(b.Decls) != 2 || b.Imports[0].Decl != 0 || b.Imports[4].Decl != 1 {
+		t.Fatalf("decls = %+v", b.Decls)
+	}
+	if s := src[b.Start:b.End]; !strings.HasPrefix(s, `import "os"`) || !strings.HasSuffix(s, "\"example.com/y\"\n)") {
+		t.Errorf("block = %q", s)
+	}
+	if d := b.Decls[1]; src[d.Lparen] != '(' || src[d.Rparen] != ')' || b.Decls[0].Lparen != -1 {
+		t.Errorf("parens = %+v", b.Decls)
+	}
+
+	b, err = Parse([]byte("package x\n\nfunc f() {}\n"))
+	if err != nil || b.Start != 9 || b.End != 9 || len(b.Imports) != 0 {
+		t.Errorf("Parse without imports = %+v, %v", b, err)
+	}
+	if _, err := Parse([]byte("package x\nimport (\n\t\"fmt\n)\n")); err == nil {
+		t.Errorf("Parse of bad import succeeded")
+	}
+}
+
+// apply applies the edits to text.
+func apply(text string, edits []acme.Edit) string {
+	r := []rune(text)
+	edits = append([]acme.Edit(nil), edits...)
+	sort.Slice(edits, func(i, j int) bool { return edits[i].Q0 > edits[j].Q0 })
+	for _, e := range edits {
+		r = append(r[:e.Q0], append([]rune(string(e.Text)), r[e.Q1:]...)...)
+	}
+	return string(r)
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		src, name, path, want string
+	}{
+		{src, "", "bytes", strings.Replace(src, "\t\"fmt\"", "\t\"bytes\"\n\t\"fmt\"", 1)},
+		{src, "", "sort", strings.Replace(src, "\tstr ", "\t\"sort\"\n\tstr ", 1)},
+		{src, "", "time", strings.Replace(src, "// for Join\n", "// for Join\n\t\"time\"\n", 1)},
+		{src, "z", "example.com/z", strings.Replace(src, "_ \"example.com/y\"\n", "_ \"example.com/y\"\n\tz \"example.com/z\"\n", 1)},
+		{src, "", "fmt", src},
+		{
+			"package x\n\nimport (\n\t\"fmt\"\n)\n",
+			"", "example.com/z",
+			"package x\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/z\"\n)\n",
+		},
+		{
+			"package x\n\nimport (\n\t\"example.com/z\"\n)\n",
+			"", "fmt",
+			"package x\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/z\"\n)\n",
+		},
+		{"package x\n\nimport ()\n", "", "fmt", "package x\n\nimport (\n\t\"fmt\"\n)\n"},
+		{"package x\n\nimport \"os\"\n", "", "fmt", "package x\n\nimport \"os\"\nimport \"fmt\"\n"},
+		{"package x\n\nfunc f() {}\n", "", "fmt", "package x\n\nimport \"fmt\"\n\nfunc f() {}\n"},
+	}
+	for _, tt := range tests {
+		edits, err := Add([]byte(tt.src), tt.name, tt.path)
+		if err != nil {
+			t.Errorf("Add(%q): %v", tt.path, err)
+			continue
+		}
+		if got := apply(tt.src, edits); got != tt.want {
+			t.Errorf("Add(%q) to\n%s\n=\n%s\nwant\n%s", tt.path, tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		src, path, want string
+	}{
+		{src, "strings", strings.Replace(src, "\tstr \"strings\" // for Join\n", "", 1)},
+		{src, "os", strings.Replace(src, "import \"os\"\n", "", 1)},
+		{src, "none", src},
+		{"package x\n\nimport (\n\t\"fmt\"\n)\n\nvar x\n", "fmt", "package x\n\n\nvar x\n"},
+		{"package x\n\nimport (\"fmt\"; \"os\")\n", "fmt", "package x\n\nimport (\"os\")\n"},
+	}
+	for _, tt := range tests {
+		edits, err := Remove([]byte(tt.src), tt.path)
+		if err != nil {
+			t.Errorf("Remove(%q): %v", tt.path, err)
+			continue
+		}
+		if got := apply(tt.src, edits); got != tt.want {
+			t.Errorf("Remove(%q) from\n%s\n=\n%s\nwant\n%s", tt.path, tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	in := "package x\n\nimport (\n\t\"os\"\n\tb \"bytes\" // b\n\t\"fmt\"\n\n\t\"z.com/b\"\n\t\"z.com/a\"\n)\n\nvar π = 3\n"
+	want := "package x\n\nimport (\n\tb \"bytes\" // b\n\t\"fmt\"\n\t\"os\"\n\n\t\"z.com/a\"\n\t\"z.com/b\"\n)\n\nvar π = 3\n"
+	edits, err := Sort([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := apply(in, edits); got != want {
+		t.Errorf("Sort =\n%s\nwant\n%s", got, want)
+	}
+	if edits, _ := Sort([]byte(want)); len(edits) != 0 {
+		t.Errorf("Sort of sorted imports = %v", edits)
+	}
+}
+
+func TestRuneOffsets(t *testing.T) {
+	in := "// π\npackage x\n\nimport (\n\t\"os\"\n)\n"
+	edits, err := Add([]byte(in), "", "fmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "// π\npackage x\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n"
+	if got := apply(in, edits); got != want {
+		t.Errorf("Add with non-ASCII text =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestReadImports(t *testing.T) {
+	top, err := ReadImports(bytes.NewReader([]byte(src)), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(top), "\"example.com/y\"\n)\n\n") {
+		t.Errorf("ReadImports = %q", top)
+	}
+}
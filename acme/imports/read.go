@@ -2,12 +2,13 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package main
+package imports
 
 import (
 	"bufio"
 	"errors"
 	"io"
+	"strconv"
 )
 
 type importReader struct {
@@ -17,6 +18,10 @@ type importReader struct {
 	err  error
 	eof  bool
 	nerr int
+
+	pkgEnd  int // end of the package clause
+	decls   []Decl
+	imports []Import
 }
 
 func isIdent(c byte) bool {
@@ -175,21 +180,40 @@ func (r *importReader) readString() {
 	}
 }
 
+// offset returns the offset in the input of the byte most recently
+// returned by peekByte, or the length of the input at EOF.
+func (r *importReader) offset() int {
+	if r.peek == 0 {
+		return len(r.buf)
+	}
+	return len(r.buf) - 1
+}
+
 // readImport reads an import clause - optional identifier followed by quoted string -
-// from the input.
+// from the input, recording it in r.imports.
 func (r *importReader) readImport() {
 	c := r.peekByte(true)
+	imp := Import{Start: r.offset(), Decl: len(r.decls) - 1}
 	if c == '.' {
 		r.peek = 0
+		imp.Name = "."
 	} else if isIdent(c) {
 		r.readIdent()
+		imp.Name = string(r.buf[imp.Start:r.offset()])
 	}
+	r.peekByte(true)
+	quoted := r.offset()
 	r.readString()
+	imp.End = len(r.buf)
+	if r.err == nil {
+		imp.Path, _ = strconv.Unquote(string(r.buf[quoted:imp.End]))
+		r.imports = append(r.imports, imp)
+	}
 }
 
-// readComments is like ioutil.ReadAll, except that it only reads the leading
+// ReadComments is like ioutil.ReadAll, except that it only reads the leading
 // block of comments in the file.
-func readComments(f io.Reader) ([]byte, error) {
+func ReadComments(f io.Reader) ([]byte, error) {
 	r := &importReader{b: bufio.NewReader(f)}
 	r.peekByte(true)
 	if r.err == nil && !r.eof {
@@ -199,24 +223,35 @@ func readComments(f io.Reader) ([]byte, error) {
 	return r.buf, r.err
 }
 
-// readImports is like ioutil.ReadAll, except that it expects a Go file as input
+// ReadImports is like ioutil.ReadAll, except that it expects a Go file as input
 // and stops reading the input once the imports have completed.
-func readImports(f io.Reader, reportSyntaxError bool) ([]byte, error) {
+func ReadImports(f io.Reader, reportSyntaxError bool) ([]byte, error) {
 	r := &importReader{b: bufio.NewReader(f)}
+	return r.readImports(reportSyntaxError)
+}
 
+func (r *importReader) readImports(reportSyntaxError bool) ([]byte, error) {
 	r.readKeyword("package")
 	r.readIdent()
+	r.pkgEnd = r.offset()
+	r.decls = nil
+	r.imports = nil
 	for r.peekByte(true) == 'i' {
+		d := Decl{Start: r.offset(), Lparen: -1, Rparen: -1}
 		r.readKeyword("import")
+		r.decls = append(r.decls, d)
 		if r.peekByte(true) == '(' {
+			r.decls[len(r.decls)-1].Lparen = r.offset()
 			r.nextByte(false)
 			for r.peekByte(true) != ')' && r.err == nil {
 				r.readImport()
 			}
+			r.decls[len(r.decls)-1].Rparen = r.offset()
 			r.nextByte(false)
 		} else {
 			r.readImport()
 		}
+		r.decls[len(r.decls)-1].End = len(r.buf)
 	}
 
 	// If we stopped successfully before EOF, we read a byte that told us we were done.
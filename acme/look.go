@@ -0,0 +1,273 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A LookKind identifies what kind of text a Look refers to.
+type LookKind int
+
+const (
+	LookText   LookKind = iota // plain text
+	LookURL                    // a URL, such as https://9fans.net/
+	LookFile                   // a file, with an optional address, such as acme.go:12
+	LookSymbol                 // a Go package-qualified name, such as fmt.Println
+	LookError                  // a compiler error line, such as x.go:12:5: undefined: y
+)
+
+var lookKinds = []string{
+	LookText:   "text",
+	LookURL:    "url",
+	LookFile:   "file",
+	LookSymbol: "symbol",
+	LookError:  "error",
+}
+
+func (k LookKind) String() string {
+	if 0 <= int(k) && int(k) < len(lookKinds) {
+		return lookKinds[k]
+	}
+	return "LookKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// A LookTarget is the result of expanding the text under a Look.
+type LookTarget struct {
+	Kind LookKind
+
+	// Text is the expanded text, which occupies the rune range [Q0, Q1)
+	// in the window body, or in the tag for a Look in the tag.
+	Text   string
+	Q0, Q1 int
+
+	// Path is the file name, for LookFile and LookError,
+	// the URL, for LookURL, or the package name, for LookSymbol.
+	// A relative file name is interpreted relative to the window's directory.
+	Path string
+
+	// Addr is the acme address within the file, such as "12" or "/func main/",
+	// or the empty string if the Look named no address.
+	Addr string
+
+	// Symbol is the package member name, for LookSymbol.
+	Symbol string
+}
+
+var (
+	lookURLRE   = regexp.MustCompile(`(?:https?|ftp|file|mailto|gopher)://[^\s<>"'()\[\]{}]*[^\s<>"'()\[\]{}.,;:!?]|mailto:[^\s<>"'()]+@[^\s<>"'().,;:]+`)
+	lookErrorRE = regexp.MustCompile(`^\s*([^\s:]+):(\d+)(?::(\d+))?: `)
+	lookFileRE  = regexp.MustCompile(`[\pL\pN_.~/\-+@$%]*[\pL\pN_~/\-+@$%](?::(?:(\d+)(?::(\d+))?|#(\d+)|/((?:[^/\\]|\\.)*)/))?`)
+	lookSymRE   = regexp.MustCompile(`^[a-z_][a-zA-Z0-9_]*\.[A-Z][a-zA-Z0-9_]*$`)
+	lookExtRE   = regexp.MustCompile(`\.[a-zA-Z0-9]+$`)
+)
+
+// ExpandLook expands the Look at the rune range [q0, q1) in text,
+// which begins at rune offset base in the window body.
+// If q0 < q1, the Look applies to exactly that text;
+// otherwise ExpandLook examines the line containing q0
+// for a URL, a file name with an optional address,
+// a Go package-qualified name, or a compiler error line.
+// File addresses may be written :line, :line:col, :#n, or :/regexp/.
+func ExpandLook(text string, base, q0, q1 int) LookTarget {
+	i0 := byteIndex(text, q0-base)
+	i1 := byteIndex(text, q1-base)
+	if i0 < i1 {
+		t := classifyLook(text[i0:i1], 0, i1-i0)
+		if t.Kind == LookText {
+			t.Text = text[i0:i1]
+		}
+		t.Q0, t.Q1 = q0, q1
+		return t
+	}
+
+	// Find the line containing i0.
+	start := strings.LastIndex(text[:i0], "\n") + 1
+	end := strings.Index(text[i0:], "\n")
+	if end < 0 {
+		end = len(text)
+	} else {
+		end += i0
+	}
+	line := text[start:end]
+	t := classifyLook(line, i0-start, i0-start)
+	if t.Kind == LookText && t.Text == "" {
+		t.Q0, t.Q1 = q0, q1
+		return t
+	}
+	t.Q0 = q0 - utf8.RuneCountInString(line[:i0-start]) + t.Q0
+	t.Q1 = t.Q0 + utf8.RuneCountInString(t.Text)
+	return t
+}
+
+// classifyLook finds and classifies the target in line
+// touching the byte range [i0, i1).
+// It returns a LookTarget with Q0 set to the rune offset of the target in line.
+func classifyLook(line string, i0, i1 int) LookTarget {
+	contains := func(m []int) bool {
+		return m[0] <= i0 && i1 <= m[1]
+	}
+	target := func(kind LookKind, m []int) LookTarget {
+		return LookTarget{
+			Kind: kind,
+			Text: line[m[0]:m[1]],
+			Q0:   utf8.RuneCountInString(line[:m[0]]),
+		}
+	}
+
+	for _, m := range lookURLRE.FindAllStringIndex(line, -1) {
+		if contains(m) {
+			t := target(LookURL, m)
+			t.Path = t.Text
+			return t
+		}
+	}
+
+	if m := lookErrorRE.FindStringSubmatchIndex(line); m != nil {
+		return LookTarget{
+			Kind: LookError,
+			Text: line,
+			Path: line[m[2]:m[3]],
+			Addr: lineColAddr(line[m[4]:m[5]], submatch(line, m, 3)),
+		}
+	}
+
+	for _, m := range lookFileRE.FindAllStringSubmatchIndex(line, -1) {
+		if !contains(m) {
+			continue
+		}
+		t := target(LookText, m)
+		name := t.Text
+		if i := strings.Index(name, ":"); i >= 0 {
+			name = name[:i]
+		}
+		switch {
+		case m[2] >= 0:
+			t.Addr = lineColAddr(submatch(line, m, 1), submatch(line, m, 2))
+		case m[6] >= 0:
+			t.Addr = "#" + submatch(line, m, 3)
+		case m[8] >= 0:
+			t.Addr = "/" + submatch(line, m, 4) + "/"
+		}
+		switch {
+		case t.Addr != "" || strings.Contains(name, "/") || lookExtRE.MatchString(name) && !lookSymRE.MatchString(name):
+			t.Kind = LookFile
+			t.Path = name
+		case lookSymRE.MatchString(name):
+			t.Kind = LookSymbol
+			i := strings.Index(name, ".")
+			t.Path = name[:i]
+			t.Symbol = name[i+1:]
+		}
+		return t
+	}
+
+	return LookTarget{Kind: LookText}
+}
+
+// lineColAddr returns the acme address for the line and optional column,
+// both counted from 1.
+func lineColAddr(line, col string) string {
+	if col == "" || col == "1" || col == "0" {
+		return line
+	}
+	return line + "-#0+#" + decr(col)
+}
+
+// decr returns the decimal string s decremented by one.
+func decr(s string) string {
+	b := []byte(s)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] > '0' {
+			b[i]--
+			break
+		}
+		b[i] = '9'
+	}
+	t := strings.TrimLeft(string(b), "0")
+	if t == "" {
+		t = "0"
+	}
+	return t
+}
+
+func submatch(s string, m []int, i int) string {
+	if m[2*i] < 0 {
+		return ""
+	}
+	return s[m[2*i]:m[2*i+1]]
+}
+
+// byteIndex returns the byte index in s of the rune offset q,
+// clamped to [0, len(s)].
+func byteIndex(s string, q int) int {
+	if q <= 0 {
+		return 0
+	}
+	return ByteOffset([]byte(s), q)
+}
+
+// lookContext is the number of runes on each side of a Look
+// that ExpandLook examines.
+const lookContext = 512
+
+// ExpandLook reads the text around the Look event e
+// and returns the expanded target.
+// For a Look in the tag (e.C2 == 'l'), it reads the tag;
+// otherwise it reads the body.
+// A relative file name is made absolute using the directory of the window's name.
+func (w *Win) ExpandLook(e *Event) (LookTarget, error) {
+	q0, q1 := e.OrigQ0, e.OrigQ1
+	var data []byte
+	var base int
+	if e.C2 == 'l' {
+		tag, err := w.ReadAll("tag")
+		if err != nil {
+			return LookTarget{}, err
+		}
+		data = tag
+	} else {
+		n, err := w.Len()
+		if err != nil {
+			return LookTarget{}, err
+		}
+		base = q0 - lookContext
+		if base < 0 {
+			base = 0
+		}
+		end := q1 + lookContext
+		if end > n {
+			end = n
+		}
+		data, err = w.ReadRange(base, end)
+		if err != nil {
+			return LookTarget{}, err
+		}
+	}
+	t := ExpandLook(string(data), base, q0, q1)
+	if t.Kind == LookText && t.Text == "" {
+		// Nothing recognized; use acme's own expansion.
+		t.Text, t.Q0, t.Q1 = string(e.Text), e.Q0, e.Q1
+	}
+	if (t.Kind == LookFile || t.Kind == LookError) && !path.IsAbs(t.Path) && !strings.HasPrefix(t.Path, "~") {
+		if p, err := w.TagParts(); err == nil && p.File != "" {
+			dir := p.File
+			if !strings.HasSuffix(dir, "/") {
+				dir = path.Dir(dir)
+			}
+			t.Path = path.Join(dir, t.Path)
+		}
+	}
+	return t, nil
+}
+
+// A TargetLooker is an EventHandler that also accepts
+// expanded Look targets.
+// When the handler passed to EventLoop is a TargetLooker,
+// EventLoop calls LookTarget instead of Look.
+type TargetLooker interface {
+	EventHandler
+	LookTarget(t LookTarget) bool
+}
@@ -0,0 +1,51 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"strings"
+	"testing"
+)
+
+var lookTests = []struct {
+	text string // text with | marking the Look point, or [ and ] marking a selection
+	want LookTarget
+}{
+	{"see https://9fans.net/go/acme|. for details", LookTarget{Kind: LookURL, Text: "https://9fans.net/go/acme", Q0: 4, Q1: 29, Path: "https://9fans.net/go/acme"}},
+	{"see (http://ex|ample.com/a?b=c) ok", LookTarget{Kind: LookURL, Text: "http://example.com/a?b=c", Q0: 5, Q1: 29, Path: "http://example.com/a?b=c"}},
+	{"in acm|e.go:12 there", LookTarget{Kind: LookFile, Text: "acme.go:12", Q0: 3, Q1: 13, Path: "acme.go", Addr: "12"}},
+	{"in acme.go:12:5| there", LookTarget{Kind: LookFile, Text: "acme.go:12:5", Q0: 3, Q1: 15, Path: "acme.go", Addr: "12-#0+#4"}},
+	{"/usr/lib|/x.c:#100", LookTarget{Kind: LookFile, Text: "/usr/lib/x.c:#100", Q0: 0, Q1: 17, Path: "/usr/lib/x.c", Addr: "#100"}},
+	{"x.go:/func m|ain/", LookTarget{Kind: LookFile, Text: "x.go:/func main/", Q0: 0, Q1: 16, Path: "x.go", Addr: "/func main/"}},
+	{"|x.go:/main/ here", LookTarget{Kind: LookFile, Text: "x.go:/main/", Q0: 0, Q1: 11, Path: "x.go", Addr: "/main/"}},
+	{"call fmt.Pri|ntln(x)", LookTarget{Kind: LookSymbol, Text: "fmt.Println", Q0: 5, Q1: 16, Path: "fmt", Symbol: "Println"}},
+	{"edit main.g|o now", LookTarget{Kind: LookFile, Text: "main.go", Q0: 5, Q1: 12, Path: "main.go"}},
+	{"one\n./x.go:3:10: undefined: |y\nthree", LookTarget{Kind: LookError, Text: "./x.go:3:10: undefined: y", Q0: 4, Q1: 29, Path: "./x.go", Addr: "3-#0+#9"}},
+	{"héllo wö|rld", LookTarget{Kind: LookText, Text: "wörld", Q0: 6, Q1: 11}},
+	{"a [b c] d", LookTarget{Kind: LookText, Text: "b c", Q0: 2, Q1: 5}},
+	{"a [x.go:7] d", LookTarget{Kind: LookFile, Text: "x.go:7", Q0: 2, Q1: 8, Path: "x.go", Addr: "7"}},
+}
+
+func TestExpandLook(t *testing.T) {
+	for _, tt := range lookTests {
+		text := tt.text
+		var q0, q1 int
+		if i := strings.Index(text, "|"); i >= 0 {
+			text = text[:i] + text[i+1:]
+			q0 = len([]rune(text[:i]))
+			q1 = q0
+		} else {
+			i := strings.Index(text, "[")
+			j := strings.Index(text, "]")
+			text = text[:i] + text[i+1:j] + text[j+1:]
+			q0 = len([]rune(text[:i]))
+			q1 = q0 + len([]rune(tt.text[i+1:j]))
+		}
+		// Pretend the text starts at offset 100 in the body.
+		got := ExpandLook(text, 100, q0+100, q1+100)
+		want := tt.want
+		want.Q0 += 100
+		want.Q1 += 100
+		if got != want {
+			t.Errorf("ExpandLook(%q):\nhave %+v\nwant %+v", tt.text, got, want)
+		}
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path"
 	"reflect"
@@ -76,7 +76,7 @@ func Show(name string) *Win {
 
 	for w := windows; w != nil; w = w.next {
 		if w.name == name {
-			if err := w.Ctl("show"); err != nil {
+			if err := w.Show(); err != nil {
 				w.dropLocked()
 				return nil
 			}
@@ -149,10 +149,10 @@ func (w *Win) OpenEvent() error {
 // ReadAll
 func (w *Win) ReadAll(file string) ([]byte, error) {
 	f, err := w.fid(file)
-	f.Seek(0, 0)
 	if err != nil {
 		return nil, err
 	}
+	f.Seek(0, 0)
 	return ioutil.ReadAll(f)
 }
 
@@ -267,6 +267,14 @@ type Event struct {
 
 // ReadEvent reads the next event from the window's event file.
 func (w *Win) ReadEvent() (e *Event, err error) {
+	if err := w.openEvents(); err != nil {
+		return nil, err
+	}
+	return readEvent(w.ebuf)
+}
+
+// readEvent reads the next event from the event file data in b.
+func readEvent(b *bufio.Reader) (e *Event, err error) {
 	defer func() {
 		if v := recover(); v != nil {
 			e = nil
@@ -274,19 +282,19 @@ func (w *Win) ReadEvent() (e *Event, err error) {
 		}
 	}()
 
-	if _, err = w.fid("event"); err != nil {
+	if _, err := b.Peek(1); err == io.EOF {
 		return nil, err
 	}
 
 	e = new(Event)
-	w.gete(e)
+	gete(b, e)
 	e.OrigQ0 = e.Q0
 	e.OrigQ1 = e.Q1
 
 	// expansion
 	if e.Flag&2 != 0 {
 		e2 := new(Event)
-		w.gete(e2)
+		gete(b, e2)
 		if e.Q0 == e.Q1 {
 			e2.OrigQ0 = e.Q0
 			e2.OrigQ1 = e.Q1
@@ -299,8 +307,8 @@ func (w *Win) ReadEvent() (e *Event, err error) {
 	if e.Flag&8 != 0 {
 		e3 := new(Event)
 		e4 := new(Event)
-		w.gete(e3)
-		w.gete(e4)
+		gete(b, e3)
+		gete(b, e4)
 		e.Arg = e3.Text
 		e.Loc = e4.Text
 	}
@@ -308,44 +316,41 @@ func (w *Win) ReadEvent() (e *Event, err error) {
 	return e, nil
 }
 
-func (w *Win) gete(e *Event) {
-	if w.ebuf == nil {
-		w.ebuf = bufio.NewReader(w.event)
-	}
-	e.C1 = w.getec()
-	e.C2 = w.getec()
-	e.Q0 = w.geten()
-	e.Q1 = w.geten()
-	e.Flag = w.geten()
-	e.Nr = w.geten()
+func gete(b *bufio.Reader, e *Event) {
+	e.C1 = getec(b)
+	e.C2 = getec(b)
+	e.Q0 = geten(b)
+	e.Q1 = geten(b)
+	e.Flag = geten(b)
+	e.Nr = geten(b)
 	if e.Nr > eventSize {
 		panic("event string too long")
 	}
 	r := make([]rune, e.Nr)
 	for i := 0; i < e.Nr; i++ {
-		r[i] = w.getec()
+		r[i] = getec(b)
 	}
 	e.Text = []byte(string(r))
-	if w.getec() != '\n' {
+	if getec(b) != '\n' {
 		panic("phase error")
 	}
 }
 
-func (w *Win) getec() rune {
-	c, _, err := w.ebuf.ReadRune()
+func getec(b *bufio.Reader) rune {
+	c, _, err := b.ReadRune()
 	if err != nil {
 		panic(err.Error())
 	}
 	return c
 }
 
-func (w *Win) geten() int {
+func geten(b *bufio.Reader) int {
 	var (
 		c rune
 		n int
 	)
 	for {
-		c = w.getec()
+		c = getec(b)
 		if c < '0' || c > '9' {
 			break
 		}
@@ -362,10 +367,31 @@ func (w *Win) geten() int {
 func (w *Win) WriteEvent(e *Event) error {
 	var buf bytes.Buffer
 	fmt.Fprintf(&buf, "%c%c%d %d \n", e.C1, e.C2, e.Q0, e.Q1)
+	w.rec.record('w', buf.Bytes())
+	if w.replay {
+		return nil
+	}
 	_, err := w.Write("event", buf.Bytes())
 	return err
 }
 
+// openEvents opens the window's event file, if it is not already open.
+func (w *Win) openEvents() error {
+	if w.ebuf != nil {
+		return nil
+	}
+	f, err := w.fid("event")
+	if err != nil {
+		return err
+	}
+	var r io.Reader = f
+	if w.rec != nil {
+		r = &recordReader{r, w.rec}
+	}
+	w.ebuf = bufio.NewReader(r)
+	return nil
+}
+
 // EventChan returns a channel on which events can be read.
 // The first call to EventChan allocates a channel and starts a
 // new goroutine that loops calling ReadEvent and sending
@@ -375,22 +401,62 @@ func (w *Win) WriteEvent(e *Event) error {
 func (w *Win) EventChan() <-chan *Event {
 	if w.c == nil {
 		w.c = make(chan *Event, 0)
-		go w.eventReader()
+		w.cstop = make(chan struct{})
+		// Open the event file before starting the reader,
+		// so that stopEvents can close it without racing the reader.
+		// If it cannot be opened, the reader stops at once.
+		var b *bufio.Reader
+		if w.openEvents() == nil {
+			b = w.ebuf
+		}
+		go w.eventReader(w.c, b, w.cstop)
 	}
 	return w.c
 }
 
-func (w *Win) eventReader() {
-	for {
-		e, err := w.ReadEvent()
+// eventReader sends the events read from b on c until reading fails.
+// Unless stop has been closed, the failure means the window was deleted,
+// so eventReader drops w from the managed windows.
+func (w *Win) eventReader(c chan *Event, b *bufio.Reader, stop chan struct{}) {
+	for b != nil {
+		e, err := readEvent(b)
 		if err != nil {
 			break
 		}
-		w.c <- e
+		c <- e
 	}
-	w.c <- new(Event) // make sure event reader is done processing last event; drop might exit
+	select {
+	case <-stop:
+		// Stopped by stopEvents; the window is still open.
+		close(c)
+		return
+	default:
+	}
+	c <- new(Event) // make sure event reader is done processing last event; drop might exit
 	w.drop()
-	close(w.c)
+	close(c)
+}
+
+// stopEvents stops the event reader started by EventChan,
+// which returned c. It closes the event file, so that acme
+// stops sending events to w and the reader's pending read fails,
+// and it discards the events still to be received from c,
+// so that the reader is not left blocked sending them.
+// The window remains managed, and a later EventChan
+// reopens the event file and starts a new reader.
+func (w *Win) stopEvents(c <-chan *Event) {
+	close(w.cstop)
+	if w.event != nil {
+		w.event.Close()
+		w.event = nil
+	}
+	w.ebuf = nil
+	w.c = nil
+	w.cstop = nil
+	go func() {
+		for range c {
+		}
+	}()
 }
 
 func (w *Win) drop() {
@@ -433,12 +499,12 @@ func (w *Win) Blink() (stop func()) {
 			case <-t.C:
 				dirty = !dirty
 				if dirty {
-					w.Ctl("dirty")
+					w.Dirty()
 				} else {
-					w.Ctl("clean")
+					w.Clean()
 				}
 			case <-c:
-				w.Ctl("clean")
+				w.Clean()
 				c <- struct{}{}
 				return
 			}
@@ -495,6 +561,13 @@ func (w *Win) loadText(e *Event, h EventHandler) {
 	}
 }
 
+// EventLoop reads events from the window and dispatches them to h.
+// An executed command Foo is handled by h's ExecFoo method, if it has one,
+// and otherwise by h.Execute.
+// A Look is handled by h.Look, or, if h is a TargetLooker,
+// by h.LookTarget with the result of w.ExpandLook.
+// Router provides the same service without reflection,
+// with argument parsing, help text, and cancellation.
 func (w *Win) EventLoop(h EventHandler) {
 	for e := range w.EventChan() {
 		switch e.C2 {
@@ -504,8 +577,19 @@ func (w *Win) EventLoop(h EventHandler) {
 				w.WriteEvent(e)
 			}
 		case 'l', 'L': // look
-			// TODO(rsc): Expand selection, especially for URLs.
 			w.loadText(e, h)
+			if th, ok := h.(TargetLooker); ok {
+				t, err := w.ExpandLook(e)
+				if err != nil {
+					w.Err(err.Error())
+					w.WriteEvent(e)
+					break
+				}
+				if !th.LookTarget(t) {
+					w.WriteEvent(e)
+				}
+				break
+			}
 			if !h.Look(string(e.Text)) {
 				w.WriteEvent(e)
 			}
@@ -578,7 +662,7 @@ func (w *Win) execute(h EventHandler, cmd string) bool {
 }
 
 func (w *Win) Selection() string {
-	w.Ctl("addr=dot")
+	w.AddrToDot()
 	data, err := w.ReadAll("xdata")
 	if err != nil {
 		w.Err(err.Error())
@@ -593,7 +677,16 @@ func (w *Win) SetErrorPrefix(p string) {
 // Err finds or creates a window appropriate for showing errors related to w
 // and then prints msg to that window.
 // It adds a final newline to msg if needed.
+// If w is recorded, msg is also recorded.
+// If w is replayed, msg is only recorded.
 func (w *Win) Err(msg string) {
+	if !strings.HasSuffix(msg, "\n") {
+		msg = msg + "\n"
+	}
+	w.rec.record('e', []byte(msg))
+	if w.replay {
+		return
+	}
 	Err(w.errorPrefix, msg)
 }
 
@@ -601,36 +694,27 @@ func (w *Win) Errf(format string, args ...interface{}) {
 	w.Err(fmt.Sprintf(format, args...))
 }
 
+// defaultSink is the ErrorSink used by Err.
+var defaultSink = &ErrorSink{Fallback: os.Stderr}
+
 // Err finds or creates a window appropriate for showing errors related to a window titled src
 // and then prints msg to that window. It adds a final newline to msg if needed.
+// If the window cannot be created or written, as when acme is not running,
+// Err prints msg to standard error instead.
+// Err writes msg before returning; an ErrorSink writes messages in batches.
 func Err(src, msg string) {
-	if !strings.HasSuffix(msg, "\n") {
-		msg = msg + "\n"
-	}
+	defaultSink.Err(src, msg)
+	defaultSink.Flush()
+}
+
+// errorsName returns the name of the +Errors window
+// for errors related to a window titled src.
+func errorsName(src string) string {
 	prefix, _ := path.Split(src)
 	if prefix == "/" || prefix == "." {
 		prefix = ""
 	}
-	name := prefix + "+Errors"
-	w1 := Show(name)
-	if w1 == nil {
-		var err error
-		w1, err = New()
-		if err != nil {
-			time.Sleep(100 * time.Millisecond)
-			w1, err = New()
-			if err != nil {
-				log.Fatalf("cannot create +Errors window")
-			}
-		}
-		w1.Name("%s", name)
-	}
-	w1.Addr("$")
-	w1.Ctl("dot=addr")
-	w1.Fprintf("body", "%s", msg)
-	w1.Addr(".,")
-	w1.Ctl("dot=addr")
-	w1.Ctl("show")
+	return prefix + "+Errors"
 }
 
 // Errf is like Err but accepts a printf-style formatting.
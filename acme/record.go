@@ -0,0 +1,140 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Recorder records the raw bytes read from and written to
+// the event files of windows, and the errors the windows report,
+// so that the event sequence can be replayed later,
+// for example in a test reproducing a bug.
+//
+// The recording is a sequence of records, each a header line
+//
+//	op nanoseconds length
+//
+// followed by length bytes of event file data and a newline.
+// The op is r for data read from the event file, w for data written to it,
+// and e for an error reported with the window's Err method,
+// and nanoseconds is the time since the recorder was created.
+type Recorder struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	err   error
+}
+
+// NewRecorder returns a Recorder writing its recording to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w, start: time.Now()}
+}
+
+// Err returns the first error encountered writing the recording, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(op byte, data []byte) {
+	if r == nil || len(data) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	_, r.err = fmt.Fprintf(r.w, "%c %d %d\n%s\n", op, time.Since(r.start), len(data), data)
+}
+
+// Record arranges for the event file data read and written by w,
+// and the errors reported by w, to be recorded by r.
+// Record must be called before w's first call to ReadEvent or EventChan,
+// or else the recording will miss events already buffered.
+func (w *Win) Record(r *Recorder) {
+	w.rec = r
+}
+
+// A recordReader records the data read from r.
+type recordReader struct {
+	r   io.Reader
+	rec *Recorder
+}
+
+func (r *recordReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.rec.record('r', p[:n])
+	return n, err
+}
+
+// An EventRecord is a single record in a recording made by a Recorder.
+type EventRecord struct {
+	Op   byte          // 'r' for data read from the event file, 'w' for data written, 'e' for an error
+	Time time.Duration // time since the start of the recording
+	Data []byte
+}
+
+// ReadEventRecords reads a recording made by a Recorder.
+func ReadEventRecords(r io.Reader) ([]EventRecord, error) {
+	b := bufio.NewReader(r)
+	var recs []EventRecord
+	for n := 1; ; n++ {
+		line, err := b.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return recs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("event record %d: %v", n, err)
+		}
+		f := strings.Fields(line)
+		if len(f) != 3 || len(f[0]) != 1 || !strings.Contains("rwe", f[0]) {
+			return nil, fmt.Errorf("event record %d: malformed header %q", n, line)
+		}
+		t, err1 := strconv.ParseInt(f[1], 10, 64)
+		size, err2 := strconv.Atoi(f[2])
+		if err1 != nil || err2 != nil || size < 0 {
+			return nil, fmt.Errorf("event record %d: malformed header %q", n, line)
+		}
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(b, data); err != nil || data[size] != '\n' {
+			return nil, fmt.Errorf("event record %d: short data", n)
+		}
+		recs = append(recs, EventRecord{Op: f[0][0], Time: time.Duration(t), Data: data[:size]})
+	}
+}
+
+// Replay returns a window, not connected to acme, whose event file
+// yields the data read in the recording recs.
+// The events are parsed by ReadEvent exactly as they were when recorded,
+// so the window can stand in for a real one in EventChan or EventLoop.
+// Events written back with WriteEvent and errors reported with Err
+// are recorded by out, if non-nil, for comparison with those in the recording;
+// the errors are not shown in acme.
+// Operations on the window's other files return errors.
+func Replay(recs []EventRecord, out *Recorder) *Win {
+	var data []byte
+	for _, r := range recs {
+		if r.Op == 'r' {
+			data = append(data, r.Data...)
+		}
+	}
+	return &Win{
+		ebuf:   bufio.NewReader(bytes.NewReader(data)),
+		rec:    out,
+		replay: true,
+	}
+}
+
+// ReplayEvents replays the events read in the recording recs into h,
+// as w.EventLoop(h) would for a window w, using a window made by Replay.
+func ReplayEvents(recs []EventRecord, h EventHandler, out *Recorder) {
+	Replay(recs, out).EventLoop(h)
+}
@@ -0,0 +1,151 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordedEvents is the event file data in the test recording.
+// It includes an insertion with non-ASCII text, an expanded
+// execution of an empty selection (flag 2, followed by the expansion),
+// and a chorded execution (flag 8, followed by the argument and its location).
+var recordedEvents = []string{
+	"KI0 5 0 5 héllo\n",
+	"Mx10 10 3 0 \n", "Mx8 11 0 3 Foo\n",
+	"Mx20 23 8 3 Foo\n", "Mx0 0 0 3 bar\n", "Mx0 0 0 8 /x:#1,#4\n",
+	"Mx30 33 1 3 Del\n",
+}
+
+// testRecording returns a recording of reads of recordedEvents,
+// split into reads at awkward places, and the write of the Del event.
+func testRecording(t *testing.T) []byte {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	data := []byte(strings.Join(recordedEvents, ""))
+	i := bytes.IndexByte(data, 0xA9) // inside é
+	r.record('r', data[:i])
+	r.record('r', data[i:i+20])
+	r.record('r', data[i+20:])
+	r.record('w', []byte("Mx30 33 \n"))
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReplayReadEvent(t *testing.T) {
+	recs, err := ReadEventRecords(bytes.NewReader(testRecording(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 4 || recs[0].Op != 'r' || recs[3].Op != 'w' || string(recs[3].Data) != "Mx30 33 \n" {
+		t.Fatalf("ReadEventRecords = %+v", recs)
+	}
+
+	w := Replay(recs, nil)
+	want := []Event{
+		{C1: 'K', C2: 'I', Q0: 0, Q1: 5, OrigQ0: 0, OrigQ1: 5, Nr: 5, Text: []byte("héllo")},
+		{C1: 'M', C2: 'x', Q0: 8, Q1: 11, OrigQ0: 10, OrigQ1: 10, Flag: 3, Nr: 3, Text: []byte("Foo")},
+		{C1: 'M', C2: 'x', Q0: 20, Q1: 23, OrigQ0: 20, OrigQ1: 23, Flag: 8, Nr: 3, Text: []byte("Foo"), Arg: []byte("bar"), Loc: []byte("/x:#1,#4")},
+		{C1: 'M', C2: 'x', Q0: 30, Q1: 33, OrigQ0: 30, OrigQ1: 33, Flag: 1, Nr: 3, Text: []byte("Del")},
+	}
+	for i := range want {
+		e, err := w.ReadEvent()
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(*e, want[i]) {
+			t.Errorf("event %d:\nhave %+v\nwant %+v", i, *e, want[i])
+		}
+	}
+	if e, err := w.ReadEvent(); err == nil {
+		t.Errorf("ReadEvent at end of recording = %+v", e)
+	}
+	if _, err := w.ReadAll("body"); err == nil {
+		t.Errorf("ReadAll of replayed window succeeded")
+	}
+}
+
+type replayHandler struct {
+	execs []string
+}
+
+func (h *replayHandler) ExecFoo(arg string) {
+	h.execs = append(h.execs, "Foo "+arg)
+}
+
+func (h *replayHandler) Execute(cmd string) bool { return false }
+func (h *replayHandler) Look(arg string) bool    { return false }
+
+func TestReplayEvents(t *testing.T) {
+	recs, err := ReadEventRecords(bytes.NewReader(testRecording(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := new(replayHandler)
+	var buf bytes.Buffer
+	out := NewRecorder(&buf)
+	ReplayEvents(recs, h, out)
+
+	// EventLoop does not pass the chorded argument to ExecFoo.
+	if want := []string{"Foo ", "Foo "}; !reflect.DeepEqual(h.execs, want) {
+		t.Errorf("executed %q, want %q", h.execs, want)
+	}
+	written, err := ReadEventRecords(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 1 || !bytes.Equal(written[0].Data, recs[3].Data) {
+		t.Errorf("replay wrote %+v, want %q", written, recs[3].Data)
+	}
+}
+
+type failHandler struct{ replayHandler }
+
+func (h *failHandler) ExecFoo() error {
+	return errors.New("Foo failed")
+}
+
+func TestReplayEventsError(t *testing.T) {
+	recs, err := ReadEventRecords(bytes.NewReader(testRecording(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The errors from the handler are recorded, not shown in acme,
+	// which would exit the program with no acme running.
+	var buf bytes.Buffer
+	ReplayEvents(recs, new(failHandler), NewRecorder(&buf))
+	written, err := ReadEventRecords(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops, errs []string
+	for _, r := range written {
+		ops = append(ops, string(r.Op))
+		if r.Op == 'e' {
+			errs = append(errs, string(r.Data))
+		}
+	}
+	if want := []string{"e", "e", "w"}; !reflect.DeepEqual(ops, want) {
+		t.Errorf("replay recorded ops %q, want %q", ops, want)
+	}
+	if want := []string{"Foo failed\n", "Foo failed\n"}; !reflect.DeepEqual(errs, want) {
+		t.Errorf("replay recorded errors %q, want %q", errs, want)
+	}
+}
+
+func TestReadEventRecordsErrors(t *testing.T) {
+	for _, bad := range []string{
+		"x 1 3\nabc\n",
+		"r 1\nabc\n",
+		"r 1 10\nabc\n",
+		"r 1 3\nabcd\n",
+	} {
+		if recs, err := ReadEventRecords(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadEventRecords(%q) = %+v, want error", bad, recs)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Command is a command that a Router runs when it is executed in a window.
+type Command struct {
+	// Name is the command name, as executed with button 2 ("Rerun").
+	Name string
+
+	// Help is a one-line description of the command, listed by Help.
+	Help string
+
+	// Parse, if non-nil, parses the command's argument
+	// into the Value passed to Run.
+	// If Parse is nil, the command takes no argument.
+	Parse func(arg string) (interface{}, error)
+
+	// Run runs the command.
+	// A non-nil error is reported in the window's +Errors window.
+	Run func(ctx context.Context, c *Call) error
+}
+
+// A Call describes a single execution of a Command.
+type Call struct {
+	Win   *Win
+	Event *Event
+
+	// Arg is the argument text: any text following the command name,
+	// followed by the chorded argument (Event.Arg), if present.
+	Arg string
+
+	// Loc is the location of the chorded argument (Event.Loc),
+	// such as "/home/user/file.go:#10,#20".
+	Loc string
+
+	// Value is the result of the command's Parse function.
+	Value interface{}
+}
+
+// ArgString is a Command.Parse function that accepts any argument,
+// returning it as a string.
+func ArgString(arg string) (interface{}, error) {
+	return arg, nil
+}
+
+// ArgInt is a Command.Parse function that accepts a decimal integer argument,
+// returning it as an int.
+func ArgInt(arg string) (interface{}, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", arg)
+	}
+	return n, nil
+}
+
+// A Router dispatches the events in a window to registered commands
+// and handler functions.
+// Events it does not handle are written back to acme,
+// which handles them in the usual way.
+type Router struct {
+	cmds  map[string]*Command
+	names []string
+
+	// Look, if non-nil, is called for a Look (button 3) in the window,
+	// with the target as expanded by w.ExpandLook.
+	// If it returns false, acme handles the Look itself.
+	Look func(ctx context.Context, w *Win, t LookTarget) bool
+
+	// Insert, if non-nil, is called when text is inserted in the window body
+	// (an 'I' event), including by typing.
+	Insert func(ctx context.Context, w *Win, e *Event)
+
+	// Delete, if non-nil, is called when text is deleted from the window body
+	// (a 'D' event).
+	Delete func(ctx context.Context, w *Win, e *Event)
+}
+
+// NewRouter returns a new Router with a single registered command,
+// Help, which lists the registered commands and their descriptions.
+func NewRouter() *Router {
+	r := &Router{cmds: make(map[string]*Command)}
+	r.Register(&Command{
+		Name: "Help",
+		Help: "list commands",
+		Run:  r.help,
+	})
+	return r
+}
+
+// Register registers the command with the router.
+// It panics if the command has no name or Run function,
+// or if a command with the same name is already registered.
+func (r *Router) Register(cmd *Command) {
+	if cmd.Name == "" || strings.ContainsAny(cmd.Name, " \t\n") {
+		panic("acme: invalid command name " + strconv.Quote(cmd.Name))
+	}
+	if cmd.Run == nil {
+		panic("acme: command " + cmd.Name + " has no Run function")
+	}
+	if r.cmds[cmd.Name] != nil {
+		panic("acme: command " + cmd.Name + " registered twice")
+	}
+	r.cmds[cmd.Name] = cmd
+	r.names = append(r.names, cmd.Name)
+}
+
+func (r *Router) help(ctx context.Context, c *Call) error {
+	names := append([]string(nil), r.names...)
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s\t%s\n", name, r.cmds[name].Help)
+	}
+	c.Win.Err(b.String())
+	return nil
+}
+
+// Run reads events from the window and dispatches them
+// until the window is deleted, in which case Run returns nil,
+// or until ctx is canceled, in which case Run returns ctx.Err().
+// On cancellation, Run closes the window's event file,
+// returning the handling of events to acme, and stops the event reader;
+// the window stays open, and Run may be called again to resume.
+// Run uses w.EventChan, so clients must not call ReadEvent
+// or use EventChan themselves.
+func (r *Router) Run(ctx context.Context, w *Win) error {
+	c := w.EventChan()
+	for {
+		select {
+		case <-ctx.Done():
+			w.stopEvents(c)
+			return ctx.Err()
+		case e, ok := <-c:
+			if !ok {
+				return nil
+			}
+			r.dispatch(ctx, w, e)
+		}
+	}
+}
+
+func (r *Router) dispatch(ctx context.Context, w *Win, e *Event) {
+	switch e.C2 {
+	case 'x', 'X': // execute
+		if !r.execute(ctx, w, e) {
+			w.WriteEvent(e)
+		}
+	case 'l', 'L': // look
+		if r.Look == nil {
+			w.WriteEvent(e)
+			break
+		}
+		w.loadText(e, nil)
+		t, err := w.ExpandLook(e)
+		if err != nil {
+			w.Err(err.Error())
+			w.WriteEvent(e)
+			break
+		}
+		if !r.Look(ctx, w, t) {
+			w.WriteEvent(e)
+		}
+	case 'I': // body insert
+		if r.Insert != nil {
+			r.Insert(ctx, w, e)
+		}
+	case 'D': // body delete
+		if r.Delete != nil {
+			r.Delete(ctx, w, e)
+		}
+	}
+}
+
+func (r *Router) execute(ctx context.Context, w *Win, e *Event) bool {
+	w.loadText(e, nil)
+	verb, arg := strings.TrimSpace(string(e.Text)), ""
+	if i := strings.IndexAny(verb, " \t\n"); i >= 0 {
+		verb, arg = verb[:i], strings.TrimSpace(verb[i+1:])
+	}
+	cmd := r.cmds[verb]
+	if cmd == nil {
+		return false
+	}
+
+	// Committed to handling the event.
+	if chord := strings.TrimSpace(string(e.Arg)); chord != "" {
+		if arg != "" {
+			arg += " "
+		}
+		arg += chord
+	}
+	c := &Call{Win: w, Event: e, Arg: arg, Loc: string(e.Loc)}
+	if cmd.Parse == nil {
+		if arg != "" {
+			w.Errf("%s takes no arguments", verb)
+			return true
+		}
+	} else {
+		v, err := cmd.Parse(arg)
+		if err != nil {
+			w.Errf("%s: %v", verb, err)
+			return true
+		}
+		c.Value = v
+	}
+	if err := cmd.Run(ctx, c); err != nil {
+		w.Errf("%s: %v", verb, err)
+	}
+	return true
+}
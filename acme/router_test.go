@@ -0,0 +1,63 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRouterExecute(t *testing.T) {
+	r := NewRouter()
+	var got *Call
+	r.Register(&Command{
+		Name:  "Rerun",
+		Parse: ArgString,
+		Run: func(ctx context.Context, c *Call) error {
+			got = c
+			return nil
+		},
+	})
+
+	tests := []struct {
+		e   *Event
+		arg string
+		loc string
+	}{
+		{&Event{C1: 'M', C2: 'x', Text: []byte("Rerun")}, "", ""},
+		{&Event{C1: 'M', C2: 'x', Text: []byte("Rerun -v  all ")}, "-v  all", ""},
+		{&Event{C1: 'M', C2: 'x', Flag: 8, Text: []byte("Rerun"), Arg: []byte("pkg"), Loc: []byte("/tmp/x:#3,#6")}, "pkg", "/tmp/x:#3,#6"},
+		{&Event{C1: 'M', C2: 'x', Flag: 8, Text: []byte("Rerun -v"), Arg: []byte("pkg")}, "-v pkg", ""},
+	}
+	for _, tt := range tests {
+		got = nil
+		if !r.execute(context.Background(), nil, tt.e) {
+			t.Errorf("execute(%q) not handled", tt.e.Text)
+			continue
+		}
+		if got == nil || got.Arg != tt.arg || got.Loc != tt.loc || got.Value != tt.arg {
+			t.Errorf("execute(%q) = %+v, want Arg=%q Loc=%q", tt.e.Text, got, tt.arg, tt.loc)
+		}
+	}
+
+	if r.execute(context.Background(), nil, &Event{C1: 'M', C2: 'x', Text: []byte("Put")}) {
+		t.Errorf("execute(Put) handled unregistered command")
+	}
+}
+
+func TestRouterRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering Help twice did not panic")
+		}
+	}()
+	r := NewRouter()
+	r.Register(&Command{Name: "Help", Run: func(context.Context, *Call) error { return nil }})
+}
+
+func TestArgInt(t *testing.T) {
+	if v, err := ArgInt("42"); err != nil || v != 42 {
+		t.Errorf("ArgInt(42) = %v, %v", v, err)
+	}
+	if _, err := ArgInt("x"); err == nil {
+		t.Errorf("ArgInt(x) succeeded")
+	}
+}
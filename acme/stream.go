@@ -0,0 +1,82 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A File is one of a window's files, read and written as a stream.
+// Reads and writes use the window's open file, as Read and Write do,
+// so they share its offset with other uses of the file.
+// Large files are read and written in as many 9P messages as needed.
+type File struct {
+	w    *Win
+	name string
+}
+
+// Body returns the window body as a stream.
+// Reads start at the current byte offset in the body,
+// which Seek sets; writes always append to the body.
+func (w *Win) Body() *File {
+	return &File{w, "body"}
+}
+
+// Tag returns the window tag as a stream.
+// Reads start at the current byte offset in the tag,
+// which Seek sets; writes always append to the tag.
+func (w *Win) Tag() *File {
+	return &File{w, "tag"}
+}
+
+// Data returns the window's data file as a stream.
+// Reads and writes take place at the window's address, set by Addr,
+// and advance it. The data file cannot Seek; set the address instead.
+func (w *Win) Data() *File {
+	return &File{w, "data"}
+}
+
+// Read reads from the file.
+func (f *File) Read(b []byte) (int, error) {
+	return f.w.Read(f.name, b)
+}
+
+// Write writes b to the file, in as many messages as needed.
+func (f *File) Write(b []byte) (int, error) {
+	return f.w.Write(f.name, b)
+}
+
+// Seek sets the byte offset for the next Read.
+// Acme does not report the length of window files,
+// so Seek accepts only io.SeekStart and io.SeekCurrent.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.name != "body" && f.name != "tag" {
+		return 0, fmt.Errorf("acme: cannot seek %s file", f.name)
+	}
+	if whence != io.SeekStart && whence != io.SeekCurrent {
+		return 0, errors.New("acme: cannot seek relative to end of file")
+	}
+	return f.w.Seek(f.name, offset, whence)
+}
+
+// Snapshot returns a reader for the body text in the rune range [q0, q1),
+// or, if q1 is negative, from q0 to the end of the body.
+// The reader uses the window's address and xdata file,
+// so it returns exactly the text in the range when Snapshot was called,
+// even if text is added to the body while it is being read.
+// The window's address must not be changed until the reader returns io.EOF.
+func (w *Win) Snapshot(q0, q1 int) (io.Reader, error) {
+	if q0 < 0 || q1 >= 0 && q1 < q0 {
+		return nil, fmt.Errorf("acme: invalid range #%d,#%d", q0, q1)
+	}
+	var err error
+	if q1 < 0 {
+		err = w.Addr("#%d,$", q0)
+	} else {
+		err = w.Addr("#%d,#%d", q0, q1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &File{w, "xdata"}, nil
+}
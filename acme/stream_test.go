@@ -0,0 +1,121 @@
+// +build !plan9
+
+package acme // import "9fans.net/go/acme"
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFileErrors(t *testing.T) {
+	w := Replay(nil, nil)
+	var _ io.ReadWriteSeeker = w.Body()
+
+	if _, err := w.Data().Seek(0, io.SeekStart); err == nil {
+		t.Errorf("Data().Seek succeeded")
+	}
+	if _, err := w.Body().Seek(0, io.SeekEnd); err == nil {
+		t.Errorf("Body().Seek(0, io.SeekEnd) succeeded")
+	}
+	if _, err := w.Tag().Read(make([]byte, 10)); err == nil {
+		t.Errorf("Tag().Read of replayed window succeeded")
+	}
+	if _, err := w.Snapshot(5, 2); err == nil {
+		t.Errorf("Snapshot(5, 2) succeeded")
+	}
+	if _, err := w.Snapshot(0, -1); err == nil {
+		t.Errorf("Snapshot(0, -1) of replayed window succeeded")
+	}
+}
+
+func TestFileRead(t *testing.T) {
+	body := strings.Repeat("héllo, wörld\n", 1000)
+	tag := "/a/x.go Del Snarf | Look "
+	w, _, done := testWin(t, body, tag)
+	defer done()
+
+	for _, tt := range []struct {
+		f    *File
+		text string
+	}{
+		{w.Body(), body},
+		{w.Tag(), tag},
+	} {
+		b, err := ioutil.ReadAll(tt.f)
+		if err != nil || string(b) != tt.text {
+			t.Errorf("read %s = %d bytes, %v; want %d bytes", tt.f.name, len(b), err, len(tt.text))
+		}
+		off, err := tt.f.Seek(9, io.SeekStart)
+		if err != nil || off != 9 {
+			t.Errorf("%s Seek(9, io.SeekStart) = %d, %v", tt.f.name, off, err)
+		}
+		off, err = tt.f.Seek(2, io.SeekCurrent)
+		if err != nil || off != 11 {
+			t.Errorf("%s Seek(2, io.SeekCurrent) = %d, %v", tt.f.name, off, err)
+		}
+		buf := make([]byte, 5)
+		if n, err := io.ReadFull(tt.f, buf); err != nil || string(buf[:n]) != tt.text[11:16] {
+			t.Errorf("%s read after Seek = %q, %v; want %q", tt.f.name, buf[:n], err, tt.text[11:16])
+		}
+	}
+}
+
+func TestFileWrite(t *testing.T) {
+	w, fw, done := testWin(t, "start\n", "")
+	defer done()
+
+	// Write splits large writes into messages acme accepts,
+	// which may divide a rune; acme joins the pieces.
+	text := strings.Repeat("€", 7000)
+	if n, err := w.Body().Write([]byte(text)); err != nil || n != len(text) {
+		t.Fatalf("Write = %d, %v; want %d", n, err, len(text))
+	}
+	if len(fw.writes) < 2 {
+		t.Errorf("Write of %d bytes sent %d messages", len(text), len(fw.writes))
+	}
+	total := 0
+	for _, n := range fw.writes {
+		if n > 8192 {
+			t.Errorf("Write sent message of %d bytes", n)
+		}
+		total += n
+	}
+	if total != len(text) {
+		t.Errorf("Write sent %d bytes, want %d", total, len(text))
+	}
+	if got := string(fw.body); got != "start\n"+text {
+		t.Errorf("body after Write is %d bytes, want %d", len(got), len("start\n"+text))
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	w, fw, done := testWin(t, "héllo, wörld\n", "")
+	defer done()
+
+	r, err := w.Snapshot(3, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Text added to the body does not extend the snapshot.
+	fw.acme.mu.Lock()
+	fw.body = append(fw.body, []rune("more text\n")...)
+	fw.acme.mu.Unlock()
+	b, err := ioutil.ReadAll(r)
+	if err != nil || string(b) != "lo, wö" {
+		t.Errorf("Snapshot(3, 9) read %q, %v; want %q", b, err, "lo, wö")
+	}
+
+	r, err = w.Snapshot(7, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadAll(r); err != nil || string(b) != "wörld\nmore text\n" {
+		t.Errorf("Snapshot(7, -1) read %q, %v", b, err)
+	}
+
+	if _, err := w.Snapshot(5, 2); err == nil || !strings.HasPrefix(err.Error(), "acme: ") {
+		t.Errorf("Snapshot(5, 2) = %v, want acme: error", err)
+	}
+}
@@ -0,0 +1,291 @@
+// +build !plan9
+
+package acme // import "9fans.net/go/acme"
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Table displays rows of values as aligned columns in a window body,
+// using the window's font as PrintTabbed does.
+// The first line of the body holds the column names.
+// Executing (button 2) a column name there sorts the rows by that column;
+// executing it again reverses the order.
+// Looking (button 3) at a row calls the table's Look function.
+type Table struct {
+	Columns []Column
+	Rows    []Row
+
+	// Look, if non-nil, is called when the user looks at a row.
+	// If it returns false, the look is passed back to acme.
+	Look func(row Row) bool
+
+	w     *Win
+	col   int  // sort column, or -1
+	desc  bool // sort in descending order
+	font  string
+	tab   int
+	lines []int // rune offsets of the start of each line in the body, and of its end
+}
+
+// A Row is a table row, holding one value for each column.
+type Row []interface{}
+
+// A Column describes a table column.
+//
+// The values in a column are typically all of one type.
+// By default, values are displayed using fmt.Sprint, except that
+// nil is shown as an empty string and a time.Time as "2006-01-02 15:04:05".
+// They are sorted numerically if they are numbers (including time.Duration),
+// chronologically if they are times, and otherwise by their displayed text.
+type Column struct {
+	Name string
+
+	// Format, if non-nil, returns the text displayed for a value.
+	Format func(v interface{}) string
+
+	// Less, if non-nil, reports whether x sorts before y.
+	Less func(x, y interface{}) bool
+}
+
+// NewTable returns a new table with the given columns, displayed in w.
+func NewTable(w *Win, cols ...Column) *Table {
+	return &Table{Columns: cols, w: w, col: -1}
+}
+
+// Append adds a row holding the given values to the table.
+// It does not redisplay the table.
+func (t *Table) Append(values ...interface{}) {
+	t.Rows = append(t.Rows, Row(values))
+}
+
+// SortBy sorts the table rows by the values in column col,
+// in descending order if desc is true.
+// The rows are sorted again by the same column, if needed, each time the
+// table is displayed. SortBy does not itself redisplay the table.
+func (t *Table) SortBy(col int, desc bool) {
+	t.col, t.desc = col, desc
+	t.sort()
+}
+
+func (t *Table) sort() {
+	if t.col < 0 || t.col >= len(t.Columns) {
+		return
+	}
+	c := &t.Columns[t.col]
+	less := c.Less
+	if less == nil {
+		less = func(x, y interface{}) bool { return lessValue(c, x, y) }
+	}
+	sort.SliceStable(t.Rows, func(i, j int) bool {
+		x, y := t.Rows[i].value(t.col), t.Rows[j].value(t.col)
+		if t.desc {
+			return less(y, x)
+		}
+		return less(x, y)
+	})
+}
+
+func (r Row) value(i int) interface{} {
+	if i < len(r) {
+		return r[i]
+	}
+	return nil
+}
+
+// Render displays the table in the window body, replacing its contents,
+// and marks the window clean.
+func (t *Table) Render() error {
+	ctl, err := t.w.ReadCtl()
+	if err != nil {
+		return err
+	}
+	t.font, t.tab = ctl.Font, ctl.TabWidth
+	var width func(string) int
+	if _, font, err := t.w.Font(); err == nil && font != nil {
+		width = font.StringWidth
+	}
+	if err := t.w.ReplaceBody(t.layout(t.tab, width)); err != nil {
+		return err
+	}
+	return t.w.Clean()
+}
+
+// layout returns the text of the table, sorted and aligned,
+// and records the offsets of its lines.
+func (t *Table) layout(tab int, width func(string) int) []byte {
+	t.sort()
+	var buf strings.Builder
+	for i, c := range t.Columns {
+		if i > 0 {
+			buf.WriteString("\t")
+		}
+		buf.WriteString(cell(c.Name))
+	}
+	buf.WriteString("\n")
+	for _, row := range t.Rows {
+		for i := range t.Columns {
+			if i > 0 {
+				buf.WriteString("\t")
+			}
+			buf.WriteString(cell(formatValue(&t.Columns[i], row.value(i))))
+		}
+		buf.WriteString("\n")
+	}
+
+	text := formatTabbed(buf.String(), tab, width)
+	t.lines = []int{0}
+	q := 0
+	for _, r := range string(text) {
+		q++
+		if r == '\n' {
+			t.lines = append(t.lines, q)
+		}
+	}
+	return text
+}
+
+// cell returns s with the tabs and newlines that would
+// break the table layout replaced by spaces.
+func cell(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// line returns the index of the body line holding the rune offset q,
+// or -1 if q is beyond the table.
+func (t *Table) line(q int) int {
+	i := sort.SearchInts(t.lines, q+1) - 1
+	if i < 0 || i >= len(t.lines)-1 {
+		return -1
+	}
+	return i
+}
+
+// Handle handles the event e if it is an execution of a column name
+// or a look at a row, reporting whether it did.
+// Handle is for clients running their own event loop;
+// EventLoop calls it for each event.
+func (t *Table) Handle(e *Event) bool {
+	switch e.C2 {
+	case 'X': // execute in body
+		if t.line(e.Q0) != 0 {
+			return false
+		}
+		name := strings.TrimSpace(string(e.Text))
+		for i, c := range t.Columns {
+			if c.Name == name {
+				t.SortBy(i, i == t.col && !t.desc)
+				if err := t.Render(); err != nil {
+					t.w.Err(err.Error())
+				}
+				return true
+			}
+		}
+	case 'L': // look in body
+		i := t.line(e.Q0)
+		if t.Look == nil || i < 1 || i > len(t.Rows) {
+			return false
+		}
+		return t.Look(t.Rows[i-1])
+	}
+	return false
+}
+
+// EventLoop reads events from the table's window and handles them,
+// passing those it does not handle back to acme.
+// After acme executes a command, such as Font, EventLoop displays
+// the table again if the window's font has changed.
+func (t *Table) EventLoop() {
+	for e := range t.w.EventChan() {
+		if t.Handle(e) {
+			continue
+		}
+		switch e.C2 {
+		case 'x', 'X':
+			t.w.WriteEvent(e)
+			if ctl, err := t.w.ReadCtl(); err == nil && (ctl.Font != t.font || ctl.TabWidth != t.tab) {
+				if err := t.Render(); err != nil {
+					t.w.Err(err.Error())
+				}
+			}
+		case 'l', 'L':
+			t.w.WriteEvent(e)
+		}
+	}
+}
+
+func formatValue(c *Column, v interface{}) string {
+	if c.Format != nil {
+		return c.Format(v)
+	}
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprint(v)
+}
+
+// lessValue reports whether x sorts before y in column c
+// when the column has no Less function.
+func lessValue(c *Column, x, y interface{}) bool {
+	if x == nil || y == nil {
+		return x == nil && y != nil
+	}
+	if tx, ok := x.(time.Time); ok {
+		if ty, ok := y.(time.Time); ok {
+			return tx.Before(ty)
+		}
+	}
+	vx, vy := reflect.ValueOf(x), reflect.ValueOf(y)
+	switch {
+	case isInt(vx) && isInt(vy):
+		return vx.Int() < vy.Int()
+	case isUint(vx) && isUint(vy):
+		return vx.Uint() < vy.Uint()
+	}
+	if fx, ok := number(vx); ok {
+		if fy, ok := number(vy); ok {
+			return fx < fy
+		}
+	}
+	return formatValue(c, x) < formatValue(c, y)
+}
+
+func isInt(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUint(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func number(v reflect.Value) (float64, bool) {
+	switch {
+	case isInt(v):
+		return float64(v.Int()), true
+	case isUint(v):
+		return float64(v.Uint()), true
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
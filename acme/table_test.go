@@ -0,0 +1,115 @@
+// +build !plan9
+
+package acme // import "9fans.net/go/acme"
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testTable() *Table {
+	t := NewTable(nil,
+		Column{Name: "Name"},
+		Column{Name: "Size"},
+		Column{Name: "Time"},
+		Column{Name: "Wait", Format: func(v interface{}) string { return v.(time.Duration).String() }},
+	)
+	day := time.Date(2020, 3, 31, 12, 0, 0, 0, time.UTC)
+	t.Append("acme.go", 1200, day, 2*time.Second)
+	t.Append("x\ty.go", 90, day.Add(-time.Hour), 300*time.Millisecond)
+	t.Append("b.go", 1000000, day.Add(time.Hour), time.Minute)
+	return t
+}
+
+func TestTableLayout(t *testing.T) {
+	tab := testTable()
+	// Each character is 10 pixels wide, and tab stops are every 40 pixels.
+	width := func(s string) int { return 10 * len([]rune(s)) }
+	got := string(tab.layout(40, width))
+	want := "" +
+		"Name\tSize\tTime\t\t\t\tWait\n" +
+		"acme.go\t1200\t2020-03-31 12:00:00\t2s\n" +
+		"x y.go\t90\t\t2020-03-31 11:00:00\t300ms\n" +
+		"b.go\t1000000\t2020-03-31 13:00:00\t1m0s\n"
+	if got != want {
+		t.Errorf("layout:\n%s\nwant:\n%s", got, want)
+	}
+	if want := []int{0, 23, 59, 96, 134}; !reflect.DeepEqual(tab.lines, want) {
+		t.Errorf("lines = %v, want %v", tab.lines, want)
+	}
+	for q, line := range map[int]int{0: 0, 22: 0, 23: 1, 60: 2, 133: 3, 134: -1} {
+		if l := tab.line(q); l != line {
+			t.Errorf("line(%d) = %d, want %d", q, l, line)
+		}
+	}
+}
+
+func TestTableSort(t *testing.T) {
+	tab := testTable()
+	names := func() []interface{} {
+		var names []interface{}
+		for _, r := range tab.Rows {
+			names = append(names, r[0])
+		}
+		return names
+	}
+	tests := []struct {
+		col  int
+		desc bool
+		want []interface{}
+	}{
+		{0, false, []interface{}{"acme.go", "b.go", "x\ty.go"}},
+		{1, false, []interface{}{"x\ty.go", "acme.go", "b.go"}},
+		{1, true, []interface{}{"b.go", "acme.go", "x\ty.go"}},
+		{2, false, []interface{}{"x\ty.go", "acme.go", "b.go"}},
+		{3, true, []interface{}{"b.go", "acme.go", "x\ty.go"}},
+	}
+	for _, tt := range tests {
+		tab.SortBy(tt.col, tt.desc)
+		if got := names(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SortBy(%d, %v) = %q, want %q", tt.col, tt.desc, got, tt.want)
+		}
+	}
+
+	c := &Column{}
+	for _, tt := range []struct {
+		x, y interface{}
+		less bool
+	}{
+		{nil, 1, true},
+		{1, nil, false},
+		{2, 10, true},
+		{uint8(200), 3, false},
+		{1.5, 2, true},
+		{"10", "9", true},
+	} {
+		if less := lessValue(c, tt.x, tt.y); less != tt.less {
+			t.Errorf("lessValue(%v, %v) = %v, want %v", tt.x, tt.y, less, tt.less)
+		}
+	}
+}
+
+func TestTableLook(t *testing.T) {
+	tab := testTable()
+	tab.w = Replay(nil, nil)
+	var looked Row
+	tab.Look = func(r Row) bool {
+		looked = r
+		return true
+	}
+	tab.layout(0, nil)
+	if !tab.Handle(&Event{C1: 'M', C2: 'L', Q0: tab.lines[2] + 1, Q1: tab.lines[2] + 1}) || looked[0] != "x\ty.go" {
+		t.Errorf("look at row 2 = %v", looked)
+	}
+	looked = nil
+	if tab.Handle(&Event{C1: 'M', C2: 'L', Q0: 2}) || looked != nil {
+		t.Errorf("look at header handled")
+	}
+	if tab.Handle(&Event{C1: 'M', C2: 'l', Q0: tab.lines[1]}) {
+		t.Errorf("look in tag handled")
+	}
+	if tab.Handle(&Event{C1: 'M', C2: 'X', Q0: tab.lines[1], Text: []byte("Name")}) {
+		t.Errorf("execute of column name outside header handled")
+	}
+}
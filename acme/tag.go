@@ -0,0 +1,140 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"strings"
+)
+
+// TagParts holds the three parts of a window tag.
+// In the tag
+//
+//	/home/user/file.go Del Snarf Undo | Look Rerun
+//
+// File is "/home/user/file.go", Sys is "Del Snarf Undo",
+// and User is "Look Rerun".
+type TagParts struct {
+	File string // the file name
+	Sys  string // the commands acme maintains, before the |
+	User string // the text after the |
+}
+
+// ParseTag splits the tag text into its parts.
+// A file name containing spaces may be quoted with single quotes,
+// with a quote inside the name doubled.
+func ParseTag(tag string) TagParts {
+	var p TagParts
+	tag = strings.TrimLeft(tag, " \t")
+	i := 0
+	if strings.HasPrefix(tag, "'") {
+		var name []byte
+		for i = 1; i < len(tag); i++ {
+			if tag[i] == '\'' {
+				if i+1 < len(tag) && tag[i+1] == '\'' {
+					i++
+				} else {
+					i++
+					break
+				}
+			}
+			name = append(name, tag[i])
+		}
+		p.File = string(name)
+	} else {
+		i = strings.IndexAny(tag, " \t")
+		if i < 0 {
+			i = len(tag)
+		}
+		p.File = tag[:i]
+	}
+	rest := tag[i:]
+	if j := strings.Index(rest, "|"); j >= 0 {
+		p.Sys = strings.TrimSpace(rest[:j])
+		p.User = strings.TrimSpace(rest[j+1:])
+	} else {
+		p.Sys = strings.TrimSpace(rest)
+	}
+	return p
+}
+
+// ReadTag returns the text of the window's tag.
+func (w *Win) ReadTag() (string, error) {
+	data, err := w.ReadAll("tag")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// TagParts reads the window's tag and splits it into its parts.
+func (w *Win) TagParts() (TagParts, error) {
+	tag, err := w.ReadTag()
+	if err != nil {
+		return TagParts{}, err
+	}
+	return ParseTag(tag), nil
+}
+
+// SetUserTag replaces the part of the window's tag after the | with text.
+// As with any change to the tag, the new length is reflected
+// in the TagLen reported by ReadCtl.
+func (w *Win) SetUserTag(text string) error {
+	if err := w.ClearTag(); err != nil {
+		return err
+	}
+	if text == "" {
+		return nil
+	}
+	_, err := w.Write("tag", []byte(" "+text))
+	return err
+}
+
+// AddTag adds the commands to the user part of the window's tag.
+// Commands already present anywhere in the tag are not added again,
+// so calling AddTag repeatedly does not grow the tag.
+func (w *Win) AddTag(cmds ...string) error {
+	p, err := w.TagParts()
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for _, f := range strings.Fields(p.Sys + " " + p.User) {
+		have[f] = true
+	}
+	var add []string
+	for _, cmd := range cmds {
+		if !have[cmd] {
+			have[cmd] = true
+			add = append(add, cmd)
+		}
+	}
+	if len(add) == 0 {
+		return nil
+	}
+	_, err = w.Write("tag", []byte(" "+strings.Join(add, " ")))
+	return err
+}
+
+// RemoveTag removes the commands from the user part of the window's tag,
+// leaving any other text the user has typed there in place.
+func (w *Win) RemoveTag(cmds ...string) error {
+	p, err := w.TagParts()
+	if err != nil {
+		return err
+	}
+	drop := make(map[string]bool)
+	for _, cmd := range cmds {
+		drop[cmd] = true
+	}
+	var keep []string
+	changed := false
+	for _, f := range strings.Fields(p.User) {
+		if drop[f] {
+			changed = true
+			continue
+		}
+		keep = append(keep, f)
+	}
+	if !changed {
+		return nil
+	}
+	return w.SetUserTag(strings.Join(keep, " "))
+}
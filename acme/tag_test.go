@@ -0,0 +1,26 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"testing"
+)
+
+var tagTests = []struct {
+	tag  string
+	want TagParts
+}{
+	{"", TagParts{}},
+	{"/tmp/x.go", TagParts{File: "/tmp/x.go"}},
+	{"/tmp/x.go Del Snarf Undo | Look ", TagParts{"/tmp/x.go", "Del Snarf Undo", "Look"}},
+	{"/tmp/ Del Snarf Get | Look Rerun Kill", TagParts{"/tmp/", "Del Snarf Get", "Look Rerun Kill"}},
+	{"/tmp/+watch Del Snarf |", TagParts{"/tmp/+watch", "Del Snarf", ""}},
+	{"'/tmp/a b.txt' Del Snarf | Look", TagParts{"/tmp/a b.txt", "Del Snarf", "Look"}},
+	{"'/tmp/it''s' Del | echo a|b", TagParts{"/tmp/it's", "Del", "echo a|b"}},
+}
+
+func TestParseTag(t *testing.T) {
+	for _, tt := range tagTests {
+		if got := ParseTag(tt.tag); got != tt.want {
+			t.Errorf("ParseTag(%q) = %+v, want %+v", tt.tag, got, tt.want)
+		}
+	}
+}
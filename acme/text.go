@@ -0,0 +1,227 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"9fans.net/go/acme/addr"
+	"9fans.net/go/acme/edit"
+)
+
+// Len returns the length of the window body, in runes.
+func (w *Win) Len() (int, error) {
+	ctl, err := w.ReadCtl()
+	if err != nil {
+		return 0, err
+	}
+	return ctl.BodyLen, nil
+}
+
+// ReadRange returns the body text in the rune range [q0, q1).
+// It leaves the window's addr set to the empty range at q1.
+func (w *Win) ReadRange(q0, q1 int) ([]byte, error) {
+	if q0 < 0 || q1 < q0 {
+		return nil, fmt.Errorf("invalid range #%d,#%d", q0, q1)
+	}
+	if err := w.Addr("#%d,#%d", q0, q1); err != nil {
+		return nil, err
+	}
+	return w.ReadAll("xdata")
+}
+
+// Insert inserts text into the body at rune offset q.
+func (w *Win) Insert(q int, text []byte) error {
+	return w.Replace(q, q, text)
+}
+
+// Delete deletes the body text in the rune range [q0, q1).
+func (w *Win) Delete(q0, q1 int) error {
+	return w.Replace(q0, q1, nil)
+}
+
+// Replace replaces the body text in the rune range [q0, q1) with text.
+func (w *Win) Replace(q0, q1 int, text []byte) error {
+	if q0 < 0 || q1 < q0 {
+		return fmt.Errorf("invalid range #%d,#%d", q0, q1)
+	}
+	if err := w.Addr("#%d,#%d", q0, q1); err != nil {
+		return err
+	}
+	_, err := w.Write("data", text)
+	return err
+}
+
+// An Edit describes the replacement of the body text
+// in the rune range [Q0, Q1) with Text.
+// An insertion has Q0 == Q1; a deletion has empty Text.
+type Edit struct {
+	Q0, Q1 int
+	Text   []byte
+}
+
+var errOverlap = errors.New("overlapping edits")
+
+// sortEdits returns a copy of edits sorted by position,
+// or an error if any two edits overlap.
+// Two insertions at the same offset are kept in their original order.
+func sortEdits(edits []Edit) ([]Edit, error) {
+	sorted := make([]Edit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Q0 < sorted[j].Q0 || sorted[i].Q0 == sorted[j].Q0 && sorted[i].Q1 < sorted[j].Q1
+	})
+	for i, e := range sorted {
+		if e.Q0 < 0 || e.Q1 < e.Q0 {
+			return nil, fmt.Errorf("invalid edit #%d,#%d", e.Q0, e.Q1)
+		}
+		if i > 0 && e.Q0 < sorted[i-1].Q1 {
+			return nil, errOverlap
+		}
+	}
+	return sorted, nil
+}
+
+// Edit applies the edits to the window body.
+// The edits are given in terms of rune offsets in the body
+// before any of them is applied, and they must not overlap.
+// Edit applies them back to front, so that earlier offsets
+// remain valid, and marks them as a single change,
+// so that one Undo in acme reverts the whole batch.
+func (w *Win) Edit(edits []Edit) error {
+	sorted, err := sortEdits(edits)
+	if err != nil {
+		return err
+	}
+	if len(sorted) == 0 {
+		return nil
+	}
+	if err := w.Mark(); err != nil {
+		return err
+	}
+	if err := w.NoMark(); err != nil {
+		return err
+	}
+	for i := len(sorted) - 1; i >= 0; i-- {
+		e := sorted[i]
+		if err := w.Replace(e.Q0, e.Q1, e.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceBody replaces the window body with text.
+// Rather than clearing the body and writing text, as Clear and Write would,
+// ReplaceBody computes a diff against the current body and rewrites only
+// the changed text, in a single undoable batch.
+// It then restores the window's selection (dot), adjusted for the edits.
+//
+// Acme's files give no way to read or set the window's visible origin,
+// so ReplaceBody cannot restore it directly. It does not need to:
+// acme moves the origin along with edits made before it, keeping the same
+// text at the top of the window, and ReplaceBody leaves unchanged text in place
+// and sets dot without asking acme to show it, so the window does not scroll.
+func (w *Win) ReplaceBody(text []byte) error {
+	old, err := w.ReadAll("body")
+	if err != nil {
+		return err
+	}
+	edits := diffEdits(old, text)
+	if len(edits) == 0 {
+		return nil
+	}
+	if err := w.AddrToDot(); err != nil {
+		return err
+	}
+	q0, q1, err := w.ReadAddr()
+	if err != nil {
+		return err
+	}
+	if err := w.Edit(edits); err != nil {
+		return err
+	}
+	q0 = adjustOffset(q0, edits)
+	q1 = adjustOffset(q1, edits)
+	if err := w.Addr("#%d,#%d", q0, q1); err != nil {
+		return err
+	}
+	return w.DotToAddr()
+}
+
+// ExecEdit runs the script, written in the command language of acme's Edit
+// command (see package 9fans.net/go/acme/edit), on the window body,
+// with dot set to the window's selection.
+// The script's changes are applied as a single undoable batch,
+// and the output of its p and = commands is shown in the +Errors window.
+func (w *Win) ExecEdit(script string) error {
+	s, err := edit.Parse(script)
+	if err != nil {
+		return err
+	}
+	body, err := w.ReadAll("body")
+	if err != nil {
+		return err
+	}
+	if err := w.AddrToDot(); err != nil {
+		return err
+	}
+	q0, q1, err := w.ReadAddr()
+	if err != nil {
+		return err
+	}
+	f := &edit.File{
+		Text: []rune(string(body)),
+		Dot:  addr.Range{Q0: q0, Q1: q1},
+	}
+	if p, err := w.TagParts(); err == nil {
+		f.Name = p.File
+	}
+	var out bytes.Buffer
+	changes, err := s.Run(f, &out)
+	if out.Len() > 0 {
+		w.Err(out.String())
+	}
+	if err != nil {
+		return err
+	}
+	edits := make([]Edit, len(changes))
+	for i, c := range changes {
+		edits[i] = Edit{Q0: c.Q0, Q1: c.Q1, Text: []byte(c.Text)}
+	}
+	if err := w.Edit(edits); err != nil {
+		return err
+	}
+	if len(edits) == 0 {
+		return nil
+	}
+	q0 = adjustOffset(q0, edits)
+	q1 = adjustOffset(q1, edits)
+	if err := w.Addr("#%d,#%d", q0, q1); err != nil {
+		return err
+	}
+	return w.DotToAddr()
+}
+
+// ByteOffset returns the byte offset in the UTF-8 text of the rune offset q.
+// If q is beyond the end of text, ByteOffset returns len(text).
+func ByteOffset(text []byte, q int) int {
+	i := 0
+	for ; q > 0 && i < len(text); q-- {
+		_, size := utf8.DecodeRune(text[i:])
+		i += size
+	}
+	return i
+}
+
+// RuneOffset returns the rune offset in the UTF-8 text of the byte offset off,
+// which should fall on a rune boundary.
+// If off is beyond the end of text, RuneOffset returns the number of runes in text.
+func RuneOffset(text []byte, off int) int {
+	if off > len(text) {
+		off = len(text)
+	}
+	return utf8.RuneCount(text[:off])
+}
@@ -0,0 +1,66 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"testing"
+)
+
+var offsetTests = []struct {
+	text string
+	q    int
+	off  int
+}{
+	{"", 0, 0},
+	{"", 3, 0},
+	{"abc", 0, 0},
+	{"abc", 2, 2},
+	{"abc", 5, 3},
+	{"héllo", 2, 3},
+	{"héllo", 5, 6},
+	{"日本語", 1, 3},
+	{"日本語", 3, 9},
+}
+
+func TestOffsets(t *testing.T) {
+	for _, tt := range offsetTests {
+		if off := ByteOffset([]byte(tt.text), tt.q); off != tt.off {
+			t.Errorf("ByteOffset(%q, %d) = %d, want %d", tt.text, tt.q, off, tt.off)
+		}
+		q := tt.q
+		if off := len(tt.text); tt.off == off {
+			q = len([]rune(tt.text))
+		}
+		if got := RuneOffset([]byte(tt.text), tt.off); got != q {
+			t.Errorf("RuneOffset(%q, %d) = %d, want %d", tt.text, tt.off, got, q)
+		}
+	}
+}
+
+func TestSortEdits(t *testing.T) {
+	edits := []Edit{
+		{Q0: 10, Q1: 12, Text: []byte("x")},
+		{Q0: 3, Q1: 3, Text: []byte("a")},
+		{Q0: 3, Q1: 3, Text: []byte("b")},
+		{Q0: 0, Q1: 3},
+	}
+	sorted, err := sortEdits(edits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order string
+	for _, e := range sorted {
+		order += string(e.Text) + "."
+	}
+	if order != ".a.b.x." {
+		t.Errorf("sorted order = %q, want %q", order, ".a.b.x.")
+	}
+	if edits[0].Q0 != 10 {
+		t.Errorf("sortEdits modified its argument")
+	}
+
+	if _, err := sortEdits([]Edit{{Q0: 0, Q1: 5}, {Q0: 4, Q1: 6}}); err == nil {
+		t.Errorf("sortEdits accepted overlapping edits")
+	}
+	if _, err := sortEdits([]Edit{{Q0: 5, Q1: 4}}); err == nil {
+		t.Errorf("sortEdits accepted backward edit")
+	}
+}
@@ -0,0 +1,170 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"path"
+	"strings"
+	"sync"
+)
+
+// A Tracker follows the events in acme's log to keep track of
+// the focused window, the most recently focused windows,
+// and the files most recently focused in each directory.
+// A Tracker is safe for use by multiple goroutines.
+type Tracker struct {
+	mu      sync.Mutex
+	max     int
+	focused bool                // whether mru[0] is focused
+	jumped  int                 // ID of the window last returned by Jump, or 0
+	mru     []WinInfo           // open windows, most recently focused first
+	recent  map[string][]string // file names by directory, most recently focused first
+}
+
+// NewTracker returns a new Tracker that remembers up to max windows
+// and max files in each directory. If max is 0, it is 50.
+func NewTracker(max int) *Tracker {
+	if max <= 0 {
+		max = 50
+	}
+	return &Tracker{max: max, recent: make(map[string][]string)}
+}
+
+// Run reads events from r and applies them to t until reading fails,
+// returning the error.
+func (t *Tracker) Run(r *LogReader) error {
+	for {
+		e, err := r.Read()
+		if err != nil {
+			return err
+		}
+		t.Update(e)
+	}
+}
+
+// Update applies the log event e.
+// A focus event moves the window to the front of the list of recent windows
+// and its file to the front of the recent files in its directory.
+// A del event removes the window from the list.
+// Other events update the window's name, if it is listed.
+func (t *Tracker) Update(e LogEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	i := t.index(e.ID)
+	switch e.Op {
+	case "focus":
+		if i >= 0 {
+			t.mru = append(t.mru[:i], t.mru[i+1:]...)
+		}
+		t.mru = append([]WinInfo{{e.ID, e.Name}}, t.mru...)
+		t.focused = true
+		t.jumped = 0
+		if len(t.mru) > t.max {
+			t.mru = t.mru[:t.max]
+		}
+		if isFile(e.Name) {
+			dir := path.Dir(e.Name)
+			t.recent[dir] = addRecent(t.recent[dir], e.Name, t.max)
+		}
+	case "del":
+		if i >= 0 {
+			t.mru = append(t.mru[:i], t.mru[i+1:]...)
+		}
+		if i == 0 {
+			t.focused = false
+		}
+	default:
+		if i >= 0 {
+			t.mru[i].Name = e.Name
+		}
+	}
+}
+
+func (t *Tracker) index(id int) int {
+	for i, w := range t.mru {
+		if w.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// isFile reports whether the window name names a file:
+// it is an absolute path, not a directory (ending in a slash),
+// and not a special window such as +Errors.
+func isFile(name string) bool {
+	return strings.HasPrefix(name, "/") && !strings.HasSuffix(name, "/") && !strings.HasPrefix(path.Base(name), "+")
+}
+
+func addRecent(list []string, name string, max int) []string {
+	out := []string{name}
+	for _, s := range list {
+		if s != name && len(out) < max {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Focused returns the focused window.
+// It returns false if no window has been focused since t started
+// or if the focused window has been deleted.
+func (t *Tracker) Focused() (WinInfo, bool) {
+	return t.Previous(0)
+}
+
+// Previous returns the window focused n windows before the focused window,
+// not counting windows since deleted.
+// Previous(1) is the window to jump back to.
+// If the focused window has been deleted, Previous(1) is the window
+// focused before it.
+func (t *Tracker) Previous(n int) (WinInfo, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.focused {
+		n--
+	}
+	return t.at(n)
+}
+
+// Jump returns the window to show to jump back n windows.
+// Showing a window does not focus it, so until another window is focused,
+// Jump counts back from the window it last returned rather than from
+// the focused window, and repeated jumps go further back.
+func (t *Tracker) Jump(n int) (WinInfo, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if i := t.index(t.jumped); i >= 0 {
+		n += i
+	} else if !t.focused {
+		n--
+	}
+	w, ok := t.at(n)
+	if ok {
+		t.jumped = w.ID
+	}
+	return w, ok
+}
+
+func (t *Tracker) at(i int) (WinInfo, bool) {
+	if i < 0 || i >= len(t.mru) {
+		return WinInfo{}, false
+	}
+	return t.mru[i], true
+}
+
+// Windows returns the open windows, most recently focused first.
+// Windows not focused since t started are not included.
+func (t *Tracker) Windows() []WinInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]WinInfo(nil), t.mru...)
+}
+
+// Recent returns the names of the files in the directory dir
+// that have been focused, most recently focused first.
+// The files' windows need not still be open.
+func (t *Tracker) Recent(dir string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.recent[path.Clean(dir)]...)
+}
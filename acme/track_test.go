@@ -0,0 +1,73 @@
+package acme // import "9fans.net/go/acme"
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(3)
+	if _, ok := tr.Focused(); ok {
+		t.Errorf("new tracker has a focused window")
+	}
+	for _, e := range []LogEvent{
+		{1, "new", "/a/x.go"},
+		{1, "focus", "/a/x.go"},
+		{2, "focus", "/a/y.go"},
+		{3, "focus", "/a/+Errors"},
+		{4, "focus", "/a/"},
+		{2, "focus", "/a/y.go"},
+		{1, "focus", "/a/x.go"},
+		{5, "focus", "/b/z.go"},
+		{1, "put", "/a/w.go"},
+	} {
+		tr.Update(e)
+	}
+	want := []WinInfo{{5, "/b/z.go"}, {1, "/a/w.go"}, {2, "/a/y.go"}}
+	if got := tr.Windows(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Windows = %v, want %v", got, want)
+	}
+	if w, ok := tr.Focused(); !ok || w.ID != 5 {
+		t.Errorf("Focused = %v, %v", w, ok)
+	}
+	if w, ok := tr.Previous(1); !ok || w.ID != 1 {
+		t.Errorf("Previous(1) = %v, %v", w, ok)
+	}
+	if _, ok := tr.Previous(3); ok {
+		t.Errorf("Previous(3) succeeded")
+	}
+	if got, want := tr.Recent("/a/"), []string{"/a/x.go", "/a/y.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Recent(/a/) = %v, want %v", got, want)
+	}
+
+	// Jumps count back from the last jump until a window is focused.
+	for _, want := range []int{1, 2} {
+		if w, ok := tr.Jump(1); !ok || w.ID != want {
+			t.Errorf("Jump(1) = %v, %v, want window %d", w, ok, want)
+		}
+	}
+	if w, ok := tr.Jump(1); ok {
+		t.Errorf("Jump(1) past the last window = %v", w)
+	}
+	if w, ok := tr.Previous(1); !ok || w.ID != 1 {
+		t.Errorf("Previous(1) after Jump = %v, %v", w, ok)
+	}
+	tr.Update(LogEvent{1, "focus", "/a/w.go"})
+	if w, ok := tr.Jump(1); !ok || w.ID != 5 {
+		t.Errorf("Jump(1) after focus = %v, %v", w, ok)
+	}
+	tr.Update(LogEvent{5, "focus", "/b/z.go"})
+
+	// Deleting the focused window leaves none focused,
+	// and the previous window is the one focused before it.
+	tr.Update(LogEvent{5, "del", "/b/z.go"})
+	if w, ok := tr.Focused(); ok {
+		t.Errorf("Focused after del = %v", w)
+	}
+	if w, ok := tr.Previous(1); !ok || w.ID != 1 {
+		t.Errorf("Previous(1) after del = %v, %v", w, ok)
+	}
+	if got := tr.Recent("/b"); !reflect.DeepEqual(got, []string{"/b/z.go"}) {
+		t.Errorf("Recent(/b) after del = %v", got)
+	}
+}
@@ -0,0 +1,293 @@
+// Win runs an interactive program in an acme window.
+//
+// Usage:
+//
+//	win [command [arg...]]
+//
+// Win creates a new window named dir/-host, where dir is the current
+// directory, and runs the command (default $SHELL -i) on a pseudo-terminal,
+// appending its output to the window body.
+//
+// Text typed after the end of the output is sent to the command,
+// a line at a time, when a newline is typed. Typing the Delete key
+// interrupts the command, as ^C does in a terminal.
+// Executing Send sends the selected text, adding a final newline if needed,
+// and executing Del hangs up the command and deletes the window.
+//
+// Win sets TERM=dumb and sets $winid to the window ID.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"9fans.net/go/acme"
+)
+
+const (
+	intr = 0x03 // ^C, the terminal interrupt character
+	del  = 0x7F // the Delete key
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("win: ")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: win [command [arg...]]\n")
+		os.Exit(2)
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+		args = []string{shell, "-i"}
+	}
+
+	w, err := acme.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = filepath.Base(args[0])
+	}
+	w.Name("%s/-%s", dir, host)
+	w.SetErrorPrefix(dir + "/")
+	w.AddTag("Send")
+	w.Clean()
+
+	master, slave, err := openPty()
+	if err != nil {
+		w.Errf("%v", err)
+		w.Del(true)
+		log.Fatal(err)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	cmd.Env = append(os.Environ(), "TERM=dumb", fmt.Sprintf("winid=%d", w.ID()))
+	cmd.SysProcAttr = sysProcAttr()
+	if err := cmd.Start(); err != nil {
+		w.Errf("%v", err)
+		w.Del(true)
+		log.Fatal(err)
+	}
+	slave.Close()
+
+	p := &proc{w: w, pty: master, cmd: cmd}
+	p.run()
+}
+
+// A proc is a command running in a window.
+type proc struct {
+	w   *acme.Win
+	pty *os.File
+	cmd *exec.Cmd
+
+	// q is the output point: the rune offset in the body
+	// where output is inserted. Text after q is pending input.
+	q int
+
+	// echo is input sent to the command
+	// that the terminal has not yet echoed.
+	echo []byte
+}
+
+func (p *proc) run() {
+	out := make(chan []byte)
+	go p.readOutput(out)
+	events := p.w.EventChan()
+	for {
+		select {
+		case b, ok := <-out:
+			if !ok {
+				p.cmd.Wait()
+				p.w.Clean()
+				p.w.CloseFiles()
+				return
+			}
+			p.output(b)
+		case e, ok := <-events:
+			if !ok || e.C2 == 0 {
+				// Window deleted.
+				hangup(p.cmd.Process)
+				return
+			}
+			p.event(e)
+		}
+	}
+}
+
+// readOutput reads the command's output from the pty and sends it on c,
+// in chunks ending on UTF-8 sequence boundaries.
+// It closes c when the command exits.
+func (p *proc) readOutput(c chan<- []byte) {
+	var partial []byte
+	buf := make([]byte, 8192)
+	for {
+		n, err := p.pty.Read(buf)
+		if n > 0 {
+			b := append(partial, buf[:n]...)
+			i := len(b)
+			for j := 0; j < utf8.UTFMax && j < len(b); j++ {
+				if utf8.RuneStart(b[len(b)-1-j]) {
+					if !utf8.FullRune(b[len(b)-1-j:]) {
+						i = len(b) - 1 - j
+					}
+					break
+				}
+			}
+			partial = append([]byte(nil), b[i:]...)
+			if i > 0 {
+				c <- b[:i]
+			}
+		}
+		if err != nil {
+			// Linux returns EIO once the last process using the pty exits.
+			if err != io.EOF && !strings.Contains(err.Error(), "input/output error") {
+				p.w.Errf("%v", err)
+			}
+			close(c)
+			return
+		}
+	}
+}
+
+// output inserts output from the command at the output point.
+func (p *proc) output(b []byte) {
+	b = bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
+	b = bytes.Replace(b, []byte("\r"), nil, -1)
+
+	// Drop the terminal's echo of input already in the body.
+	n := 0
+	for n < len(b) && n < len(p.echo) && b[n] == p.echo[n] {
+		n++
+	}
+	if n < len(p.echo) && n < len(b) {
+		// Output not an echo; the terminal is not echoing.
+		p.echo = nil
+		n = 0
+	} else {
+		p.echo = p.echo[n:]
+		b = b[n:]
+	}
+	if len(b) == 0 {
+		return
+	}
+
+	if err := p.w.Addr("#%d", p.q); err != nil {
+		return
+	}
+	p.w.Write("data", b)
+	p.q += utf8.RuneCount(b)
+	p.w.Addr("#%d", p.q)
+	p.w.DotToAddr()
+	p.w.Show()
+	p.w.Clean()
+}
+
+func (p *proc) event(e *acme.Event) {
+	switch e.C2 {
+	case 'I':
+		if e.C1 == 'E' || e.C1 == 'F' {
+			// Our own writes; p.q is already updated.
+			return
+		}
+		if e.Q0 < p.q {
+			p.q += e.Q1 - e.Q0
+			return
+		}
+		if bytes.IndexByte(e.Text, del) >= 0 {
+			p.interrupt()
+			return
+		}
+		p.sendInput()
+	case 'D':
+		if e.C1 == 'E' || e.C1 == 'F' {
+			return
+		}
+		switch {
+		case e.Q1 <= p.q:
+			p.q -= e.Q1 - e.Q0
+		case e.Q0 < p.q:
+			p.q = e.Q0
+		}
+	case 'x', 'X':
+		switch strings.TrimSpace(string(e.Text)) {
+		case "Send":
+			p.send()
+			return
+		case "Del", "Delete":
+			hangup(p.cmd.Process)
+			p.w.Clean()
+		}
+		p.w.WriteEvent(e)
+	case 'l', 'L':
+		p.w.WriteEvent(e)
+	}
+}
+
+// interrupt removes the pending input, including the typed Delete key,
+// and interrupts the command.
+func (p *proc) interrupt() {
+	if n, err := p.w.Len(); err == nil && n > p.q {
+		p.w.Delete(p.q, n)
+	}
+	p.echo = nil
+	p.pty.Write([]byte{intr})
+}
+
+// sendInput sends the complete lines of pending input to the command.
+func (p *proc) sendInput() {
+	n, err := p.w.Len()
+	if err != nil || n <= p.q {
+		return
+	}
+	text, err := p.w.ReadRange(p.q, n)
+	if err != nil {
+		return
+	}
+	i := bytes.LastIndexByte(text, '\n')
+	if i < 0 {
+		return
+	}
+	line := text[:i+1]
+	if _, err := p.pty.Write(line); err != nil {
+		p.w.Errf("%v", err)
+		return
+	}
+	p.echo = append(p.echo, line...)
+	p.q += utf8.RuneCount(line)
+	p.w.Clean()
+}
+
+// send appends the selected text to the pending input and sends it.
+func (p *proc) send() {
+	text := p.w.Selection()
+	if text == "" {
+		return
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	p.w.Addr("$")
+	p.w.Write("data", []byte(text))
+	p.sendInput()
+}
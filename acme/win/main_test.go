@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"9fans.net/go/acme"
+)
+
+// replayProc returns a proc with output point q
+// whose window replays the given event file data.
+// Events written back by the proc are recorded in out.
+func replayProc(q int, events string, out *bytes.Buffer) *proc {
+	recs := []acme.EventRecord{{Op: 'r', Data: []byte(events)}}
+	return &proc{w: acme.Replay(recs, acme.NewRecorder(out)), q: q}
+}
+
+func TestEventOutputPoint(t *testing.T) {
+	tests := []struct {
+		event string
+		q     int // output point after the event, starting at 10
+	}{
+		{"KI3 5 0 2 ab\n", 12},         // typed before the output point
+		{"EI10 18 0 8 12345678\n", 10}, // our own output
+		{"FI10 13 0 3 abc\n", 10},      // our own write to the body file
+		{"KD0 2 0 0 \n", 8},            // deleted before the output point
+		{"KD8 15 0 0 \n", 8},           // deleted across the output point
+		{"KD10 12 0 0 \n", 10},         // deleted pending input
+		{"ED0 5 0 0 \n", 10},           // our own deletion
+		{"KI10 11 0 1 x\n", 10},        // typed pending input
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		p := replayProc(10, tt.event, &out)
+		e, err := p.w.ReadEvent()
+		if err != nil {
+			t.Fatalf("%q: %v", tt.event, err)
+		}
+		p.event(e)
+		if p.q != tt.q {
+			t.Errorf("after %q, q = %d, want %d", tt.event, p.q, tt.q)
+		}
+	}
+}
+
+func TestEventInterrupt(t *testing.T) {
+	var out bytes.Buffer
+	p := replayProc(10, "KI12 13 0 1 \x7f\n", &out)
+	p.echo = []byte("ls\n")
+	e, err := p.w.ReadEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.event(e)
+	if p.echo != nil || p.q != 10 {
+		t.Errorf("after Delete key, echo = %q, q = %d; want nil, 10", p.echo, p.q)
+	}
+}
+
+func TestEventWriteBack(t *testing.T) {
+	var out bytes.Buffer
+	p := replayProc(0, "ML0 3 0 3 foo\nMx0 3 0 3 Foo\n", &out)
+	for i := 0; i < 2; i++ {
+		e, err := p.w.ReadEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.event(e)
+	}
+	recs, err := acme.ReadEventRecords(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written []string
+	for _, r := range recs {
+		written = append(written, string(r.Data))
+	}
+	if len(written) != 2 || written[0] != "ML0 3 \n" || written[1] != "Mx0 3 \n" {
+		t.Errorf("wrote back %q, want the Look and Foo events", written)
+	}
+}
+
+func TestOutputEcho(t *testing.T) {
+	tests := []struct {
+		echo string
+		out  string
+		left string // echo left after the output
+	}{
+		{"ls\n", "ls\r\n", ""},
+		{"ls\n", "l", "s\n"},
+		{"ls\n", "ls\r\nfile\r\n", ""},
+		{"abc\n", "xyz\n", ""}, // the terminal is not echoing
+		{"", "file\n", ""},
+	}
+	for _, tt := range tests {
+		p := replayProc(0, "", new(bytes.Buffer))
+		p.echo = []byte(tt.echo)
+		p.output([]byte(tt.out))
+		if string(p.echo) != tt.left {
+			t.Errorf("echo %q, output %q: echo left %q, want %q", tt.echo, tt.out, p.echo, tt.left)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func openPty() (master, slave *os.File, err error) {
+	return nil, nil, errors.New("pseudo-terminals not supported on this system")
+}
+
+func sysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+func hangup(p *os.Process) {
+	p.Kill()
+}
@@ -0,0 +1,121 @@
+// +build !plan9
+
+package acme
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandLookTag(t *testing.T) {
+	tag := "/tmp/dir/file.go Del Snarf | Look x.go:3 "
+	w, _, done := testWin(t, strings.Repeat("body text ", 10), tag)
+	defer done()
+
+	q := strings.Index(tag, "x.go") + 1
+	e := &Event{C1: 'M', C2: 'l', Q0: q, Q1: q, OrigQ0: q, OrigQ1: q}
+	got, err := w.ExpandLook(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q0 := strings.Index(tag, "x.go")
+	want := LookTarget{Kind: LookFile, Text: "x.go:3", Q0: q0, Q1: q0 + 6, Path: "/tmp/dir/x.go", Addr: "3"}
+	if got != want {
+		t.Errorf("ExpandLook in tag = %+v, want %+v", got, want)
+	}
+
+	// The same offsets in the body are plain text.
+	e.C2 = 'L'
+	got, err = w.ExpandLook(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Kind != LookText || got.Path != "" {
+		t.Errorf("ExpandLook in body = %+v, want text", got)
+	}
+}
+
+func TestRouterCancel(t *testing.T) {
+	w, fw, done := testWin(t, "", "/tmp/x Del ")
+	defer done()
+
+	ran := make(chan bool, 1)
+	r := NewRouter()
+	r.Register(&Command{
+		Name: "Rerun",
+		Run: func(ctx context.Context, c *Call) error {
+			ran <- true
+			return nil
+		},
+	})
+	run := func() (stop func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() { errc <- r.Run(ctx, w) }()
+		fw.sendEvent("MX0 5 0 5 Rerun\n")
+		select {
+		case <-ran:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for command")
+		}
+		return func() {
+			cancel()
+			if err := <-errc; err != context.Canceled {
+				t.Errorf("Run = %v, want %v", err, context.Canceled)
+			}
+		}
+	}
+
+	c := w.EventChan()
+	run()()
+
+	// The event reader exits, closing the event channel.
+	timeout := time.After(5 * time.Second)
+	for closed := false; !closed; {
+		select {
+		case _, ok := <-c:
+			closed = !ok
+		case <-timeout:
+			t.Fatal("event reader still running after cancel")
+		}
+	}
+
+	// The window is still managed, and a second Run reads its events.
+	if !managed(w) {
+		t.Errorf("canceled Run removed window")
+	}
+	run()()
+	if !managed(w) {
+		t.Errorf("second canceled Run removed window")
+	}
+}
+
+// managed reports whether w is in the list of managed windows.
+func managed(w *Win) bool {
+	windowsMu.Lock()
+	defer windowsMu.Unlock()
+	for x := windows; x != nil; x = x.next {
+		if x == w {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAppendErrors(t *testing.T) {
+	w, fw, done := testWin(t, "old\n", "/a/+Errors Del ")
+	defer done()
+
+	if err := appendErrors(w, []byte("x.go:1: bad\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(fw.body); got != "old\nx.go:1: bad\n" {
+		t.Errorf("body = %q", got)
+	}
+	if want := []string{"dot=addr", "show"}; !reflect.DeepEqual(fw.ctl, want) {
+		t.Errorf("ctl = %q, want %q", fw.ctl, want)
+	}
+}
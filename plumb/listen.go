@@ -0,0 +1,188 @@
+package plumb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"9fans.net/go/plan9"
+	"9fans.net/go/plan9/client"
+)
+
+// A Listener receives the messages sent to a plumb port.
+type Listener struct {
+	Port string // the port, such as "edit"
+
+	// Err, if non-nil, is called with each error receiving messages.
+	// A message that cannot be decoded is reported as a *DecodeError
+	// and skipped. Other errors reading or reopening the port, as when
+	// the plumber exits, are followed by an attempt to reopen it.
+	Err func(error)
+
+	// Retry is the delay before reopening the port after an error.
+	// Zero means one second.
+	Retry time.Duration
+
+	open func(port string) (io.ReadCloser, error) // for testing
+}
+
+// A DecodeError reports a message that could not be decoded.
+type DecodeError struct {
+	Port string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("plumb: decoding message from %s: %v", e.Port, e.Err)
+}
+
+// Listen is shorthand for (&Listener{Port: port}).Listen(ctx).
+func Listen(ctx context.Context, port string) (<-chan *Message, error) {
+	return (&Listener{Port: port}).Listen(ctx)
+}
+
+// Listen opens the port and returns a channel on which it sends
+// the messages received. If the port is closed, as when the plumber
+// restarts, Listen reopens it, waiting as long as needed.
+// The channel is closed when ctx is done.
+// Listen returns an error only if the port cannot be opened at first.
+func (l *Listener) Listen(ctx context.Context) (<-chan *Message, error) {
+	open := l.open
+	if open == nil {
+		open = openPort
+	}
+	rc, err := open(l.Port)
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan *Message)
+	go l.run(ctx, open, rc, c)
+	return c, nil
+}
+
+func (l *Listener) run(ctx context.Context, open func(string) (io.ReadCloser, error), rc io.ReadCloser, c chan<- *Message) {
+	defer close(c)
+	retry := l.Retry
+	if retry <= 0 {
+		retry = time.Second
+	}
+	for {
+		err := l.receive(ctx, rc, c)
+		rc.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		l.report(err)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retry):
+			}
+			rc, err = open(l.Port)
+			if err == nil {
+				break
+			}
+			l.report(err)
+		}
+	}
+}
+
+func (l *Listener) report(err error) {
+	if l.Err != nil {
+		l.Err(err)
+	}
+}
+
+// portIounit is the most the plumber returns from one read of a port.
+const portIounit = 8192
+
+// receive sends the messages read from rc on c
+// until reading fails or ctx is done.
+func (l *Listener) receive(ctx context.Context, rc io.ReadCloser, c chan<- *Message) error {
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			rc.Close() // interrupts a blocked read
+		case <-finished:
+		}
+	}()
+
+	er := &errReader{r: rc}
+	br := bufio.NewReaderSize(er, portIounit)
+	for {
+		m := new(Message)
+		if err := m.Recv(br); err != nil {
+			if er.err != nil {
+				return er.err
+			}
+			l.report(&DecodeError{l.Port, err})
+			// Recv reads the whole of a message with bad attributes,
+			// leaving nothing buffered. If the header was too garbled
+			// for Recv to find the data count, skip what is buffered:
+			// the plumber returns at most one message per read.
+			br.Discard(br.Buffered())
+			continue
+		}
+		select {
+		case c <- m:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// An errReader records the error reading from r,
+// to tell errors reading from errors decoding what was read.
+type errReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *errReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// openPort opens the port on a new connection to the plumber,
+// so that it can be reopened if the plumber restarts.
+func openPort(port string) (io.ReadCloser, error) {
+	conn, err := client.DialService("plumb")
+	if err != nil {
+		return nil, err
+	}
+	fsys, err := conn.Attach(nil, os.Getenv("USER"), "")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	fid, err := fsys.Open(port, plan9.OREAD)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &portFile{fid, conn}, nil
+}
+
+// A portFile is a port open on its own connection.
+type portFile struct {
+	fid  *client.Fid
+	conn *client.Conn
+}
+
+func (f *portFile) Read(b []byte) (int, error) {
+	return f.fid.Read(b)
+}
+
+// Close closes the connection, interrupting any read in progress.
+func (f *portFile) Close() error {
+	return f.conn.Close()
+}
@@ -0,0 +1,148 @@
+package plumb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// testPorts serves pipes to a Listener in place of the plumber,
+// one per open of the port.
+type testPorts chan *io.PipeWriter
+
+func (p testPorts) open(port string) (io.ReadCloser, error) {
+	r, w := io.Pipe()
+	p <- w
+	return r, nil
+}
+
+func writeMessage(t *testing.T, w io.Writer, data string) {
+	var buf bytes.Buffer
+	m := &Message{Src: "test", Dst: "edit", Type: "text", Data: []byte(data)}
+	if err := m.Send(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receive(t *testing.T, c <-chan *Message) *Message {
+	select {
+	case m := <-c:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+	return nil
+}
+
+func TestListen(t *testing.T) {
+	ports := make(testPorts, 1)
+	errc := make(chan error, 10)
+	l := &Listener{
+		Port:  "edit",
+		Err:   func(err error) { errc <- err },
+		Retry: time.Millisecond,
+		open:  ports.open,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := l.Listen(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := <-ports
+	writeMessage(t, w, "one")
+	if m := receive(t, c); string(m.Data) != "one" || m.Dst != "edit" {
+		t.Errorf("received %+v, want one", m)
+	}
+
+	// A bad message is reported and skipped.
+	if _, err := w.Write([]byte("src\ndst\ndir\ntype\nnoequals\n0\n")); err != nil {
+		t.Fatal(err)
+	}
+	writeMessage(t, w, "two")
+	if m := receive(t, c); string(m.Data) != "two" {
+		t.Errorf("received %q, want two", m.Data)
+	}
+	if err, ok := (<-errc).(*DecodeError); !ok || err.Port != "edit" || err.Err != ErrAttribute {
+		t.Errorf("error = %v, want decode error", err)
+	}
+
+	// So is a bad message larger than the default bufio buffer.
+	var buf bytes.Buffer
+	m := &Message{Src: "test", Dst: "edit", Type: "text", Data: bytes.Repeat([]byte("x"), 6000)}
+	if err := m.Send(&buf); err != nil {
+		t.Fatal(err)
+	}
+	bad := bytes.Replace(buf.Bytes(), []byte("text\n\n"), []byte("text\nnoequals\n"), 1)
+	if _, err := w.Write(bad); err != nil {
+		t.Fatal(err)
+	}
+	writeMessage(t, w, "big")
+	if m := receive(t, c); string(m.Data) != "big" || m.Src != "test" {
+		t.Errorf("received %.40q from %.40q, want big from test", m.Data, m.Src)
+	}
+	if err, ok := (<-errc).(*DecodeError); !ok || err.Err != ErrAttribute {
+		t.Errorf("error = %v, want decode error", err)
+	}
+
+	// And one the plumber splits across several reads.
+	buf.Reset()
+	m = &Message{Src: "test", Dst: "edit", Type: "text", Data: bytes.Repeat([]byte("x\n"), 12000)}
+	if err := m.Send(&buf); err != nil {
+		t.Fatal(err)
+	}
+	bad = bytes.Replace(buf.Bytes(), []byte("text\n\n"), []byte("text\nnoequals\n"), 1)
+	for len(bad) > 0 {
+		n := portIounit
+		if n > len(bad) {
+			n = len(bad)
+		}
+		if _, err := w.Write(bad[:n]); err != nil {
+			t.Fatal(err)
+		}
+		bad = bad[n:]
+	}
+	writeMessage(t, w, "huge")
+	if m := receive(t, c); string(m.Data) != "huge" || m.Src != "test" {
+		t.Errorf("received %.40q from %.40q, want huge from test", m.Data, m.Src)
+	}
+	if err, ok := (<-errc).(*DecodeError); !ok || err.Err != ErrAttribute {
+		t.Errorf("error = %v, want decode error", err)
+	}
+	select {
+	case err := <-errc:
+		t.Errorf("extra error %v", err)
+	default:
+	}
+
+	// When the port is closed, it is reopened.
+	w.Close()
+	w = <-ports
+	if err := <-errc; err != io.EOF {
+		t.Errorf("error = %v, want EOF", err)
+	}
+	writeMessage(t, w, "three")
+	if m := receive(t, c); string(m.Data) != "three" {
+		t.Errorf("received %q, want three", m.Data)
+	}
+
+	// Canceling closes the channel.
+	cancel()
+	select {
+	case m, ok := <-c:
+		if ok {
+			t.Errorf("received %q after cancel", m.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+	if _, err := w.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Errorf("port not closed after cancel: %v", err)
+	}
+}
@@ -103,7 +103,9 @@ func quoteAttribute(s string) string {
 
 // Recv reads a message from the reader and stores it in the Message.
 // Since encoded messages are properly delimited, Recv will not read
-// any data beyond the message itself.
+// any data beyond the message itself. If the attributes are malformed,
+// Recv still reads the rest of the message before returning the error,
+// so that the next message can be read.
 func (m *Message) Recv(r io.ByteReader) error {
 	reader := newReader(r)
 	m.Src = reader.readLine()
@@ -120,14 +122,18 @@ func (m *Message) Recv(r io.ByteReader) error {
 	}
 	m.Data = make([]byte, n)
 	reader.read(m.Data)
+	if reader.err == nil {
+		return reader.attrErr
+	}
 	return reader.err
 }
 
 type reader struct {
-	r    io.ByteReader
-	buf  []byte
-	attr *Attribute
-	err  error
+	r       io.ByteReader
+	buf     []byte
+	attr    *Attribute
+	err     error
+	attrErr error // first malformed attribute
 }
 
 func newReader(r io.ByteReader) *reader {
@@ -208,15 +214,28 @@ Loop:
 func (r *reader) newAttr() {
 	equals := bytes.IndexByte(r.buf, '=')
 	if equals < 0 {
-		r.err = ErrAttribute
+		r.badAttr(ErrAttribute)
 		return
 	}
 	str := string(r.buf)
+	value, err := unquoteAttribute(str[equals+1:])
+	if err != nil {
+		r.badAttr(err)
+		return
+	}
 	r.attr = &Attribute{
-		Name: str[:equals],
-		Next: r.attr,
+		Name:  str[:equals],
+		Value: value,
+		Next:  r.attr,
+	}
+}
+
+// badAttr records err for a malformed attribute.
+// Reading continues to the end of the message.
+func (r *reader) badAttr(err error) {
+	if r.attrErr == nil {
+		r.attrErr = err
 	}
-	r.attr.Value, r.err = unquoteAttribute(str[equals+1:])
 }
 
 // unquoteAttribute unquotes the attribute value, if necessary, and returns the result.
@@ -95,3 +95,15 @@ func TestMultipleAttributes(t *testing.T) {
 		t.Fatalf("difference:\n%+v\n%+v", message, m)
 	}
 }
+
+func TestBadAttribute(t *testing.T) {
+	buf := bytes.NewBufferString("src\ndst\ndir\ntype\na=1 noequals b='x y'\n3\nabc")
+	buf.WriteString("src\ndst\ndir\ntype\n\n2\nok")
+	m := new(Message)
+	if err := m.Recv(buf); err != ErrAttribute {
+		t.Fatalf("recv: %v, want %v", err, ErrAttribute)
+	}
+	if err := m.Recv(buf); err != nil || string(m.Data) != "ok" {
+		t.Fatalf("recv after bad attribute: %q, %v", m.Data, err)
+	}
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"9fans.net/go/plan9"
+	"9fans.net/go/plumb"
+)
+
+// The file tree served is
+//
+//	/send
+//	/rules
+//	/<port>...
+//
+// Qid paths 0, 1 and 2 are the root, send and rules;
+// port i has path 3+i.
+const (
+	qidRoot = iota
+	qidSend
+	qidRules
+	qidPort
+)
+
+const (
+	msize      = 8192 + plan9.IOHDRSZ
+	maxMessage = 1 << 24 // largest message accepted by send
+)
+
+var (
+	errInterrupted = errors.New("interrupted")
+	errPerm        = errors.New("permission denied")
+	errNotFound    = errors.New("file not found")
+	errBadFid      = errors.New("unknown fid")
+	errInUse       = errors.New("fid in use")
+	errNotOpen     = errors.New("fid not open")
+	errIsOpen      = errors.New("fid already open")
+)
+
+// A conn serves the plumber's files on one connection.
+type conn struct {
+	p    *plumber
+	rwc  io.ReadWriteCloser
+	user string
+
+	wmu sync.Mutex // serializes replies
+
+	mu      sync.Mutex
+	fids    map[uint32]*fid
+	pending map[uint16]chan struct{} // cancel channels of blocked reads, by tag
+	done    map[uint16]chan struct{} // closed when the blocked read has replied
+}
+
+// A fid is a file in use by a client.
+type fid struct {
+	path   uint64
+	port   string
+	open   bool
+	mode   uint8
+	reader *portReader // open port
+	buf    []byte      // message partly written to send, or rules being written
+	dir    []byte      // directory contents, for reading the root
+}
+
+// serve serves 9P on rwc until it is closed.
+func (p *plumber) serve(rwc io.ReadWriteCloser) {
+	c := &conn{
+		p:       p,
+		rwc:     rwc,
+		user:    os.Getenv("USER"),
+		fids:    make(map[uint32]*fid),
+		pending: make(map[uint16]chan struct{}),
+		done:    make(map[uint16]chan struct{}),
+	}
+	defer c.hangup()
+	r := bufio.NewReader(rwc)
+	for {
+		tx, err := plan9.ReadFcall(r)
+		if err != nil {
+			return
+		}
+		c.handle(tx)
+	}
+}
+
+// hangup releases the connection's resources.
+func (c *conn) hangup() {
+	c.rwc.Close()
+	c.mu.Lock()
+	for _, cancel := range c.pending {
+		close(cancel)
+	}
+	c.pending = make(map[uint16]chan struct{})
+	fids := c.fids
+	c.fids = make(map[uint32]*fid)
+	c.mu.Unlock()
+	for _, f := range fids {
+		c.clunk(f)
+	}
+}
+
+func (c *conn) reply(tx, rx *plan9.Fcall) {
+	rx.Tag = tx.Tag
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	plan9.WriteFcall(c.rwc, rx)
+}
+
+func (c *conn) error(tx *plan9.Fcall, err error) {
+	c.reply(tx, &plan9.Fcall{Type: plan9.Rerror, Ename: err.Error()})
+}
+
+func (c *conn) lookup(id uint32) (*fid, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := c.fids[id]
+	if f == nil {
+		return nil, errBadFid
+	}
+	return f, nil
+}
+
+func (c *conn) handle(tx *plan9.Fcall) {
+	switch tx.Type {
+	default:
+		c.error(tx, errors.New("bad 9P message"))
+
+	case plan9.Tversion:
+		rx := &plan9.Fcall{Type: plan9.Rversion, Msize: tx.Msize, Version: "unknown"}
+		if rx.Msize > msize {
+			rx.Msize = msize
+		}
+		if len(tx.Version) >= 6 && tx.Version[:6] == plan9.VERSION9P {
+			rx.Version = plan9.VERSION9P
+		}
+		c.reply(tx, rx)
+
+	case plan9.Tauth:
+		c.error(tx, errors.New("plumber: authentication not required"))
+
+	case plan9.Tattach:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.fids[tx.Fid] != nil {
+			c.error(tx, errInUse)
+			return
+		}
+		c.fids[tx.Fid] = &fid{path: qidRoot}
+		c.reply(tx, &plan9.Fcall{Type: plan9.Rattach, Qid: c.qid(qidRoot)})
+
+	case plan9.Tflush:
+		c.mu.Lock()
+		cancel, done := c.pending[tx.Oldtag], c.done[tx.Oldtag]
+		if cancel != nil {
+			close(cancel)
+			delete(c.pending, tx.Oldtag)
+		}
+		c.mu.Unlock()
+		if done != nil {
+			<-done
+		}
+		c.reply(tx, &plan9.Fcall{Type: plan9.Rflush})
+
+	case plan9.Twalk:
+		c.walk(tx)
+
+	case plan9.Topen:
+		c.open(tx)
+
+	case plan9.Tread:
+		f, err := c.lookup(tx.Fid)
+		if err != nil {
+			c.error(tx, err)
+			return
+		}
+		if !f.open || f.mode&3 == plan9.OWRITE {
+			c.error(tx, errNotOpen)
+			return
+		}
+		if f.reader != nil {
+			c.readPort(tx, f)
+			return
+		}
+		c.read(tx, f)
+
+	case plan9.Twrite:
+		c.write(tx)
+
+	case plan9.Tclunk:
+		c.mu.Lock()
+		f := c.fids[tx.Fid]
+		delete(c.fids, tx.Fid)
+		c.mu.Unlock()
+		if f == nil {
+			c.error(tx, errBadFid)
+			return
+		}
+		if err := c.clunk(f); err != nil {
+			c.error(tx, err)
+			return
+		}
+		c.reply(tx, &plan9.Fcall{Type: plan9.Rclunk})
+
+	case plan9.Tstat:
+		f, err := c.lookup(tx.Fid)
+		if err != nil {
+			c.error(tx, err)
+			return
+		}
+		d := c.stat(f.path)
+		b, err := d.Bytes()
+		if err != nil {
+			c.error(tx, err)
+			return
+		}
+		c.reply(tx, &plan9.Fcall{Type: plan9.Rstat, Stat: b})
+
+	case plan9.Tcreate, plan9.Tremove, plan9.Twstat:
+		if tx.Type == plan9.Tremove {
+			c.mu.Lock()
+			f := c.fids[tx.Fid]
+			delete(c.fids, tx.Fid)
+			c.mu.Unlock()
+			if f != nil {
+				c.clunk(f)
+			}
+		}
+		c.error(tx, errPerm)
+	}
+}
+
+func (c *conn) qid(path uint64) plan9.Qid {
+	if path == qidRoot {
+		return plan9.Qid{Path: path, Type: plan9.QTDIR}
+	}
+	return plan9.Qid{Path: path}
+}
+
+// portPath returns the qid path of the named port, or 0 if there is none.
+func (c *conn) portPath(name string) uint64 {
+	for i, n := range c.p.portNames() {
+		if n == name {
+			return qidPort + uint64(i)
+		}
+	}
+	return 0
+}
+
+// name returns the name of the file with the given qid path.
+func (c *conn) name(path uint64) string {
+	switch path {
+	case qidRoot:
+		return "/"
+	case qidSend:
+		return "send"
+	case qidRules:
+		return "rules"
+	}
+	names := c.p.portNames()
+	if i := int(path - qidPort); i < len(names) {
+		return names[i]
+	}
+	return ""
+}
+
+func (c *conn) stat(path uint64) *plan9.Dir {
+	d := &plan9.Dir{
+		Qid:  c.qid(path),
+		Name: c.name(path),
+		Uid:  c.user,
+		Gid:  c.user,
+		Muid: c.user,
+	}
+	switch path {
+	case qidRoot:
+		d.Mode = plan9.DMDIR | 0555
+	case qidSend:
+		d.Mode = 0222
+	case qidRules:
+		d.Mode = 0666
+		c.p.mu.Lock()
+		d.Length = uint64(len(c.p.text))
+		c.p.mu.Unlock()
+	default:
+		d.Mode = 0444
+	}
+	return d
+}
+
+func (c *conn) walk(tx *plan9.Fcall) {
+	f, err := c.lookup(tx.Fid)
+	if err != nil {
+		c.error(tx, err)
+		return
+	}
+	if f.open {
+		c.error(tx, errIsOpen)
+		return
+	}
+	path := f.path
+	var qids []plan9.Qid
+	for _, name := range tx.Wname {
+		if path != qidRoot {
+			break
+		}
+		next := uint64(qidRoot)
+		switch name {
+		case "..":
+		case "send":
+			next = qidSend
+		case "rules":
+			next = qidRules
+		default:
+			next = c.portPath(name)
+		}
+		if next == qidRoot && name != ".." {
+			break
+		}
+		path = next
+		qids = append(qids, c.qid(path))
+	}
+	if len(tx.Wname) > 0 && len(qids) == 0 {
+		c.error(tx, errNotFound)
+		return
+	}
+	if len(qids) == len(tx.Wname) {
+		nf := &fid{path: path}
+		if path >= qidPort {
+			nf.port = c.name(path)
+		}
+		c.mu.Lock()
+		if tx.Newfid != tx.Fid && c.fids[tx.Newfid] != nil {
+			c.mu.Unlock()
+			c.error(tx, errInUse)
+			return
+		}
+		c.fids[tx.Newfid] = nf
+		c.mu.Unlock()
+	}
+	c.reply(tx, &plan9.Fcall{Type: plan9.Rwalk, Wqid: qids})
+}
+
+func (c *conn) open(tx *plan9.Fcall) {
+	f, err := c.lookup(tx.Fid)
+	if err != nil {
+		c.error(tx, err)
+		return
+	}
+	if f.open {
+		c.error(tx, errIsOpen)
+		return
+	}
+	mode := tx.Mode &^ (plan9.OTRUNC | plan9.OCEXEC)
+	write := mode&3 == plan9.OWRITE || mode&3 == plan9.ORDWR
+	read := mode&3 == plan9.OREAD || mode&3 == plan9.ORDWR
+	switch {
+	case mode&3 == plan9.OEXEC || mode&plan9.ORCLOSE != 0,
+		f.path == qidRoot && write,
+		f.path == qidSend && read,
+		f.path >= qidPort && write:
+		c.error(tx, errPerm)
+		return
+	}
+	switch {
+	case f.path == qidRoot:
+		var buf bytes.Buffer
+		paths := []uint64{qidSend, qidRules}
+		for i := range c.p.portNames() {
+			paths = append(paths, qidPort+uint64(i))
+		}
+		for _, path := range paths {
+			b, err := c.stat(path).Bytes()
+			if err != nil {
+				c.error(tx, err)
+				return
+			}
+			buf.Write(b)
+		}
+		f.dir = buf.Bytes()
+	case f.path == qidRules && write:
+		if tx.Mode&plan9.OTRUNC == 0 {
+			c.p.mu.Lock()
+			f.buf = append([]byte(nil), c.p.text...)
+			c.p.mu.Unlock()
+		}
+	case f.path >= qidPort:
+		f.reader, err = c.p.open(f.port)
+		if err != nil {
+			c.error(tx, err)
+			return
+		}
+	}
+	f.open = true
+	f.mode = mode
+	c.reply(tx, &plan9.Fcall{Type: plan9.Ropen, Qid: c.qid(f.path), Iounit: msize - plan9.IOHDRSZ})
+}
+
+func (c *conn) read(tx *plan9.Fcall, f *fid) {
+	var data []byte
+	switch f.path {
+	case qidRoot:
+		// Return only whole directory entries.
+		data = entries(f.dir, tx.Offset, tx.Count)
+	case qidRules:
+		c.p.mu.Lock()
+		data = slice(c.p.text, tx.Offset, tx.Count)
+		c.p.mu.Unlock()
+	}
+	c.reply(tx, &plan9.Fcall{Type: plan9.Rread, Data: data})
+}
+
+// readPort reads a message from a port,
+// waiting in the background for one to arrive.
+func (c *conn) readPort(tx *plan9.Fcall, f *fid) {
+	cancel, done := make(chan struct{}), make(chan struct{})
+	c.mu.Lock()
+	c.pending[tx.Tag] = cancel
+	c.done[tx.Tag] = done
+	c.mu.Unlock()
+	go func() {
+		defer close(done)
+		count := tx.Count
+		if count > msize-plan9.IOHDRSZ {
+			count = msize - plan9.IOHDRSZ
+		}
+		b := make([]byte, count)
+		n, err := c.p.read(f.reader, b, cancel)
+		c.mu.Lock()
+		if c.done[tx.Tag] == done {
+			delete(c.pending, tx.Tag)
+			delete(c.done, tx.Tag)
+		}
+		c.mu.Unlock()
+		if err == errInterrupted {
+			// Flushed: Rflush is the reply.
+			return
+		}
+		c.reply(tx, &plan9.Fcall{Type: plan9.Rread, Data: b[:n]})
+	}()
+}
+
+func (c *conn) write(tx *plan9.Fcall) {
+	f, err := c.lookup(tx.Fid)
+	if err != nil {
+		c.error(tx, err)
+		return
+	}
+	if !f.open || f.mode&3 == plan9.OREAD {
+		c.error(tx, errNotOpen)
+		return
+	}
+	rx := &plan9.Fcall{Type: plan9.Rwrite, Count: uint32(len(tx.Data))}
+	switch f.path {
+	case qidSend:
+		// A message may take several writes.
+		f.buf = append(f.buf, tx.Data...)
+		m := new(plumb.Message)
+		err := m.Recv(bytes.NewReader(f.buf))
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if len(f.buf) > maxMessage {
+				f.buf = nil
+				c.error(tx, errors.New("message too large"))
+				return
+			}
+			c.reply(tx, rx)
+			return
+		}
+		f.buf = nil
+		if err == nil {
+			err = c.p.send(m)
+		}
+		if err != nil {
+			c.error(tx, err)
+			return
+		}
+	case qidRules:
+		end := tx.Offset + uint64(len(tx.Data))
+		if end > maxMessage {
+			c.error(tx, errors.New("rules too large"))
+			return
+		}
+		for uint64(len(f.buf)) < end {
+			f.buf = append(f.buf, 0)
+		}
+		copy(f.buf[tx.Offset:], tx.Data)
+	}
+	c.reply(tx, rx)
+}
+
+// clunk releases f. Closing the rules file after writing it
+// installs the rules written, or returns the error parsing them.
+func (c *conn) clunk(f *fid) error {
+	if f.reader != nil {
+		c.p.close(f.port, f.reader)
+		f.reader = nil
+	}
+	if f.open && f.path == qidRules && f.mode&3 != plan9.OREAD {
+		return c.p.setRules("rules", f.buf)
+	}
+	return nil
+}
+
+// slice returns the part of b at offset, at most count bytes long.
+func slice(b []byte, offset uint64, count uint32) []byte {
+	if offset >= uint64(len(b)) {
+		return nil
+	}
+	b = b[offset:]
+	if uint64(len(b)) > uint64(count) {
+		b = b[:count]
+	}
+	return b
+}
+
+// entries returns the directory entries in dir at offset
+// that fit in count bytes.
+func entries(dir []byte, offset uint64, count uint32) []byte {
+	b := slice(dir, offset, count)
+	n := 0
+	for n+2 <= len(b) {
+		size := 2 + (int(b[n]) | int(b[n+1])<<8)
+		if n+size > len(b) {
+			break
+		}
+		n += size
+	}
+	return b[:n]
+}
@@ -0,0 +1,104 @@
+// Plumber is a plumber, as in plumber(4): it routes plumb messages
+// between programs according to a set of rules.
+//
+// Usage:
+//
+//	plumber [-p plumbing] [-s service]
+//
+// Plumber reads its rules, described in plumb(7), from the file given by -p,
+// by default $HOME/lib/plumbing, or if that does not exist,
+// $PLAN9/plumb/initial.plumbing. It reloads the file when it changes.
+//
+// Plumber serves its files over 9P on the Unix socket named by -s,
+// by default plumb, in the name space directory. The files are:
+//
+//	send   messages written here are routed by the rules
+//	rules  the text of the rules; writing it replaces them until the file changes
+//	port   one file for each port the rules send to
+//
+// Each open port file receives a copy of each message sent to the port,
+// returned by reads, which wait for a message to arrive.
+// If no one has the port open and the matching rule set has a plumb start
+// action, the command is run instead. If it has a plumb client action,
+// the command is run and the message is held until the command opens the port.
+package main // import "9fans.net/go/plumb/plumber"
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"9fans.net/go/plan9/client"
+)
+
+var (
+	rulesFile = flag.String("p", "", "read rules from `file`")
+	service   = flag.String("s", "plumb", "serve the files on the `service` socket")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: plumber [-p plumbing] [-s service]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("plumber: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 0 {
+		usage()
+	}
+
+	p := newPlumber()
+	file := *rulesFile
+	if file == "" {
+		file = defaultRules()
+	}
+	if err := p.loadRules(file); err != nil {
+		log.Fatal(err)
+	}
+	go p.watchRules(time.Second)
+
+	ns := client.Namespace()
+	if err := os.MkdirAll(ns, 0700); err != nil {
+		log.Fatal(err)
+	}
+	socket := filepath.Join(ns, *service)
+	if c, err := net.Dial("unix", socket); err == nil {
+		c.Close()
+		log.Fatalf("already running on %s", socket)
+	}
+	os.Remove(socket)
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(socket)
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		go p.serve(c)
+	}
+}
+
+// defaultRules returns the name of the default rules file.
+func defaultRules() string {
+	file := filepath.Join(os.Getenv("HOME"), "lib/plumbing")
+	if _, err := os.Stat(file); err == nil {
+		return file
+	}
+	root := os.Getenv("PLAN9")
+	if root == "" {
+		root = "/usr/local/plan9"
+	}
+	return filepath.Join(root, "plumb/initial.plumbing")
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"9fans.net/go/plumb"
+	"9fans.net/go/plumb/rules"
+)
+
+// A plumber routes messages to ports according to the rules.
+type plumber struct {
+	mu        sync.Mutex
+	rules     *rules.Rules
+	text      []byte // text of the rules
+	file      string // rules file on disk, if any
+	mtime     time.Time
+	ports     []*port
+	start     func(argv []string, m *plumb.Message) error // runs start and client commands
+	holdLimit time.Duration                               // how long a message waits for a client to open its port
+}
+
+// A port is a file from which messages are read.
+type port struct {
+	name    string
+	readers map[*portReader]bool
+	held    []heldMessage // messages waiting for a client to open the port
+}
+
+type heldMessage struct {
+	data []byte
+	time time.Time
+}
+
+// A portReader is an open port file, with the messages it has yet to read.
+type portReader struct {
+	queue   [][]byte
+	partial []byte        // rest of a message partly read
+	wake    chan struct{} // signaled when a message is queued
+}
+
+func newPlumber() *plumber {
+	p := &plumber{
+		rules:     &rules.Rules{},
+		start:     startCommand,
+		holdLimit: 10 * time.Second,
+	}
+	return p
+}
+
+// setRules replaces the rules with those parsed from text,
+// adding a port for each port the rules name.
+func (p *plumber) setRules(name string, text []byte) error {
+	r, err := rules.Parse(name, bytes.NewReader(text))
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = r
+	p.text = text
+	for _, set := range r.Sets {
+		for _, rule := range set.Rules {
+			if rule.Object == "plumb" && rule.Verb == "to" && rule.Arg != "" && !strings.ContainsAny(rule.Arg, "$' \t") {
+				p.lookupPort(rule.Arg, true)
+			}
+		}
+	}
+	return nil
+}
+
+// loadRules reads the rules from the named file.
+func (p *plumber) loadRules(file string) error {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	text, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := p.setRules(file, text); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.file, p.mtime = file, fi.ModTime()
+	p.mu.Unlock()
+	return nil
+}
+
+// watchRules reloads the rules file whenever it changes.
+func (p *plumber) watchRules(interval time.Duration) {
+	for range time.Tick(interval) {
+		p.mu.Lock()
+		file, mtime := p.file, p.mtime
+		p.mu.Unlock()
+		if file == "" {
+			continue
+		}
+		fi, err := os.Stat(file)
+		if err != nil || fi.ModTime().Equal(mtime) {
+			continue
+		}
+		if err := p.loadRules(file); err != nil {
+			log.Print(err)
+			// Don't report the same error again.
+			p.mu.Lock()
+			p.mtime = fi.ModTime()
+			p.mu.Unlock()
+			continue
+		}
+		log.Printf("reloaded %s", file)
+	}
+}
+
+// lookupPort returns the named port, creating it if create is set.
+// p.mu must be held.
+func (p *plumber) lookupPort(name string, create bool) *port {
+	for _, pt := range p.ports {
+		if pt.name == name {
+			return pt
+		}
+	}
+	if !create {
+		return nil
+	}
+	pt := &port{name: name, readers: make(map[*portReader]bool)}
+	p.ports = append(p.ports, pt)
+	return pt
+}
+
+// portNames returns the names of the ports.
+func (p *plumber) portNames() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var names []string
+	for _, pt := range p.ports {
+		names = append(names, pt.name)
+	}
+	return names
+}
+
+// send routes the message m, as plumber(4) does:
+// it delivers the message to everyone reading the matching rule set's port;
+// if no one is, it runs the rule set's start command, if any,
+// or else runs its client command and holds the message for the port.
+func (p *plumber) send(m *plumb.Message) error {
+	p.mu.Lock()
+	res := p.rules.Match(m)
+	p.mu.Unlock()
+	if res == nil {
+		if m.Dst == "" {
+			return fmt.Errorf("no matching plumb rule")
+		}
+		res = &rules.Result{Message: m, Port: m.Dst}
+	}
+	if res.Port != "" {
+		var buf bytes.Buffer
+		if err := res.Message.Send(&buf); err != nil {
+			return err
+		}
+		p.mu.Lock()
+		pt := p.lookupPort(res.Port, false)
+		if pt != nil && len(pt.readers) > 0 {
+			for r := range pt.readers {
+				r.push(buf.Bytes())
+			}
+			p.mu.Unlock()
+			return nil
+		}
+		if res.Start == nil && res.Client != nil {
+			pt = p.lookupPort(res.Port, true)
+			pt.held = append(pt.held, heldMessage{buf.Bytes(), time.Now()})
+			p.mu.Unlock()
+			return p.start(res.Client, res.Message)
+		}
+		p.mu.Unlock()
+	}
+	if res.Start != nil {
+		return p.start(res.Start, res.Message)
+	}
+	if res.Port == "" {
+		return fmt.Errorf("no port for message")
+	}
+	return fmt.Errorf("no one is reading port %s", res.Port)
+}
+
+// open opens the named port for reading, delivering any messages
+// held for it while its client started.
+func (p *plumber) open(name string) (*portReader, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pt := p.lookupPort(name, false)
+	if pt == nil {
+		return nil, fmt.Errorf("no port %s", name)
+	}
+	r := &portReader{wake: make(chan struct{}, 1)}
+	pt.readers[r] = true
+	for _, h := range pt.held {
+		if time.Since(h.time) < p.holdLimit {
+			r.push(h.data)
+		}
+	}
+	pt.held = nil
+	return r, nil
+}
+
+// close closes the port reader r.
+func (p *plumber) close(name string, r *portReader) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pt := p.lookupPort(name, false); pt != nil {
+		delete(pt.readers, r)
+	}
+}
+
+// push queues a message for r. p.mu must be held.
+func (r *portReader) push(data []byte) {
+	r.queue = append(r.queue, data)
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// read reads the next message, or the rest of one partly read,
+// into b, waiting for one to arrive unless cancel is closed first.
+func (p *plumber) read(r *portReader, b []byte, cancel <-chan struct{}) (int, error) {
+	for {
+		p.mu.Lock()
+		if len(r.partial) == 0 && len(r.queue) > 0 {
+			r.partial, r.queue = r.queue[0], r.queue[1:]
+		}
+		if len(r.partial) > 0 {
+			n := copy(b, r.partial)
+			r.partial = r.partial[n:]
+			p.mu.Unlock()
+			return n, nil
+		}
+		p.mu.Unlock()
+		select {
+		case <-r.wake:
+		case <-cancel:
+			return 0, errInterrupted
+		}
+	}
+}
+
+// startCommand runs argv in the background.
+func startCommand(argv []string, m *plumb.Message) error {
+	if len(argv) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	if fi, err := os.Stat(m.Dir); err == nil && fi.IsDir() {
+		cmd.Dir = m.Dir
+	}
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
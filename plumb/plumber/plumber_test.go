@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"9fans.net/go/plan9"
+	"9fans.net/go/plan9/client"
+	"9fans.net/go/plumb"
+)
+
+const testRules = `
+type is text
+data matches 'http://.*'
+plumb to web
+plumb start browser $0
+
+type is text
+data matches '[a-z]+\.go'
+plumb to edit
+plumb client editor $0
+
+type is text
+data matches '[a-z]+'
+plumb to words
+`
+
+type startCall struct {
+	argv []string
+	data string
+}
+
+func testPlumber(t *testing.T) (*plumber, *client.Fsys, chan startCall) {
+	p := newPlumber()
+	if err := p.setRules("test", []byte(testRules)); err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan startCall, 10)
+	p.start = func(argv []string, m *plumb.Message) error {
+		started <- startCall{argv, string(m.Data)}
+		return nil
+	}
+	c1, c2 := net.Pipe()
+	go p.serve(c1)
+	conn, err := client.NewConn(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := conn.Attach(nil, "user", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, fsys, started
+}
+
+func send(fsys *client.Fsys, data string) error {
+	fid, err := fsys.Open("send", plan9.OWRITE)
+	if err != nil {
+		return err
+	}
+	defer fid.Close()
+	m := &plumb.Message{Src: "test", Type: "text", Data: []byte(data)}
+	return m.Send(fid)
+}
+
+func recv(t *testing.T, r *bufio.Reader) *plumb.Message {
+	ch := make(chan *plumb.Message, 1)
+	go func() {
+		m := new(plumb.Message)
+		if err := m.Recv(r); err != nil {
+			t.Error(err)
+		}
+		ch <- m
+	}()
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+	return nil
+}
+
+func TestFiles(t *testing.T) {
+	_, fsys, _ := testPlumber(t)
+	root, err := fsys.Open("/", plan9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirs, err := root.Dirreadall()
+	root.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, d := range dirs {
+		names = append(names, d.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"edit", "rules", "send", "web", "words"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("files = %q, want %q", names, want)
+	}
+
+	fid, err := fsys.Open("rules", plan9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(fid)
+	fid.Close()
+	if err != nil || string(b) != testRules {
+		t.Errorf("read rules = %q, %v", b, err)
+	}
+	if _, err := fsys.Open("nonexistent", plan9.OREAD); err == nil {
+		t.Errorf("opened nonexistent file")
+	}
+	if _, err := fsys.Open("edit", plan9.OWRITE); err == nil {
+		t.Errorf("opened port for writing")
+	}
+}
+
+func TestSend(t *testing.T) {
+	_, fsys, started := testPlumber(t)
+	words1, err := fsys.Open("words", plan9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer words1.Close()
+	words2, err := fsys.Open("words", plan9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer words2.Close()
+	r1, r2 := bufio.NewReaderSize(words1, 16), bufio.NewReaderSize(words2, 16)
+
+	if err := send(fsys, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := send(fsys, "world"); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*bufio.Reader{r1, r2} {
+		for _, want := range []string{"hello", "world"} {
+			if m := recv(t, r); string(m.Data) != want || m.Dst != "words" || m.Src != "test" {
+				t.Errorf("received %+v, want %q to words", m, want)
+			}
+		}
+	}
+
+	if err := send(fsys, "http://9fans.net"); err != nil {
+		t.Fatal(err)
+	}
+	if s := <-started; !reflect.DeepEqual(s.argv, []string{"browser", "http://9fans.net"}) {
+		t.Errorf("started %q", s.argv)
+	}
+
+	if err := send(fsys, "NO MATCH"); err == nil || !strings.Contains(err.Error(), "no matching plumb rule") {
+		t.Errorf("send with no matching rule: %v", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	_, fsys, started := testPlumber(t)
+	if err := send(fsys, "x.go"); err != nil {
+		t.Fatal(err)
+	}
+	if s := <-started; !reflect.DeepEqual(s.argv, []string{"editor", "x.go"}) {
+		t.Errorf("started %q", s.argv)
+	}
+	fid, err := fsys.Open("edit", plan9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fid.Close()
+	r := bufio.NewReader(fid)
+	if m := recv(t, r); string(m.Data) != "x.go" {
+		t.Errorf("received %q, want held message x.go", m.Data)
+	}
+
+	// With the port open, messages go straight to it.
+	if err := send(fsys, "y.go"); err != nil {
+		t.Fatal(err)
+	}
+	if m := recv(t, r); string(m.Data) != "y.go" {
+		t.Errorf("received %q, want y.go", m.Data)
+	}
+	select {
+	case s := <-started:
+		t.Errorf("started %q with port open", s.argv)
+	default:
+	}
+}
+
+func TestStartWithReader(t *testing.T) {
+	_, fsys, started := testPlumber(t)
+	fid, err := fsys.Open("web", plan9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fid.Close()
+
+	// With the port open, the message goes to it instead of starting the browser.
+	if err := send(fsys, "http://9fans.net"); err != nil {
+		t.Fatal(err)
+	}
+	if m := recv(t, bufio.NewReader(fid)); string(m.Data) != "http://9fans.net" || m.Dst != "web" {
+		t.Errorf("received %+v, want http://9fans.net to web", m)
+	}
+	select {
+	case s := <-started:
+		t.Errorf("started %q with port open", s.argv)
+	default:
+	}
+}
+
+func TestWriteRules(t *testing.T) {
+	p, fsys, _ := testPlumber(t)
+	fid, err := fsys.Open("rules", plan9.OWRITE|plan9.OTRUNC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fid.Write([]byte("type is text\nplumb to all\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fid.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if m := p.rules.Match(&plumb.Message{Type: "text"}); m == nil || m.Port != "all" {
+		t.Errorf("new rules not installed")
+	}
+	if _, err := fsys.Open("all", plan9.OREAD); err != nil {
+		t.Errorf("opening new port: %v", err)
+	}
+
+	fid, err = fsys.Open("rules", plan9.OWRITE|plan9.OTRUNC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fid.Write([]byte("type frob text\n"))
+	if err := fid.Close(); err == nil {
+		t.Errorf("installed bad rules")
+	}
+}
+
+func TestNoReader(t *testing.T) {
+	_, fsys, _ := testPlumber(t)
+	if err := send(fsys, "hello"); err == nil || !strings.Contains(err.Error(), "no one is reading port words") {
+		t.Errorf("send to unread port: %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	f, err := ioutil.TempFile("", "plumbing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("type is text\nplumb to one\n")
+	f.Close()
+
+	p := newPlumber()
+	if err := p.loadRules(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	go p.watchRules(10 * time.Millisecond)
+	if err := ioutil.WriteFile(f.Name(), []byte("type is text\nplumb to two\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(f.Name(), later, later)
+	for i := 0; ; i++ {
+		p.mu.Lock()
+		res := p.rules.Match(&plumb.Message{Type: "text"})
+		p.mu.Unlock()
+		if res.Port == "two" {
+			break
+		}
+		if i >= 500 {
+			t.Fatalf("rules not reloaded: port %s", res.Port)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,381 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"9fans.net/go/plumb"
+)
+
+// A Result is the outcome of evaluating a message against the rules.
+type Result struct {
+	Message *plumb.Message // the message, as rewritten by the rule set
+	Port    string         // the port to which to send it, from plumb to
+	Start   []string       // command to run, from plumb start
+	Client  []string       // command to run if no one has the port open, from plumb client
+	Set     *Ruleset       // the rule set that matched
+}
+
+// Match evaluates m against the rule sets in order and returns the
+// result of the first one whose patterns all match, or nil if none does.
+// If m has a destination, only rule sets that send to that port,
+// or that name no port, are considered.
+// The message m is not modified.
+func (r *Rules) Match(m *plumb.Message) *Result {
+	for _, set := range r.Sets {
+		if res := set.Match(m); res != nil {
+			return res
+		}
+	}
+	return nil
+}
+
+// Match evaluates m against the rule set, returning the result,
+// or nil if the set does not match m.
+// The message m is not modified.
+func (set *Ruleset) Match(m *plumb.Message) *Result {
+	if m.Dst != "" {
+		for _, rule := range set.Rules {
+			if rule.Verb == "to" {
+				if port, ok := rule.words[0].literal(); ok && port != m.Dst {
+					return nil
+				}
+			}
+		}
+	}
+
+	s := &state{m: copyMessage(m)}
+	res := &Result{Message: s.m, Set: set}
+	for _, rule := range set.Rules {
+		switch rule.Verb {
+		case "to":
+			res.Port = s.expand(rule.words[0])
+		case "start":
+			res.Start = s.expandAll(rule.words)
+		case "client":
+			res.Client = s.expandAll(rule.words)
+		default:
+			if !s.apply(rule) {
+				return nil
+			}
+		}
+	}
+	if m.Dst != "" {
+		if res.Port != "" && res.Port != m.Dst {
+			return nil
+		}
+		res.Port = m.Dst
+	}
+	s.m.Dst = res.Port
+	return res
+}
+
+// state is the state of the evaluation of a rule set.
+type state struct {
+	m     *plumb.Message
+	match [10]string
+	file  string
+	dir   string
+}
+
+func (s *state) lookup(name string) string {
+	if len(name) == 1 && '0' <= name[0] && name[0] <= '9' {
+		return s.match[name[0]-'0']
+	}
+	switch name {
+	case "file":
+		return s.file
+	case "dir":
+		return s.dir
+	case "src":
+		return s.m.Src
+	case "dst":
+		return s.m.Dst
+	case "wdir":
+		return s.m.Dir
+	case "type":
+		return s.m.Type
+	case "data":
+		return string(s.m.Data)
+	case "attr":
+		return formatAttr(s.m.Attr)
+	}
+	return ""
+}
+
+func (s *state) expand(t text) string {
+	return t.expand(s.lookup)
+}
+
+func (s *state) expandAll(words []text) []string {
+	var out []string
+	for _, w := range words {
+		out = append(out, s.expand(w))
+	}
+	return out
+}
+
+// apply applies a pattern or rewriting rule to the message,
+// reporting whether it matched.
+func (s *state) apply(rule *Rule) bool {
+	arg := s.expand(rule.words[0])
+	switch rule.Verb {
+	case "is":
+		return s.lookup(rule.Object) == arg
+
+	case "matches":
+		re := rule.re
+		if re == nil {
+			var err error
+			if re, err = compile(arg); err != nil {
+				return false
+			}
+		}
+		return s.matches(rule.Object, re)
+
+	case "isfile", "isdir":
+		name := arg
+		if rule.Object == "data" {
+			name = string(s.m.Data)
+		}
+		if name == "" {
+			return false
+		}
+		if !filepath.IsAbs(name) && s.m.Dir != "" {
+			name = filepath.Join(s.m.Dir, name)
+		}
+		fi, err := os.Stat(name)
+		if err != nil || fi.IsDir() != (rule.Verb == "isdir") {
+			return false
+		}
+		if rule.Verb == "isdir" {
+			s.dir = name
+		} else {
+			s.file = name
+		}
+		return true
+
+	case "set":
+		switch rule.Object {
+		case "src":
+			s.m.Src = arg
+		case "dst":
+			s.m.Dst = arg
+		case "wdir":
+			s.m.Dir = arg
+		case "type":
+			s.m.Type = arg
+		case "data":
+			s.m.Data = []byte(arg)
+		case "attr":
+			attr, err := parseAttr(arg)
+			if err != nil {
+				return false
+			}
+			s.m.Attr = attr
+		}
+		return true
+
+	case "add":
+		attr, err := parseAttr(arg)
+		if err != nil {
+			return false
+		}
+		for a := attr; a != nil; a = a.Next {
+			s.m.Attr = setAttr(s.m.Attr, a.Name, a.Value)
+		}
+		return true
+
+	case "delete":
+		s.m.Attr = deleteAttr(s.m.Attr, arg)
+		return true
+	}
+	return false
+}
+
+// matches reports whether the whole text of the object matches re,
+// setting $0 to $9 to the match and its subexpressions.
+// If the data has a click attribute, giving the rune offset of a click
+// in the data, the match need only contain the click; the data is then
+// replaced by the text matched and the click attribute deleted.
+func (s *state) matches(object string, re *regexp.Regexp) bool {
+	str := s.lookup(object)
+	var loc []int
+	click := -1
+	if object == "data" {
+		if a := findAttr(s.m.Attr, "click"); a != nil {
+			if n, err := strconv.Atoi(a.Value); err == nil && n >= 0 {
+				click = n
+			}
+		}
+	}
+	if click < 0 {
+		loc = re.FindStringSubmatchIndex(str)
+		if loc == nil || loc[0] != 0 || loc[1] != len(str) {
+			return false
+		}
+	} else {
+		loc = clickMatch(re, str, click)
+		if loc == nil {
+			return false
+		}
+	}
+	s.match = [10]string{}
+	for i := 0; i < len(s.match) && 2*i < len(loc); i++ {
+		if loc[2*i] >= 0 {
+			s.match[i] = str[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	if click >= 0 {
+		s.m.Data = []byte(s.match[0])
+		s.m.Attr = deleteAttr(s.m.Attr, "click")
+	}
+	return true
+}
+
+// clickMatch returns the submatch indexes of the first match of re in str
+// that contains the rune offset click, trying each starting point in turn,
+// as plumber does.
+func clickMatch(re *regexp.Regexp, str string, click int) []int {
+	clickp := 0
+	for i := 0; i < click && clickp < len(str); i++ {
+		_, size := utf8.DecodeRuneInString(str[clickp:])
+		clickp += size
+	}
+	for i := 0; i <= clickp; {
+		loc := re.FindStringSubmatchIndex(str[i:])
+		if loc == nil {
+			return nil
+		}
+		if i+loc[0] <= clickp && clickp <= i+loc[1] {
+			for j := range loc {
+				if loc[j] >= 0 {
+					loc[j] += i
+				}
+			}
+			return loc
+		}
+		if i == len(str) {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(str[i:])
+		i += size
+	}
+	return nil
+}
+
+func copyMessage(m *plumb.Message) *plumb.Message {
+	c := *m
+	c.Attr = nil
+	tail := &c.Attr
+	for a := m.Attr; a != nil; a = a.Next {
+		*tail = &plumb.Attribute{Name: a.Name, Value: a.Value}
+		tail = &(*tail).Next
+	}
+	c.Data = append([]byte(nil), m.Data...)
+	return &c
+}
+
+func findAttr(attr *plumb.Attribute, name string) *plumb.Attribute {
+	for a := attr; a != nil; a = a.Next {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// setAttr sets the named attribute, adding it to the end of the list if needed.
+func setAttr(attr *plumb.Attribute, name, value string) *plumb.Attribute {
+	if a := findAttr(attr, name); a != nil {
+		a.Value = value
+		return attr
+	}
+	p := &attr
+	for *p != nil {
+		p = &(*p).Next
+	}
+	*p = &plumb.Attribute{Name: name, Value: value}
+	return attr
+}
+
+func deleteAttr(attr *plumb.Attribute, name string) *plumb.Attribute {
+	for p := &attr; *p != nil; {
+		if (*p).Name == name {
+			*p = (*p).Next
+		} else {
+			p = &(*p).Next
+		}
+	}
+	return attr
+}
+
+// formatAttr formats attributes as in a plumb message.
+func formatAttr(attr *plumb.Attribute) string {
+	var b strings.Builder
+	for a := attr; a != nil; a = a.Next {
+		if a != attr {
+			b.WriteByte(' ')
+		}
+		b.WriteString(a.Name)
+		b.WriteByte('=')
+		if strings.ContainsAny(a.Value, " '=\t") {
+			b.WriteString("'" + strings.Replace(a.Value, "'", "''", -1) + "'")
+		} else {
+			b.WriteString(a.Value)
+		}
+	}
+	return b.String()
+}
+
+// parseAttr parses attributes in the form written by formatAttr.
+func parseAttr(s string) (*plumb.Attribute, error) {
+	var attr *plumb.Attribute
+	tail := &attr
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return attr, nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, plumb.ErrAttribute
+		}
+		name := s[:eq]
+		s = s[eq+1:]
+		var value strings.Builder
+		if strings.HasPrefix(s, "'") {
+			i := 1
+			for {
+				if i >= len(s) {
+					return nil, plumb.ErrQuote
+				}
+				if s[i] == '\'' {
+					if i+1 < len(s) && s[i+1] == '\'' {
+						value.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				value.WriteByte(s[i])
+				i++
+			}
+			s = s[i:]
+		} else {
+			i := strings.IndexAny(s, " \t")
+			if i < 0 {
+				i = len(s)
+			}
+			value.WriteString(s[:i])
+			s = s[i:]
+		}
+		*tail = &plumb.Attribute{Name: name, Value: value.String()}
+		tail = &(*tail).Next
+	}
+}
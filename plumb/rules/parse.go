@@ -0,0 +1,422 @@
+// Package rules parses plumbing rules, as described in plumb(7),
+// and evaluates plumb messages against them.
+//
+// A rules file is a sequence of rule sets separated by blank lines.
+// Each rule is a line of the form
+//
+//	object verb argument
+//
+// The objects are src, dst, wdir, type, data, attr, arg and plumb.
+// The pattern verbs are is, matches, isfile and isdir; the action verbs
+// are set, add and delete, which rewrite the message, and to, start and
+// client, which apply to the plumb object and say where the message goes.
+// Outside rule sets, a line of the form name=value defines a variable
+// whose value is the rest of the line, blanks included; the = may have
+// blanks around it. A line of the form include file reads rules
+// from another file.
+//
+// Arguments are split into words at spaces and tabs. Text in single
+// quotes is taken literally, with a doubled quote standing for one quote.
+// Outside quotes, $name is replaced by the value of a variable, or of the
+// environment variable of that name if no variable is defined. The names
+// $0 to $9, $file, $dir, $src, $dst, $wdir, $type, $data and $attr are
+// replaced when a message is evaluated instead: by the text matched by the
+// last matches rule and its subexpressions, by the names found by isfile
+// and isdir, and by the fields of the message.
+package rules // import "9fans.net/go/plumb/rules"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Rules is a parsed rules file.
+type Rules struct {
+	Sets []*Ruleset
+	Vars map[string]string // variables defined by the file, as written after expansion
+}
+
+// A Ruleset is a set of rules that apply to a message together.
+type Ruleset struct {
+	File  string // file holding the rule set
+	Line  int    // line on which it starts
+	Rules []*Rule
+}
+
+// A Rule is a single rule in a rule set.
+type Rule struct {
+	Object string // "src", "dst", "wdir", "type", "data", "attr", "arg" or "plumb"
+	Verb   string // "is", "matches", "isfile", "isdir", "set", "add", "delete", "to", "start" or "client"
+	Arg    string // the argument, as written
+	Line   int
+
+	words []text
+	re    *regexp.Regexp // compiled pattern for matches, if fixed at parse time
+}
+
+// A text is a word of a rule's argument: literal pieces and
+// the names of variables to be expanded during evaluation.
+type text []piece
+
+type piece struct {
+	s     string
+	isVar bool
+}
+
+// special lists the variables expanded during evaluation.
+var special = map[string]bool{
+	"file": true, "dir": true,
+	"src": true, "dst": true, "wdir": true, "type": true, "data": true, "attr": true,
+}
+
+func isSpecial(name string) bool {
+	return len(name) == 1 && '0' <= name[0] && name[0] <= '9' || special[name]
+}
+
+// expand returns t with its variables replaced using lookup.
+func (t text) expand(lookup func(string) string) string {
+	var b strings.Builder
+	for _, p := range t {
+		if p.isVar {
+			b.WriteString(lookup(p.s))
+		} else {
+			b.WriteString(p.s)
+		}
+	}
+	return b.String()
+}
+
+// literal returns t as a string, if it has no variables.
+func (t text) literal() (string, bool) {
+	var b strings.Builder
+	for _, p := range t {
+		if p.isVar {
+			return "", false
+		}
+		b.WriteString(p.s)
+	}
+	return b.String(), true
+}
+
+var verbs = map[string][]string{
+	"is":      {"src", "dst", "wdir", "type", "data"},
+	"matches": {"src", "dst", "wdir", "type", "data"},
+	"isfile":  {"arg", "data"},
+	"isdir":   {"arg", "data"},
+	"set":     {"src", "dst", "wdir", "type", "data", "attr"},
+	"add":     {"attr"},
+	"delete":  {"attr"},
+	"to":      {"plumb"},
+	"start":   {"plumb"},
+	"client":  {"plumb"},
+}
+
+// ParseFile parses the named rules file.
+func ParseFile(name string) (*Rules, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(name, f)
+}
+
+// Parse parses the rules read from r. The name is used in error messages
+// and to find included files: an included file named by a relative path
+// is looked for in the directory holding name and then in $PLAN9/plumb.
+func Parse(name string, r io.Reader) (*Rules, error) {
+	p := &parser{rules: &Rules{Vars: make(map[string]string)}, vars: make(map[string]text)}
+	if err := p.parse(name, r, 0); err != nil {
+		return nil, err
+	}
+	return p.rules, nil
+}
+
+type parser struct {
+	rules *Rules
+	vars  map[string]text
+}
+
+// maxInclude limits the nesting of included files.
+const maxInclude = 10
+
+func (p *parser) parse(name string, r io.Reader, depth int) error {
+	var set *Ruleset
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line++
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", name, line, fmt.Sprintf(format, args...))
+		}
+		l := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(l, "#") {
+			continue
+		}
+		if l == "" {
+			set = nil
+			continue
+		}
+		if set == nil {
+			if v, rest, ok := assignment(l); ok {
+				words, err := p.words(rest, false)
+				if err != nil {
+					return errorf("%v", err)
+				}
+				var value text
+				if len(words) > 0 {
+					value = words[0]
+				}
+				p.vars[v] = value
+				p.rules.Vars[v] = value.expand(func(name string) string { return "$" + name })
+				continue
+			}
+		}
+		words, err := p.split(l)
+		if err != nil {
+			return errorf("%v", err)
+		}
+		if len(words) == 0 {
+			continue
+		}
+		first, _ := words[0].literal()
+
+		if first == "include" {
+			if len(words) != 2 {
+				return errorf("usage: include file")
+			}
+			file := words[1].expand(func(string) string { return "" })
+			set = nil
+			if depth >= maxInclude {
+				return errorf("include %s: nested too deeply", file)
+			}
+			f, err := openInclude(name, file)
+			if err != nil {
+				return errorf("include %s: %v", file, err)
+			}
+			err = p.parse(f.Name(), f, depth+1)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(words) < 3 {
+			return errorf("rule must be object verb argument")
+		}
+		object, _ := words[0].literal()
+		verb, _ := words[1].literal()
+		objects, ok := verbs[verb]
+		if !ok {
+			return errorf("unknown verb %q", verb)
+		}
+		if !contains(objects, object) {
+			return errorf("%s cannot be used with %s", verb, object)
+		}
+		rule := &Rule{
+			Object: object,
+			Verb:   verb,
+			Arg:    strings.TrimSpace(argText(l)),
+			Line:   line,
+			words:  words[2:],
+		}
+		if verb != "start" && verb != "client" && len(rule.words) > 1 {
+			return errorf("%s %s takes one argument; quote it", object, verb)
+		}
+		if verb == "matches" {
+			if re, ok := rule.words[0].literal(); ok {
+				rule.re, err = compile(re)
+				if err != nil {
+					return errorf("%v", err)
+				}
+			}
+		}
+		if set == nil {
+			set = &Ruleset{File: name, Line: line}
+			p.rules.Sets = append(p.rules.Sets, set)
+		}
+		set.Rules = append(set.Rules, rule)
+	}
+	return s.Err()
+}
+
+// assignment reports whether the line l has the form name = value,
+// with optional blanks around the =, and if so returns the name
+// and the unparsed value, which is the rest of the line.
+func assignment(l string) (name, value string, ok bool) {
+	i := strings.IndexAny(l, " \t=")
+	if i <= 0 || !isName(l[:i]) {
+		return "", "", false
+	}
+	rest := strings.TrimLeft(l[i:], " \t")
+	if !strings.HasPrefix(rest, "=") {
+		return "", "", false
+	}
+	return l[:i], strings.TrimLeft(rest[1:], " \t"), true
+}
+
+func isName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !(c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// argText returns the text following the first two words of a rule line.
+func argText(l string) string {
+	for i := 0; i < 2; i++ {
+		l = strings.TrimLeft(l, " \t")
+		if j := strings.IndexAny(l, " \t"); j >= 0 {
+			l = l[j:]
+		} else {
+			l = ""
+		}
+	}
+	return l
+}
+
+// split splits a line into words, processing quotes and variables.
+func (p *parser) split(l string) ([]text, error) {
+	return p.words(l, true)
+}
+
+// words processes quotes and variables in l, splitting it into words
+// at unquoted blanks if split is true, and otherwise returning
+// it as a single word, blanks included.
+func (p *parser) words(l string, split bool) ([]text, error) {
+	stop := " \t'$"
+	if !split {
+		stop = "'$"
+	}
+	var words []text
+	var w text
+	inWord := false
+	lit := func(s string) {
+		if n := len(w); n > 0 && !w[n-1].isVar {
+			w[n-1].s += s
+		} else {
+			w = append(w, piece{s: s})
+		}
+		inWord = true
+	}
+	for i := 0; i < len(l); {
+		c := l[i]
+		switch {
+		case split && (c == ' ' || c == '\t'):
+			if inWord {
+				words = append(words, w)
+				w, inWord = nil, false
+			}
+			i++
+		case c == '\'':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(l) {
+					return nil, fmt.Errorf("unterminated quote")
+				}
+				if l[i] == '\'' {
+					if i+1 < len(l) && l[i+1] == '\'' {
+						b.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteByte(l[i])
+				i++
+			}
+			lit(b.String())
+		case c == '$':
+			j := i + 1
+			if j < len(l) && '0' <= l[j] && l[j] <= '9' {
+				j++
+			} else {
+				for j < len(l) && (l[j] == '_' || 'a' <= l[j] && l[j] <= 'z' || 'A' <= l[j] && l[j] <= 'Z' || j > i+1 && '0' <= l[j] && l[j] <= '9') {
+					j++
+				}
+			}
+			name := l[i+1 : j]
+			i = j
+			switch {
+			case name == "":
+				lit("$")
+			case isSpecial(name):
+				w = append(w, piece{s: name, isVar: true})
+				inWord = true
+			default:
+				if v, ok := p.vars[name]; ok {
+					for _, pc := range v {
+						if pc.isVar {
+							w = append(w, pc)
+						} else {
+							lit(pc.s)
+						}
+					}
+				} else {
+					lit(os.Getenv(name))
+				}
+				inWord = true
+			}
+		default:
+			j := i
+			for j < len(l) && strings.IndexByte(stop, l[j]) < 0 {
+				j++
+			}
+			lit(l[i:j])
+			i = j
+		}
+	}
+	if inWord {
+		words = append(words, w)
+	}
+	return words, nil
+}
+
+// openInclude opens the file included by the rules file name.
+func openInclude(name, file string) (*os.File, error) {
+	if filepath.IsAbs(file) {
+		return os.Open(file)
+	}
+	f, err := os.Open(filepath.Join(filepath.Dir(name), file))
+	if err == nil {
+		return f, nil
+	}
+	root := os.Getenv("PLAN9")
+	if root == "" {
+		root = "/usr/local/plan9"
+	}
+	if f, err1 := os.Open(filepath.Join(root, "plumb", file)); err1 == nil {
+		return f, nil
+	}
+	return nil, err
+}
+
+// compile compiles a regular expression for a matches rule.
+// Plan 9 regular expressions choose the leftmost longest match.
+func compile(re string) (*regexp.Regexp, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return nil, err
+	}
+	r.Longest()
+	return r, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package rules
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"9fans.net/go/plumb"
+)
+
+const testRules = `# test rules
+editor=acme
+addr=':(#?[0-9]+)'
+twocolonaddr = ([0-9]+)[:.]([0-9]+)
+x=a b
+
+# urls go to web browser
+type is text
+data matches '(https?|ftp)://[a-zA-Z0-9_@\-]+([.:][a-zA-Z0-9_@\-]+)*/?[a-zA-Z0-9_?,%#~&/\-+=]+'
+plumb to web
+plumb start web $0
+
+# file:line goes to the editor
+type is text
+data matches '([.a-zA-Z0-9_/\-]+)'$addr
+arg isfile $1
+data set $file
+attr add addr=$2
+plumb to edit
+plumb client $editor
+
+# directories open in the editor too
+type is text
+data matches '[.a-zA-Z0-9_/\-]+'
+arg isdir $0
+plumb to edit
+plumb start $editor 'it''s' $dir
+
+# man pages
+type is text
+data matches '([a-zA-Z0-9_\-]+)\(([0-9])\)'
+data set 'man '$2' '$1
+attr delete click
+plumb to man
+`
+
+func parseTest(t *testing.T) *Rules {
+	r, err := Parse("test", strings.NewReader(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestParse(t *testing.T) {
+	r := parseTest(t)
+	if len(r.Sets) != 4 {
+		t.Fatalf("got %d rule sets, want 4", len(r.Sets))
+	}
+	for name, want := range map[string]string{
+		"addr":         ":(#?[0-9]+)",
+		"twocolonaddr": "([0-9]+)[:.]([0-9]+)",
+		"x":            "a b",
+	} {
+		if got := r.Vars[name]; got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	set := r.Sets[1]
+	if set.Line != 14 || len(set.Rules) != 7 {
+		t.Errorf("set 1 at line %d with %d rules, want line 14 with 7 rules", set.Line, len(set.Rules))
+	}
+	rule := set.Rules[1]
+	if rule.Object != "data" || rule.Verb != "matches" || rule.Arg != "'([.a-zA-Z0-9_/\\-]+)'$addr" {
+		t.Errorf("rule = %s %s %s", rule.Object, rule.Verb, rule.Arg)
+	}
+	if rule.re == nil || rule.re.String() != "([.a-zA-Z0-9_/\\-]+):(#?[0-9]+)" {
+		t.Errorf("regexp = %v", rule.re)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{
+		"type is",
+		"type frob text",
+		"plumb is text",
+		"data matches '('",
+		"data matches 'unterminated",
+		"data matches a b",
+		"include /nonexistent/file",
+	} {
+		if _, err := Parse("test", strings.NewReader(text)); err == nil || !strings.HasPrefix(err.Error(), "test:1: ") {
+			t.Errorf("Parse(%q) = %v, want test:1 error", text, err)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "x.go"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	r := parseTest(t)
+	text := func(data string, attr *plumb.Attribute) *plumb.Message {
+		return &plumb.Message{Src: "acme", Dir: dir, Type: "text", Attr: attr, Data: []byte(data)}
+	}
+	tests := []struct {
+		m      *plumb.Message
+		port   string
+		data   string
+		attr   string
+		start  []string
+		client []string
+	}{
+		{
+			m:     text("http://9fans.net/go", nil),
+			port:  "web",
+			data:  "http://9fans.net/go",
+			start: []string{"web", "http://9fans.net/go"},
+		},
+		{
+			m:      text("x.go:12", &plumb.Attribute{Name: "a", Value: "b c"}),
+			port:   "edit",
+			data:   filepath.Join(dir, "x.go"),
+			attr:   "a='b c' addr=12",
+			client: []string{"acme"},
+		},
+		{
+			m:     text("sub", nil),
+			port:  "edit",
+			data:  "sub",
+			start: []string{"acme", "it's", filepath.Join(dir, "sub")},
+		},
+		{
+			m:    text("see ls(1) for more", &plumb.Attribute{Name: "click", Value: "6"}),
+			port: "man",
+			data: "man 1 ls",
+		},
+		{m: text("y.go:12", nil)},
+		{m: text("see ls(1) for more", nil)},
+		{m: &plumb.Message{Dst: "edit", Type: "text", Data: []byte("http://9fans.net/")}},
+	}
+	for _, tt := range tests {
+		res := r.Match(tt.m)
+		if tt.port == "" {
+			if res != nil {
+				t.Errorf("Match(%q) = port %q, want no match", tt.m.Data, res.Port)
+			}
+			continue
+		}
+		if res == nil {
+			t.Errorf("Match(%q) = no match, want port %q", tt.m.Data, tt.port)
+			continue
+		}
+		if res.Port != tt.port || res.Message.Dst != tt.port {
+			t.Errorf("Match(%q) port = %q, dst = %q, want %q", tt.m.Data, res.Port, res.Message.Dst, tt.port)
+		}
+		if got := string(res.Message.Data); got != tt.data {
+			t.Errorf("Match(%q) data = %q, want %q", tt.m.Data, got, tt.data)
+		}
+		if got := formatAttr(res.Message.Attr); got != tt.attr {
+			t.Errorf("Match(%q) attr = %q, want %q", tt.m.Data, got, tt.attr)
+		}
+		if !reflect.DeepEqual(res.Start, tt.start) || !reflect.DeepEqual(res.Client, tt.client) {
+			t.Errorf("Match(%q) start = %q, client = %q, want %q, %q", tt.m.Data, res.Start, res.Client, tt.start, tt.client)
+		}
+	}
+	if m := tests[1].m; string(m.Data) != "x.go:12" || m.Attr.Next != nil {
+		t.Errorf("Match modified its message")
+	}
+}
+
+func TestInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "basic"), []byte("port=edit\n\ntype is text\nplumb to $port\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(dir, "rules")
+	if err := ioutil.WriteFile(main, []byte("type is image\nplumb to image\n\ninclude basic\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ParseFile(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Sets) != 2 || r.Sets[1].File != filepath.Join(dir, "basic") {
+		t.Fatalf("got %d rule sets", len(r.Sets))
+	}
+	res := r.Match(&plumb.Message{Type: "text"})
+	if res == nil || res.Port != "edit" {
+		t.Errorf("Match = %+v, want port edit", res)
+	}
+}
+
+func TestAttr(t *testing.T) {
+	for _, s := range []string{"", "a=b", "a=b c='d e' f='it''s' g='x=y'"} {
+		attr, err := parseAttr(s)
+		if err != nil {
+			t.Errorf("parseAttr(%q): %v", s, err)
+			continue
+		}
+		if got := formatAttr(attr); got != s {
+			t.Errorf("formatAttr(parseAttr(%q)) = %q", s, got)
+		}
+	}
+	for _, s := range []string{"a", "=b", "a='b"} {
+		if _, err := parseAttr(s); err == nil {
+			t.Errorf("parseAttr(%q) succeeded", s)
+		}
+	}
+}